@@ -70,11 +70,123 @@ const (
 	// DefaultMaxResultsPerQuery limits results per search query.
 	DefaultMaxResultsPerQuery = 25
 
+	// AggregationBuckets is how many buckets (sites, authors, file types)
+	// summary tables show.
+	AggregationBuckets = 10
+
+	// AggregationQueryBuckets is how many buckets each keyword's
+	// aggregation requests. It exceeds AggregationBuckets so that values
+	// outside one keyword's top buckets still count towards the totals.
+	AggregationQueryBuckets = 100
+
 	// MaxFileSizeForScan is the maximum file size (50MB) for secret scanning.
 	// Files larger than this are skipped to avoid memory issues.
 	MaxFileSizeForScan = 50 * 1024 * 1024
 )
 
+// =============================================================================
+// Extraction Configuration
+// =============================================================================
+
+const (
+	// SniffSampleSize is how many leading bytes are inspected to decide
+	// whether a file is text, a supported container, or unscannable binary.
+	SniffSampleSize = 8 * 1024
+
+	// MaxControlCharPercent is the share of control characters a sample may
+	// contain and still be treated as text.
+	MaxControlCharPercent = 10
+
+	// MaxContainerDepth limits recursion into nested containers
+	// (e.g. a zip inside a zip inside a docx).
+	MaxContainerDepth = 4
+
+	// MaxPasswordCandidates caps how many passwords (defaults plus those
+	// found during a scan) are tried against protected key material and
+	// encrypted containers.
+	MaxPasswordCandidates = 500
+
+	// MaxKeePassRounds is the most AES-KDF transform rounds a KeePass
+	// database may use and still be opened; each candidate password costs
+	// one full transform.
+	MaxKeePassRounds = 10000000
+
+	// MaxOfficeSpinCount is the most hash iterations an encrypted Office
+	// document may ask for, the limit set by MS-OFFCRYPTO.
+	MaxOfficeSpinCount = 10000000
+
+	// MaxPKCS12Iterations is the most KDF iterations a PKCS#12 MAC or key
+	// encryption may ask for and still be opened. Windows, OpenSSL and Java
+	// exports use a few thousand; each candidate password costs the full
+	// count.
+	MaxPKCS12Iterations = 1000000
+
+	// MaxDecodeDepth limits how many encoding layers (base64, URL, hex)
+	// are peeled off a segment before giving up.
+	MaxDecodeDepth = 3
+
+	// MaxDecodedSize is the largest encoded segment, once decoded, that is
+	// rescanned. Larger blobs are usually embedded images or binaries.
+	MaxDecodedSize = 1024 * 1024
+
+	// MaxDecodedSegments caps how many encoded segments are decoded per
+	// document, bounding the cost of base64-heavy files.
+	MaxDecodedSegments = 256
+
+	// DefaultContextLines is how many lines before and after a finding are
+	// kept as context, like grep -C.
+	DefaultContextLines = 2
+
+	// DefaultContextWidth is the longest context line, in characters, kept
+	// before it is cut down to a window around the match.
+	DefaultContextWidth = 100
+
+	// MaxGitCommits caps how many commits of a repository's history are
+	// diffed and scanned.
+	MaxGitCommits = 10000
+
+	// MaxGitPackSize is the largest packfile loaded when scanning git
+	// history. Packs are read into memory whole.
+	MaxGitPackSize = 512 * 1024 * 1024
+
+	// MaxGitCacheSize bounds the trees and commits kept in memory per
+	// packfile while diffing history.
+	MaxGitCacheSize = 64 * 1024 * 1024
+
+	// MaxGitDeltaDepth is the longest chain of deltas followed to rebuild
+	// a packed object. Git writes chains of at most 50 by default; longer
+	// or looping chains are treated as corrupt.
+	MaxGitDeltaDepth = 50
+
+	// SweepProgressInterval is how often a sweep reports progress.
+	SweepProgressInterval = 5 * time.Second
+
+	// StdinName is the file name given to findings from standard input
+	// when the caller does not supply one.
+	StdinName = "stdin"
+)
+
+// =============================================================================
+// Output Configuration
+// =============================================================================
+
+const (
+	// ToolName and ToolURL identify azonk in reports read by other tools.
+	ToolName = "azonk"
+	ToolURL  = "https://github.com/loosehose/azonk"
+
+	// SARIFFileName is the SARIF 2.1.0 export of extracted secrets.
+	SARIFFileName = "secrets_found.sarif"
+
+	// AggregatesFileName holds search hit counts by site, author, file
+	// type and modification date.
+	AggregatesFileName = "search_aggregates.json"
+
+	// SweepResultsFileName is the JSON export of a sweep's findings and
+	// statistics.
+	SweepResultsFileName = "sweep_results.json"
+)
+
 // =============================================================================
 // User Agent
 // =============================================================================
@@ -113,6 +225,159 @@ func CredentialKeywords() []string {
 	}
 }
 
+// DefaultKeywordProfile names the profile holding CredentialKeywords.
+const DefaultKeywordProfile = "default"
+
+// KeywordProfiles returns the built-in keyword profiles by name, written
+// in wordlist syntax: a keyword, optionally followed by "|" and the file
+// types it is most often found in.
+func KeywordProfiles() map[string][]string {
+	return map[string][]string{
+		DefaultKeywordProfile: CredentialKeywords(),
+		"cloud": {
+			"aws_secret_access_key | txt, ini, config, json, ps1, sh",
+			"aws_access_key_id | txt, ini, config, json, ps1, sh",
+			"AccountKey | config, json, xml, ps1",
+			"SharedAccessSignature | config, json, xml",
+			"client_secret | json, config, ps1, py",
+			"service principal | ps1, txt, docx",
+			"private_key_id | json",
+			"subscription key | config, json, txt",
+		},
+		"database": {
+			"connection string | config, xml, json, txt",
+			"connectionstring | config, xml, json",
+			"Initial Catalog | config, xml, json",
+			"sa password | sql, txt, docx, xlsx",
+			"jdbc | properties, xml, config",
+			"mongodb | config, json, env, yml",
+			"db_password | env, php, config, yml",
+		},
+		"network-devices": {
+			"enable secret | txt, cfg, conf",
+			"snmp community | txt, cfg, conf, xlsx",
+			"tacacs | txt, cfg, conf",
+			"radius secret | txt, cfg, conf",
+			"running-config | txt, cfg",
+			"admin password | txt, xlsx, docx",
+		},
+		"vpn": {
+			"vpn password | txt, docx, xlsx",
+			"pre-shared key | txt, docx, xlsx, conf",
+			"psk | txt, conf, xlsx",
+			"openvpn | ovpn, txt, conf",
+			"anyconnect | xml, txt",
+			"PrivateKey | conf",
+		},
+		"payments": {
+			"credit card | xlsx, csv, docx",
+			"card number | xlsx, csv",
+			"cvv | xlsx, csv, docx",
+			"iban | xlsx, csv, docx",
+			"sk_live | config, json, env, js",
+			"merchant id | xlsx, docx, config",
+		},
+		"pfx-certs": {
+			"pfx password | txt, docx, xlsx",
+			"certificate password | txt, docx, xlsx",
+			"private key | pem, key, txt",
+			"BEGIN RSA PRIVATE KEY | pem, key, txt",
+			"keystore | jks, properties, xml",
+			"pfx | pfx, p12",
+		},
+	}
+}
+
+// LanguagePack holds the credential vocabulary of one language: search
+// keywords in wordlist syntax, and the key names a password is assigned to
+// in documents and configuration ("Passwort: ..."). Short key names are
+// abbreviations or everyday words that count only when followed by a colon
+// or equals sign, so "clave privada" is not read as a password.
+type LanguagePack struct {
+	Name          string
+	Keywords      []string
+	KeyNames      []string
+	ShortKeyNames []string
+}
+
+// LanguageSuggestMinShare is the share of users with a preferred language
+// set that must use a language before its pack is suggested.
+const LanguageSuggestMinShare = 0.05
+
+// LanguagePacks returns the built-in language packs by ISO 639-1 code.
+// Key names match with spaces, underscores and hyphens interchangeable or
+// left out, so "mot de passe" also covers mot_de_passe and motdepasse.
+func LanguagePacks() map[string]LanguagePack {
+	return map[string]LanguagePack{
+		"de": {
+			Name: "German",
+			Keywords: []string{
+				"Passwort",
+				"Kennwort",
+				"Zugangsdaten",
+				"Anmeldedaten",
+				"Zugangsschlüssel",
+				"privater Schlüssel",
+				"Verbindungszeichenfolge | config, xml, json",
+				"Geheimnis",
+			},
+			KeyNames: []string{"passwort", "kennwort", "passwörter", "kennwörter"},
+		},
+		"fr": {
+			Name: "French",
+			Keywords: []string{
+				"mot de passe",
+				"mdp",
+				"identifiants",
+				"clé privée",
+				"clé API",
+				"chaîne de connexion | config, xml, json",
+				"jeton d'accès",
+			},
+			KeyNames:      []string{"mot de passe", "mots de passe"},
+			ShortKeyNames: []string{"mdp"},
+		},
+		"es": {
+			Name: "Spanish",
+			Keywords: []string{
+				"contraseña",
+				"credenciales",
+				"clave privada",
+				"clave de API",
+				"cadena de conexión | config, xml, json",
+				"token de acceso",
+			},
+			KeyNames:      []string{"contraseña", "contrasena"},
+			ShortKeyNames: []string{"clave"},
+		},
+		"nl": {
+			Name: "Dutch",
+			Keywords: []string{
+				"wachtwoord",
+				"inloggegevens",
+				"persoonlijke sleutel",
+				"geheime sleutel",
+				"verbindingsreeks | config, xml, json",
+				"toegangstoken",
+			},
+			KeyNames: []string{"wachtwoord", "wachtwoorden"},
+		},
+		"pt": {
+			Name: "Portuguese",
+			Keywords: []string{
+				"senha",
+				"palavra-passe",
+				"credenciais",
+				"chave privada",
+				"chave de API",
+				"cadeia de conexão | config, xml, json",
+				"token de acesso",
+			},
+			KeyNames: []string{"senha", "palavra-passe"},
+		},
+	}
+}
+
 // HighValueExtensions returns file extensions that commonly contain credentials.
 // These are prioritized for automatic download during hunt operations.
 func HighValueExtensions() []string {
@@ -129,11 +394,50 @@ func HighValueExtensions() []string {
 		"sql", "tf",
 		// Backup files
 		"bak",
+		// Certificates and private keys
+		"pfx", "p12", "pem", "key",
+		// Exported email
+		"eml", "msg",
 	}
 }
 
-// ScannableExtensions returns file extensions that can be scanned for secrets.
-// Binary files and non-text formats are excluded.
+// FileSignature identifies files that hold secrets by name alone.
+type FileSignature struct {
+	Name     string
+	Patterns []string // Lowercase file names; "*.ext" matches an extension
+	Priority int      // 1 to 3; higher priority files are downloaded first
+}
+
+// FileSignatures returns the catalog of sensitive file signatures used by
+// the filename hunt, highest priority first.
+func FileSignatures() []FileSignature {
+	return []FileSignature{
+		// Credential stores and private keys
+		{Name: "KeePass database", Patterns: []string{"*.kdbx", "*.kdb"}, Priority: 3},
+		{Name: "SSH private key", Patterns: []string{"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519"}, Priority: 3},
+		{Name: "PuTTY private key", Patterns: []string{"*.ppk"}, Priority: 3},
+		{Name: "Azure publish profile", Patterns: []string{"*.publishsettings"}, Priority: 3},
+		{Name: "Terraform state", Patterns: []string{"*.tfstate"}, Priority: 3},
+		{Name: "Cloud credential export", Patterns: []string{"credentials.csv", "accesskeys.csv"}, Priority: 3},
+
+		// Configuration with embedded credentials
+		{Name: "Certificate store", Patterns: []string{"*.pfx", "*.p12", "*.jks", "*.keystore"}, Priority: 2},
+		{Name: "Windows unattended setup", Patterns: []string{"unattend.xml", "autounattend.xml", "sysprep.xml", "sysprep.inf"}, Priority: 2},
+		{Name: "Group Policy preferences", Patterns: []string{"groups.xml", "services.xml", "scheduledtasks.xml", "datasources.xml"}, Priority: 2},
+		{Name: "Application configuration", Patterns: []string{"web.config", "app.config", "appsettings.json"}, Priority: 2},
+		{Name: "Kubernetes config", Patterns: []string{"kubeconfig"}, Priority: 2},
+		{Name: "VPN profile", Patterns: []string{"*.ovpn", "*.pcf"}, Priority: 2},
+		{Name: "Remote Desktop Connection Manager file", Patterns: []string{"*.rdg"}, Priority: 2},
+
+		// Connection details, sometimes with saved credentials
+		{Name: "Remote Desktop connection", Patterns: []string{"*.rdp"}, Priority: 1},
+		{Name: "Database connection file", Patterns: []string{"*.udl", "*.dsn"}, Priority: 1},
+	}
+}
+
+// ScannableExtensions returns file extensions that are known to hold text.
+// Files are routed by content sniffing; these extensions only settle the
+// decision when a sample is ambiguous.
 func ScannableExtensions() map[string]bool {
 	return map[string]bool{
 		// Text and logs
@@ -149,5 +453,38 @@ func ScannableExtensions() map[string]bool {
 		".cs": true, ".java": true, ".php": true, ".rb": true,
 		// Documentation and infrastructure
 		".md": true, ".rst": true, ".sql": true, ".tf": true,
+		// PEM-encoded keys and certificates
+		".pem": true, ".key": true, ".crt": true,
+	}
+}
+
+// SecretFileNames returns well-known filenames (lowercase) that hold
+// credentials but carry no telling extension.
+func SecretFileNames() map[string]bool {
+	return map[string]bool{
+		// SSH keys and configuration
+		"id_rsa": true, "id_dsa": true, "id_ecdsa": true, "id_ed25519": true,
+		"authorized_keys": true, "known_hosts": true,
+		// Shell history
+		".bash_history": true, ".zsh_history": true, ".sh_history": true,
+		".psql_history": true, ".mysql_history": true, "consolehost_history.txt": true,
+		// Credential stores
+		"credentials": true, ".pgpass": true, ".netrc": true, "_netrc": true,
+		".git-credentials": true, ".htpasswd": true, ".my.cnf": true,
+		".npmrc": true, ".pypirc": true, ".dockercfg": true, ".s3cfg": true,
+		".boto": true, "shadow": true, "passwd": true,
+		// Build and deployment files
+		"dockerfile": true, "makefile": true, "jenkinsfile": true, "vagrantfile": true,
+		".env": true, ".envrc": true,
+	}
+}
+
+// DefaultKeyPasswords returns passwords commonly used to protect exported
+// certificates and keys. They are tried before passwords found in the scan.
+func DefaultKeyPasswords() []string {
+	return []string{
+		"password", "Password1", "P@ssw0rd", "P@ssword1", "changeit", "changeme",
+		"123456", "1234", "pass", "secret", "test", "cert", "certificate",
+		"export", "admin", "azure", "Welcome1",
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -57,6 +58,8 @@ func (d *Downloader) DownloadItem(item types.DriveItem) (*types.DownloadedFile,
 }
 
 // DownloadBatch downloads multiple items with optional extension filtering.
+// Items matching a sensitive file signature or found by a detector query
+// are downloaded regardless of extension.
 func (d *Downloader) DownloadBatch(items []types.DriveItem, extensions []string) []types.DownloadedFile {
 	ui.Info("Downloading %d files...", len(items))
 
@@ -64,7 +67,7 @@ func (d *Downloader) DownloadBatch(items []types.DriveItem, extensions []string)
 
 	var downloaded []types.DownloadedFile
 	for i, item := range items {
-		if len(extFilter) > 0 && !matchesExtension(item.Name, extFilter) {
+		if len(extFilter) > 0 && item.Signature == "" && item.Detector == "" && !matchesExtension(item.Name, extFilter) {
 			continue
 		}
 
@@ -86,9 +89,13 @@ func (d *Downloader) DownloadBatch(items []types.DriveItem, extensions []string)
 	return downloaded
 }
 
-// DownloadFromSearchResults extracts items from search results and downloads them.
+// DownloadFromSearchResults extracts items from search results and downloads
+// them, highest signature priority first.
 func (d *Downloader) DownloadFromSearchResults(results []types.SearchResult, extensions []string) []types.DownloadedFile {
 	items := collectUniqueItems(results)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Priority > items[j].Priority
+	})
 
 	if len(items) == 0 {
 		ui.Warning("No files to download")
@@ -216,6 +223,9 @@ func collectUniqueItems(results []types.SearchResult) []types.DriveItem {
 	var items []types.DriveItem
 
 	for _, result := range results {
+		if !result.HoldsFiles() {
+			continue
+		}
 		for _, item := range result.Items {
 			if !seen[item.ID] {
 				seen[item.ID] = true
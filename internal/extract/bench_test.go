@@ -0,0 +1,111 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// benchFillerLines are typical lines of the config files, scripts and
+// exported documents a hunt downloads, most of which hold no secret.
+var benchFillerLines = []string{
+	`<add key="LogLevel" value="Information" />`,
+	`    "timeout": 30, "retries": 3, "region": "westeurope",`,
+	`Write-Host "Deploying application to $environment"`,
+	`The quarterly review covers onboarding, access reviews and the VPN rollout.`,
+	`server.port=8080`,
+	`  - name: build-and-test`,
+	`SELECT id, name FROM customers WHERE created > '2024-01-01';`,
+	`# Configuration for the staging environment, see the wiki for details`,
+	`Meeting notes: agreed to move the share to the new site before March.`,
+	`if ($LASTEXITCODE -ne 0) { throw "Build failed" }`,
+}
+
+// benchCorpus builds a document of n lines where about one line in forty
+// holds a secret for one of the detectors.
+func benchCorpus(n int) []byte {
+	names := make([]string, 0, len(detectorSamples))
+	for name := range detectorSamples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		if i%40 == 39 {
+			b.WriteString(detectorSamples[names[(i/40)%len(names)]])
+		} else {
+			b.WriteString(benchFillerLines[(i*7)%len(benchFillerLines)])
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// BenchmarkScan compares running every regex on every line with the
+// prefiltered scan, and scanning files on one worker with the pool.
+func BenchmarkScan(b *testing.B) {
+	e := newTestExtractor(b)
+	data := benchCorpus(20000)
+
+	b.Run("regex-only", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			scanRegexOnly(e, data)
+		}
+	})
+
+	b.Run("prefilter", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			e.scanDocument("bench", document{data: data}, nil)
+		}
+	})
+
+	dir := b.TempDir()
+	var paths []string
+	for i := 0; i < 64; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d.config", i))
+		if err := os.WriteFile(path, data[:len(data)/8], 0644); err != nil {
+			b.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	total := int64(len(paths) * (len(data) / 8))
+
+	// At least four workers, so the pool is measured on small machines too
+	for _, workers := range []int{1, max(runtime.NumCPU(), 4)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			e.SetWorkers(workers)
+			defer silenceStdout(b)()
+
+			b.SetBytes(total)
+			for i := 0; i < b.N; i++ {
+				e.runPool(paths, e.scanFile, nil, nil)
+			}
+		})
+	}
+}
+
+// silenceStdout discards the progress the scan prints until the returned
+// function restores it.
+func silenceStdout(tb testing.TB) func() {
+	tb.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stdout, colored := os.Stdout, color.Output
+	os.Stdout, color.Output = devNull, io.Discard
+	return func() {
+		os.Stdout, color.Output = stdout, colored
+		devNull.Close()
+	}
+}
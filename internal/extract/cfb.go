@@ -0,0 +1,331 @@
+// cfb.go reads OLE compound files (MS-CFB), the container behind Outlook
+// .msg, legacy Office documents, VBA projects and encrypted OOXML.
+package extract
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Compound File
+// =============================================================================
+
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbFreeSect   = 0xFFFFFFFF
+	cfbNoStream   = 0xFFFFFFFF
+	cfbHeaderSize = 512
+	cfbEntrySize  = 128
+
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// cfbFile is a parsed compound file held in memory.
+type cfbFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	entries        []cfbEntry
+}
+
+type cfbEntry struct {
+	name  string
+	typ   byte
+	left  uint32
+	right uint32
+	child uint32
+	start uint32
+	size  uint64
+}
+
+// cfbNode is a storage or stream in the directory tree.
+type cfbNode struct {
+	name     string
+	storage  bool
+	children []*cfbNode
+	entry    int
+}
+
+// openCFB parses the header, allocation tables and directory of a
+// compound file.
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < cfbHeaderSize || string(data[:8]) != string(cfbSignature) {
+		return nil, errors.New("not a compound file")
+	}
+
+	// Version 3 files use 512-byte sectors and version 4 files 4096-byte
+	// ones; mini sectors are always 64 bytes
+	sectorShift := binary.LittleEndian.Uint16(data[0x1E:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, errors.New("invalid sector size")
+	}
+	if binary.LittleEndian.Uint16(data[0x20:]) != 6 {
+		return nil, errors.New("invalid mini sector size")
+	}
+
+	c := &cfbFile{
+		data:           data,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << 6,
+		miniCutoff:     uint64(binary.LittleEndian.Uint32(data[0x38:])),
+	}
+
+	// DIFAT: 109 entries in the header, then a chain of DIFAT sectors
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := binary.LittleEndian.Uint32(data[0x4C+4*i:]); s != cfbFreeSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	difat := binary.LittleEndian.Uint32(data[0x44:])
+	for n := 0; difat != cfbEndOfChain && difat != cfbFreeSect && n < len(data)/c.sectorSize; n++ {
+		sector, err := c.sector(difat)
+		if err != nil {
+			return nil, err
+		}
+		per := c.sectorSize/4 - 1
+		for i := 0; i < per; i++ {
+			if s := binary.LittleEndian.Uint32(sector[4*i:]); s != cfbFreeSect {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		difat = binary.LittleEndian.Uint32(sector[4*per:])
+	}
+
+	// Each FAT sector maps sectorSize/4 sectors; once the table covers
+	// every sector in the file, repeated entries only lengthen cycles
+	sectors := len(data)/c.sectorSize - 1
+	for _, s := range fatSectors {
+		if len(c.fat) >= sectors {
+			break
+		}
+		sector, err := c.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < c.sectorSize; i += 4 {
+			c.fat = append(c.fat, binary.LittleEndian.Uint32(sector[i:]))
+		}
+	}
+
+	dir, err := c.chain(binary.LittleEndian.Uint32(data[0x30:]), 0)
+	if err != nil {
+		return nil, err
+	}
+	for off := 0; off+cfbEntrySize <= len(dir); off += cfbEntrySize {
+		c.entries = append(c.entries, parseCFBEntry(dir[off:off+cfbEntrySize]))
+	}
+	if len(c.entries) == 0 || c.entries[0].typ != cfbTypeRoot {
+		return nil, errors.New("missing root entry")
+	}
+
+	if miniFAT, err := c.chain(binary.LittleEndian.Uint32(data[0x3C:]), 0); err == nil {
+		for i := 0; i+4 <= len(miniFAT); i += 4 {
+			c.miniFAT = append(c.miniFAT, binary.LittleEndian.Uint32(miniFAT[i:]))
+		}
+	}
+
+	root := c.entries[0]
+	if root.start != cfbEndOfChain {
+		c.miniStream, _ = c.chain(root.start, root.size)
+	}
+
+	return c, nil
+}
+
+func parseCFBEntry(b []byte) cfbEntry {
+	nameLen := int(binary.LittleEndian.Uint16(b[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+
+	units := make([]uint16, 0, 32)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := binary.LittleEndian.Uint16(b[i:]); u != 0 {
+			units = append(units, u)
+		}
+	}
+
+	return cfbEntry{
+		name:  string(utf16.Decode(units)),
+		typ:   b[66],
+		left:  binary.LittleEndian.Uint32(b[68:]),
+		right: binary.LittleEndian.Uint32(b[72:]),
+		child: binary.LittleEndian.Uint32(b[76:]),
+		start: binary.LittleEndian.Uint32(b[116:]),
+		size:  binary.LittleEndian.Uint64(b[120:]),
+	}
+}
+
+// =============================================================================
+// Directory Tree
+// =============================================================================
+
+// root returns the directory tree rooted at the root storage.
+func (c *cfbFile) root() *cfbNode {
+	visited := make(map[uint32]bool)
+	return c.node(0, visited)
+}
+
+func (c *cfbFile) node(idx uint32, visited map[uint32]bool) *cfbNode {
+	e := c.entries[idx]
+	n := &cfbNode{name: e.name, storage: e.typ != cfbTypeStream, entry: int(idx)}
+	if !n.storage {
+		return n
+	}
+
+	// Children form a red-black tree hanging off the child pointer
+	var walk func(i uint32)
+	walk = func(i uint32) {
+		if i == cfbNoStream || int(i) >= len(c.entries) || visited[i] {
+			return
+		}
+		visited[i] = true
+		walk(c.entries[i].left)
+		if t := c.entries[i].typ; t == cfbTypeStorage || t == cfbTypeStream {
+			n.children = append(n.children, c.node(i, visited))
+		}
+		walk(c.entries[i].right)
+	}
+	walk(e.child)
+	return n
+}
+
+// child returns the named child, matching case-insensitively as CFB does.
+func (n *cfbNode) child(name string) *cfbNode {
+	for _, ch := range n.children {
+		if strings.EqualFold(ch.name, name) {
+			return ch
+		}
+	}
+	return nil
+}
+
+// read returns the contents of a stream.
+func (c *cfbFile) read(n *cfbNode) ([]byte, error) {
+	if n == nil || n.storage {
+		return nil, errors.New("not a stream")
+	}
+
+	e := c.entries[n.entry]
+	if e.size < c.miniCutoff {
+		return c.miniChain(e.start, e.size)
+	}
+	return c.chain(e.start, e.size)
+}
+
+// =============================================================================
+// Sector Chains
+// =============================================================================
+
+func (c *cfbFile) sector(idx uint32) ([]byte, error) {
+	// The header occupies the first sector-sized slot
+	off := (int64(idx) + 1) * int64(c.sectorSize)
+	if off < 0 || off+int64(c.sectorSize) > int64(len(c.data)) {
+		return nil, errors.New("sector out of range")
+	}
+	return c.data[off : off+int64(c.sectorSize)], nil
+}
+
+// chain follows the FAT from start. A size of 0 reads the whole chain.
+func (c *cfbFile) chain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	for s, n := start, 0; s != cfbEndOfChain; n++ {
+		if int(s) >= len(c.fat) || n > len(c.fat) {
+			return nil, errors.New("broken sector chain")
+		}
+		sector, err := c.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sector...)
+		if size > 0 && uint64(len(out)) >= size {
+			break
+		}
+		s = c.fat[s]
+	}
+
+	if size > 0 && uint64(len(out)) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// miniChain follows the mini FAT through the mini stream.
+func (c *cfbFile) miniChain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	for s, n := start, 0; s != cfbEndOfChain && uint64(len(out)) < size; n++ {
+		off := int64(s) * int64(c.miniSectorSize)
+		end := off + int64(c.miniSectorSize)
+		if int64(s) >= int64(len(c.miniFAT)) || n > len(c.miniFAT) || end > int64(len(c.miniStream)) {
+			return nil, errors.New("broken mini sector chain")
+		}
+		out = append(out, c.miniStream[off:end]...)
+		s = c.miniFAT[s]
+	}
+
+	if uint64(len(out)) > size {
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// =============================================================================
+// Scanning
+// =============================================================================
+
+// scanOLE routes a compound file to the handler for the format it holds:
+// Outlook messages, encrypted Office documents, VBA projects and embedded
+// OLE objects.
+func (e *Extractor) scanOLE(file, location string, data []byte, depth scanDepth) []types.SecretMatch {
+	c, err := openCFB(data)
+	if err != nil {
+		return nil
+	}
+
+	root := c.root()
+	if isMSG(root) {
+		return e.scanMSG(file, location, c, root, depth)
+	}
+	if container, ok := officeEncryption(c, root); ok {
+		return e.scanProtected(file, location, container, depth)
+	}
+
+	// Macros of legacy Office documents and OOXML vbaProject.bin parts
+	matches := e.scanVBA(file, location, c, root, depth)
+	if p := legacyOfficeEncryption(c, root); p != nil {
+		matches = append(matches, e.scanProtected(file, location, lockedContainer{p}, depth)...)
+	}
+
+	// Embedded OLE objects: a file wrapped by Object Packager, or an
+	// Office document stored whole
+	if depth.containers >= config.MaxContainerDepth {
+		return matches
+	}
+	depth.containers++
+	if data, err := c.read(root.child("\x01Ole10Native")); err == nil {
+		if label, content, ok := ole10Native(data); ok {
+			matches = append(matches, e.scanContent(file, label, joinLocation(location, label), content, depth)...)
+		}
+	}
+	for _, name := range []string{"Package", "CONTENTS"} {
+		if data, err := c.read(root.child(name)); err == nil {
+			matches = append(matches, e.scanContent(file, "", location, data, depth)...)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,165 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildCFB writes a version 3 compound file holding one stream, "Data",
+// small enough to live in the mini stream.
+func buildCFB(content []byte) []byte {
+	sector := func() []byte { return make([]byte, 512) }
+	le32 := binary.LittleEndian.PutUint32
+
+	header := sector()
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x18:], 0x3E) // minor version
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)    // major version
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9) // 512-byte sectors
+	binary.LittleEndian.PutUint16(header[0x20:], 6) // 64-byte mini sectors
+	le32(header[0x2C:], 1)                          // FAT sectors
+	le32(header[0x30:], 1)                          // directory start
+	le32(header[0x38:], 4096)                       // mini stream cutoff
+	le32(header[0x3C:], 2)                          // mini FAT start
+	le32(header[0x40:], 1)                          // mini FAT sectors
+	le32(header[0x44:], cfbEndOfChain)              // no DIFAT sectors
+	for i := 0; i < 109; i++ {
+		le32(header[0x4C+4*i:], cfbFreeSect)
+	}
+	le32(header[0x4C:], 0)
+
+	// Sector 0 is the FAT, 1 the directory, 2 the mini FAT, 3 the mini stream
+	fat := sector()
+	for i := 0; i < 128; i++ {
+		le32(fat[4*i:], cfbFreeSect)
+	}
+	le32(fat[0:], 0xFFFFFFFD)
+	le32(fat[4:], cfbEndOfChain)
+	le32(fat[8:], cfbEndOfChain)
+	le32(fat[12:], cfbEndOfChain)
+
+	dir := sector()
+	entry := func(b []byte, name string, typ byte, child, start uint32, size uint64) {
+		for i, r := range name {
+			binary.LittleEndian.PutUint16(b[2*i:], uint16(r))
+		}
+		binary.LittleEndian.PutUint16(b[64:], uint16(2*len(name)+2))
+		b[66] = typ
+		le32(b[68:], cfbNoStream)
+		le32(b[72:], cfbNoStream)
+		le32(b[76:], child)
+		le32(b[116:], start)
+		binary.LittleEndian.PutUint64(b[120:], size)
+	}
+	entry(dir[0:], "Root Entry", cfbTypeRoot, 1, 3, 64)
+	entry(dir[cfbEntrySize:], "Data", cfbTypeStream, cfbNoStream, 0, uint64(len(content)))
+	for off := 2 * cfbEntrySize; off < len(dir); off += cfbEntrySize {
+		entry(dir[off:], "", 0, cfbNoStream, cfbEndOfChain, 0)
+	}
+
+	miniFAT := sector()
+	for i := 0; i < 128; i++ {
+		le32(miniFAT[4*i:], cfbFreeSect)
+	}
+	le32(miniFAT[0:], cfbEndOfChain)
+
+	mini := sector()
+	copy(mini, content)
+
+	return bytes.Join([][]byte{header, fat, dir, miniFAT, mini}, nil)
+}
+
+func TestOpenCFB(t *testing.T) {
+	data := buildCFB([]byte("hello"))
+	c, err := openCFB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.read(c.root().child("data"))
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("read = %q, %v; want hello", got, err)
+	}
+}
+
+func TestOpenCFBMalformedHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		value  uint16
+	}{
+		{"mini sector shift 63", 0x20, 63},
+		{"mini sector shift 0", 0x20, 0},
+		{"mini sector shift 12", 0x20, 12},
+		{"sector shift 63", 0x1E, 63},
+		{"sector shift 7", 0x1E, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildCFB([]byte("hello"))
+			binary.LittleEndian.PutUint16(data[tt.offset:], tt.value)
+			if _, err := openCFB(data); err == nil {
+				t.Error("malformed header accepted")
+			}
+		})
+	}
+}
+
+func TestCFBMiniChainOutOfRange(t *testing.T) {
+	data := buildCFB([]byte("hello"))
+	// Point the stream at a mini sector far past the end of the mini stream
+	binary.LittleEndian.PutUint32(data[2*512+cfbEntrySize+116:], 0xFFFFFF00)
+
+	c, err := openCFB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.read(c.root().child("Data")); err == nil {
+		t.Error("out-of-range mini sector read")
+	}
+}
+
+func TestCFBRepeatedFATSectors(t *testing.T) {
+	data := buildCFB([]byte("hello"))
+	// List the one FAT sector in every header slot and loop the directory
+	// chain onto itself
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(data[0x4C+4*i:], 0)
+	}
+	binary.LittleEndian.PutUint32(data[512+4:], 1)
+
+	if _, err := openCFB(data); err == nil {
+		t.Fatal("cyclic directory chain accepted")
+	}
+
+	binary.LittleEndian.PutUint32(data[512+4:], cfbEndOfChain)
+	c, err := openCFB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.fat) > 128 {
+		t.Errorf("FAT has %d entries for a %d-sector file", len(c.fat), len(data)/512-1)
+	}
+}
+
+func FuzzOpenCFB(f *testing.F) {
+	f.Add(buildCFB([]byte("hello")))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := openCFB(data)
+		if err != nil {
+			return
+		}
+		var walk func(n *cfbNode)
+		walk = func(n *cfbNode) {
+			if !n.storage {
+				c.read(n)
+			}
+			for _, ch := range n.children {
+				walk(ch)
+			}
+		}
+		walk(c.root())
+	})
+}
@@ -0,0 +1,486 @@
+// container.go extracts scannable text from ZIP archives and OOXML documents.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Documents
+// =============================================================================
+
+// document is a unit of scannable text produced by a format handler.
+type document struct {
+	location string   // Position within the container ("" for the file itself)
+	data     []byte   // UTF-8 text, one logical record per line
+	lineRefs []string // Optional per-line sub-locations (e.g. cell references)
+	region   string   // Hidden content region the text came from, if any
+}
+
+// lineLocation returns the full location of a line within the document.
+func (d document) lineLocation(idx int) string {
+	if idx < len(d.lineRefs) && d.lineRefs[idx] != "" {
+		return joinLocation(d.location, d.lineRefs[idx])
+	}
+	return d.location
+}
+
+// joinLocation appends a child to a container location using the
+// "outer!inner" notation (e.g. "book.xlsx!Sheet1!B4").
+func joinLocation(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	if child == "" {
+		return parent
+	}
+	return parent + "!" + child
+}
+
+// =============================================================================
+// ZIP Archives
+// =============================================================================
+
+// scanZip scans an archive, using the OOXML handlers for Office documents
+// and recursing into regular archive entries by content.
+func (e *Extractor) scanZip(file, location string, data []byte, depth scanDepth) []types.SecretMatch {
+	if depth.containers >= config.MaxContainerDepth {
+		return nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil
+	}
+
+	if docs, ok := ooxmlDocuments(zr); ok {
+		var matches []types.SecretMatch
+		for _, doc := range docs {
+			doc.location = joinLocation(location, doc.location)
+			matches = append(matches, e.scanText(file, doc, depth)...)
+		}
+		return append(matches, e.scanOfficeParts(file, location, zr, depth)...)
+	}
+
+	// Encrypted entries are reported once for the archive and scanned
+	// alongside the others once opened
+	var matches []types.SecretMatch
+	if container, ok := zipEncryption(zr); ok {
+		matches = e.scanProtected(file, location, container, depth)
+	}
+
+	depth.containers++
+
+	// Zipped working copies and bare repositories are scanned as history
+	names := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		names[i] = f.Name
+	}
+	gitDirs := zipGitDirs(zr, names)
+
+	for _, dir := range gitDirs {
+		if sub, err := fs.Sub(zr, dir); err == nil {
+			found, _ := e.scanGitRepo(file, joinLocation(location, dir), sub, depth)
+			matches = append(matches, found...)
+		}
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || f.Flags&zipFlagEncrypted != 0 || f.UncompressedSize64 > config.MaxFileSizeForScan || inGitDir(f.Name, gitDirs) {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			continue
+		}
+
+		matches = append(matches, e.scanContent(file, f.Name, joinLocation(location, f.Name), content, depth)...)
+	}
+	return matches
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, config.MaxFileSizeForScan))
+}
+
+func readZipEntry(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return readZipFile(f)
+		}
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+// =============================================================================
+// OOXML (docx/xlsx/pptx)
+// =============================================================================
+
+// ooxmlDocuments extracts text from an Office Open XML package, including
+// its document properties. It returns false when the archive is not a
+// recognized Office document.
+func ooxmlDocuments(zr *zip.Reader) ([]document, bool) {
+	if _, err := readZipEntry(zr, "[Content_Types].xml"); err != nil {
+		return nil, false
+	}
+
+	var docs []document
+	switch {
+	case hasZipEntry(zr, "xl/workbook.xml"):
+		docs = xlsxDocuments(zr)
+	case hasZipEntry(zr, "word/document.xml"):
+		docs = docxDocuments(zr)
+	case hasZipEntry(zr, "ppt/presentation.xml"):
+		docs = pptxDocuments(zr)
+	default:
+		return nil, false
+	}
+
+	if props, ok := docProperties(zr); ok {
+		docs = append(docs, props)
+	}
+	return docs, true
+}
+
+func hasZipEntry(zr *zip.Reader, name string) bool {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// xlsxDocuments returns one document per worksheet with a line per
+// non-empty cell, located as "Sheet!A1", plus the worksheets' comments and
+// the workbook's defined names. Hidden sheets carry their region.
+func xlsxDocuments(zr *zip.Reader) []document {
+	shared := xlsxSharedStrings(zr)
+	var docs []document
+
+	for _, sheet := range xlsxSheets(zr) {
+		data, err := readZipEntry(zr, sheet.path)
+		if err != nil {
+			continue
+		}
+
+		if doc, ok := cellDocument(sheet.name, xlsxCells(data, shared)); ok {
+			doc.region = xlsxSheetRegion(sheet.state)
+			docs = append(docs, doc)
+		}
+		docs = append(docs, xlsxComments(zr, sheet)...)
+	}
+
+	if names, ok := xlsxDefinedNames(zr); ok {
+		docs = append(docs, names)
+	}
+	return docs
+}
+
+type xlsxSheet struct {
+	name  string
+	path  string
+	state string // "", "hidden" or "veryHidden"
+}
+
+// xlsxSheets resolves worksheet names to their part paths via the
+// workbook relationships.
+func xlsxSheets(zr *zip.Reader) []xlsxSheet {
+	rels := partRels(zr, "xl/workbook.xml")
+
+	data, err := readZipEntry(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil
+	}
+
+	var wb struct {
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			State string     `xml:"state,attr"`
+			Attr  []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(data, &wb); err != nil {
+		return nil
+	}
+
+	var sheets []xlsxSheet
+	for i, s := range wb.Sheets {
+		target := ""
+		for _, a := range s.Attr {
+			if a.Name.Local == "id" {
+				target = rels[a.Value].target
+			}
+		}
+		if target == "" {
+			target = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		sheets = append(sheets, xlsxSheet{name: s.Name, path: target, state: s.State})
+	}
+	return sheets
+}
+
+// xlsxSharedStrings reads the shared string table, concatenating rich text
+// runs and ignoring phonetic hints.
+func xlsxSharedStrings(zr *zip.Reader) []string {
+	data, err := readZipEntry(zr, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil
+	}
+
+	var strs []string
+	var cur strings.Builder
+	inText, inPhonetic := false, false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "rPh":
+				inPhonetic = true
+			case "t":
+				inText = !inPhonetic
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, cur.String())
+			case "rPh":
+				inPhonetic = false
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	return strs
+}
+
+type xlsxCell struct {
+	ref   string
+	value string
+}
+
+// xlsxCells returns the non-empty cell values of a worksheet part.
+func xlsxCells(data []byte, shared []string) []xlsxCell {
+	var cells []xlsxCell
+	var ref, typ string
+	var val strings.Builder
+	inValue := false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "c":
+				ref, typ = xmlAttr(t, "r"), xmlAttr(t, "t")
+				val.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "c":
+				v := val.String()
+				if typ == "s" {
+					if idx, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && idx >= 0 && idx < len(shared) {
+						v = shared[idx]
+					}
+				}
+				if strings.TrimSpace(v) != "" {
+					cells = append(cells, xlsxCell{ref: ref, value: v})
+				}
+			case "v", "t":
+				inValue = false
+			}
+		case xml.CharData:
+			if inValue {
+				val.Write(t)
+			}
+		}
+	}
+	return cells
+}
+
+// docxDocuments returns the body, headers, footers, notes and comments of
+// a Word document, one line per paragraph. Tracked deletions and hidden
+// text are returned as separate documents carrying their region.
+func docxDocuments(zr *zip.Reader) []document {
+	var docs []document
+	for _, name := range sortedEntries(zr, "word/", ".xml") {
+		base := path.Base(name)
+		if base != "document.xml" && !strings.HasPrefix(base, "header") && !strings.HasPrefix(base, "footer") &&
+			base != "footnotes.xml" && base != "endnotes.xml" && base != "comments.xml" {
+			continue
+		}
+
+		data, err := readZipEntry(zr, name)
+		if err != nil {
+			continue
+		}
+
+		location := ""
+		if base != "document.xml" {
+			location = strings.TrimSuffix(base, ".xml")
+		}
+		region := ""
+		if base == "comments.xml" {
+			region = regionComment
+		}
+
+		visible, deleted, hidden := docxText(data)
+		for _, d := range []document{
+			{location: location, data: visible, region: region},
+			{location: location, data: deleted, region: regionTrackedDeletion},
+			{location: location, data: hidden, region: regionHiddenText},
+		} {
+			if len(d.data) > 0 {
+				docs = append(docs, d)
+			}
+		}
+	}
+	return docs
+}
+
+// pptxDocuments returns slide, speaker-note and comment text located as
+// "Slide N". Hidden slides carry their region.
+func pptxDocuments(zr *zip.Reader) []document {
+	var docs []document
+	for _, dir := range []struct{ prefix, label string }{
+		{"ppt/slides/slide", "Slide"},
+		{"ppt/notesSlides/notesSlide", "Notes"},
+	} {
+		for _, name := range sortedEntries(zr, dir.prefix, ".xml") {
+			data, err := readZipEntry(zr, name)
+			if err != nil {
+				continue
+			}
+
+			num := strings.TrimSuffix(strings.TrimPrefix(name, dir.prefix), ".xml")
+			if text := xmlParagraphs(data); len(text) > 0 {
+				doc := document{location: dir.label + " " + num, data: text}
+				if dir.label == "Slide" && pptxHidden(data) {
+					doc.region = regionHiddenSlide
+				}
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return append(docs, pptxComments(zr)...)
+}
+
+// xmlParagraphs flattens WordprocessingML or DrawingML text, emitting one
+// line per paragraph (<w:p>/<a:p>) from its text runs (<w:t>/<a:t>).
+func xmlParagraphs(data []byte) []byte {
+	var buf bytes.Buffer
+	var para strings.Builder
+	inText := false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte('\t')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if s := strings.TrimSpace(para.String()); s != "" {
+					buf.WriteString(s)
+					buf.WriteByte('\n')
+				}
+				para.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+func xmlAttr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// resolvePartPath resolves a relationship target relative to its source
+// part directory, handling package-absolute targets.
+func resolvePartPath(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Clean(path.Join(dir, target))
+}
+
+// sortedEntries lists archive entries with the given prefix and suffix in
+// natural order, so "slide10.xml" follows "slide9.xml".
+func sortedEntries(zr *zip.Reader, prefix, suffix string) []string {
+	var names []string
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, prefix) && strings.HasSuffix(f.Name, suffix) {
+			names = append(names, f.Name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
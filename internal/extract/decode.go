@@ -0,0 +1,143 @@
+// decode.go finds base64, URL- and hex-encoded segments in text, decodes
+// them and rescans the result, so secrets hidden one layer down (Kubernetes
+// secrets, -EncodedCommand PowerShell, escaped connection strings) are found.
+package extract
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Encoded Segments
+// =============================================================================
+
+// encoding recognizes and decodes one kind of encoded segment.
+type encoding struct {
+	name   string
+	regex  *regexp.Regexp
+	decode func(segment string) ([]byte, bool)
+}
+
+var encodings = []encoding{
+	{
+		name:   "base64",
+		regex:  regexp.MustCompile(`[A-Za-z0-9+/_\-]{24,}={0,2}`),
+		decode: decodeBase64,
+	},
+	{
+		name:  "url",
+		regex: regexp.MustCompile(`(?:[A-Za-z0-9._~+\-=&]*%[0-9A-Fa-f]{2}){3,}[A-Za-z0-9._~+\-=&%]*`),
+		decode: func(segment string) ([]byte, bool) {
+			s, err := url.QueryUnescape(segment)
+			return []byte(s), err == nil
+		},
+	},
+	{
+		name:  "hex",
+		regex: regexp.MustCompile(`(?:[0-9A-Fa-f]{2}[ :]?){16,}`),
+		decode: func(segment string) ([]byte, bool) {
+			clean := strings.NewReplacer(" ", "", ":", "").Replace(segment)
+			b, err := hex.DecodeString(clean)
+			return b, err == nil
+		},
+	},
+}
+
+// decodeBase64 accepts standard and URL-safe alphabets, padded or not.
+// Pure hex runs are left to the hex decoder.
+func decodeBase64(segment string) ([]byte, bool) {
+	if isHexString(strings.TrimRight(segment, "=")) {
+		return nil, false
+	}
+
+	raw := strings.TrimRight(segment, "=")
+	for _, enc := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(raw); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// =============================================================================
+// Rescanning
+// =============================================================================
+
+// scanEncoded decodes every encoded segment in the document and rescans the
+// output through the normal content routing, so decoded text, archives and
+// key material are all handled. Matches are attributed to the line of the
+// encoded segment, with the lines around it as context lines, and record
+// the decoding chain. Context keeps the decoded line.
+func (e *Extractor) scanEncoded(file string, doc document, depth scanDepth) []types.SecretMatch {
+	if depth.decodes >= config.MaxDecodeDepth {
+		return nil
+	}
+	depth.decodes++
+
+	lines := lineOffsets(doc.data)
+	budget := config.MaxDecodedSegments
+
+	var matches []types.SecretMatch
+	for _, enc := range encodings {
+		for _, loc := range enc.regex.FindAllIndex(doc.data, -1) {
+			if budget == 0 {
+				return matches
+			}
+
+			segment := string(doc.data[loc[0]:loc[1]])
+			decoded, ok := enc.decode(segment)
+			if !ok || len(decoded) == 0 || len(decoded) > config.MaxDecodedSize {
+				continue
+			}
+
+			// Only keep decodings that produce something scannable
+			switch sniffKind("", decoded) {
+			case kindEmpty, kindBinary:
+				continue
+			}
+			budget--
+
+			step := enc.name
+			if isUTF16Text(decoded) {
+				step += "/utf-16"
+			}
+
+			i := lineIndex(lines, loc[0])
+			location := doc.lineLocation(i)
+			found := e.scanContent(file, "", location, decoded, depth)
+
+			for j := range found {
+				m := &found[j]
+				m.DecodeChain = append([]string{step}, m.DecodeChain...)
+				if len(m.DecodeChain) == 1 || m.Location == location {
+					m.Line = i + 1
+					m.Column = utf8.RuneCount(doc.data[lines[i]:loc[0]]) + 1
+					if len(m.ContextLines) > 0 {
+						m.ContextLines, _ = e.contextLines(doc.data, lines, i, Finding{Start: loc[0] - lines[i], End: loc[1] - lines[i]})
+					}
+				}
+			}
+			matches = append(matches, found...)
+		}
+	}
+
+	return matches
+}
+
+func isHexString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package extract
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/loosehose/azonk/internal/config"
+)
+
+func TestScanEncodedColumn(t *testing.T) {
+	e := NewExtractor()
+
+	// Base64 of "password = Winter2024!" after a non-ASCII prefix: the
+	// column counts characters, not bytes
+	data := []byte("first line\nrésumé ñ: cGFzc3dvcmQgPSBXaW50ZXIyMDI0IQ==\n")
+	found := e.scanEncoded("test", document{data: data}, scanDepth{})
+	if len(found) == 0 {
+		t.Fatal("no finding in the decoded segment")
+	}
+	for _, m := range found {
+		if m.Line != 2 || m.Column != 11 {
+			t.Errorf("%s at %d:%d, want 2:11", m.PatternName, m.Line, m.Column)
+		}
+	}
+}
+
+func b64(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+// decodedSecrets returns the decode chains of findings holding secret.
+func decodedSecrets(t *testing.T, data, secret string) [][]string {
+	t.Helper()
+	var chains [][]string
+	for _, m := range NewExtractor().scanEncoded("test", document{data: []byte(data)}, scanDepth{}) {
+		if strings.Contains(m.Context, secret) {
+			chains = append(chains, m.DecodeChain)
+		}
+	}
+	return chains
+}
+
+func TestScanEncodedChain(t *testing.T) {
+	const secret = "password = Winter2024!"
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"base64", "token: " + b64(secret), "[[base64]]"},
+		{"base64 url-safe unpadded", "token: " + strings.TrimRight(base64.URLEncoding.EncodeToString([]byte(secret+"??>")), "="), "[[base64]]"},
+		{"url", "q=" + url.PathEscape(secret), "[[url]]"},
+		{"hex", "blob " + hex.EncodeToString([]byte(secret)), "[[hex]]"},
+		{"hex with separators", "blob " + hexBytes(secret, ":"), "[[hex]]"},
+		{"hex in base64", b64(hex.EncodeToString([]byte(secret))), "[[base64 hex]]"},
+		{"url in base64", b64("conn=" + url.PathEscape(secret)), "[[base64 url]]"},
+		{"base64 in base64", b64(b64(secret)), "[[base64 base64]]"},
+		{"utf-16", "-EncodedCommand " + base64.StdEncoding.EncodeToString(utf16le(secret)), "[[base64/utf-16]]"},
+		{"plain text ignored", secret, "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(decodedSecrets(t, tt.data, "Winter2024!")); got != tt.want {
+				t.Errorf("decode chains %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanEncodedDepthLimit(t *testing.T) {
+	layered := "password = Winter2024!"
+	for depth := 1; depth <= config.MaxDecodeDepth+1; depth++ {
+		layered = b64(layered)
+		chains := decodedSecrets(t, layered, "Winter2024!")
+		if want := depth <= config.MaxDecodeDepth; (len(chains) > 0) != want {
+			t.Errorf("%d layers of base64: found %v, want found %v", depth, chains, want)
+		}
+		if len(chains) > 0 && len(chains[0]) != depth {
+			t.Errorf("%d layers of base64: chain %v", depth, chains[0])
+		}
+	}
+}
+
+func TestScanEncodedSegmentLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < config.MaxDecodedSegments; i++ {
+		fmt.Fprintf(&b, "%s\n", b64(fmt.Sprintf("nothing to see in segment %d", i)))
+	}
+	filler := b.String()
+	secret := b64("password = Winter2024!") + "\n"
+
+	if chains := decodedSecrets(t, secret+filler, "Winter2024!"); len(chains) != 1 {
+		t.Errorf("secret before the limit: found %v", chains)
+	}
+	if chains := decodedSecrets(t, filler+secret, "Winter2024!"); len(chains) != 0 {
+		t.Errorf("secret past %d segments decoded: %v", config.MaxDecodedSegments, chains)
+	}
+}
+
+func TestScanEncodedLineNumbers(t *testing.T) {
+	e := NewExtractor()
+
+	// The decoded text has the secret on its third line; the finding is
+	// reported on the encoded segment's line of the outer document
+	encoded := b64("[db]\nhost = db01\npassword = Winter2024!\n")
+	data := "one\ntwo\nsecret: " + encoded + "\nfour\nfive\nsix\n"
+	found := e.scanEncoded("test", document{data: []byte(data)}, scanDepth{})
+	if len(found) == 0 {
+		t.Fatal("no finding in the decoded segment")
+	}
+
+	for _, m := range found {
+		if m.Line != 3 {
+			t.Errorf("%s on line %d, want 3", m.PatternName, m.Line)
+		}
+		if !strings.Contains(m.Context, "Winter2024!") {
+			t.Errorf("context %q does not show the decoded line", m.Context)
+		}
+
+		var numbers []int
+		hit := 0
+		for _, line := range m.ContextLines {
+			numbers = append(numbers, line.Number)
+			if line.Match {
+				hit = line.Number
+				if got := []rune(line.Text)[line.MatchStart:line.MatchEnd]; string(got) != encoded {
+					t.Errorf("context line marks %q, want the encoded segment", string(got))
+				}
+			}
+		}
+		if fmt.Sprint(numbers) != "[1 2 3 4 5]" || hit != m.Line {
+			t.Errorf("context lines %v with match on %d, want [1 2 3 4 5] on %d", numbers, hit, m.Line)
+		}
+	}
+}
+
+// hexBytes hex-encodes s with sep between bytes, as hex dumps do.
+func hexBytes(s, sep string) string {
+	parts := make([]string, len(s))
+	for i := 0; i < len(s); i++ {
+		parts[i] = hex.EncodeToString([]byte{s[i]})
+	}
+	return strings.Join(parts, sep)
+}
+
+func utf16le(s string) []byte {
+	var out []byte
+	for _, r := range s {
+		out = append(out, byte(r), byte(r>>8))
+	}
+	return out
+}
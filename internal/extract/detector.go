@@ -0,0 +1,139 @@
+// detector.go defines the Detector plugin interface and the regex-based
+// implementation used by the built-in patterns.
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Detector Interface
+// =============================================================================
+
+// Detector finds secrets in text. Implementations are registered with
+// Extractor.Register and must be safe for concurrent use, as files are
+// scanned in parallel.
+type Detector interface {
+	// Name identifies the detector in findings (e.g. "AWS Access Key").
+	Name() string
+
+	// Keywords returns literals, one of which must appear in a region for
+	// Detect to be called. Matching is ASCII case-insensitive. Return nil
+	// to have Detect called on every region.
+	Keywords() []string
+
+	// Detect scans a candidate region and returns its findings.
+	Detect(region Region) []Finding
+}
+
+// Rule is optionally implemented by detectors to describe their findings
+// in reports. Findings from detectors without it are rated medium.
+type Rule interface {
+	Description() string
+	Severity() types.Severity
+}
+
+// Region is a span of text handed to a Detector, currently one line.
+type Region struct {
+	Data   []byte // Text to scan, without the trailing newline
+	Source string // Logical source, e.g. "/path/book.xlsx!Sheet1!B4"
+	Line   int    // 1-based line number of Data within the source
+	Offset int    // Byte offset of Data within the source
+}
+
+// Finding is a single detector hit. Start and End are byte offsets into
+// Region.Data.
+type Finding struct {
+	Match  string
+	Start  int
+	End    int
+	Secret string // Optional bare password, tried against protected key files
+}
+
+// =============================================================================
+// Regex Detector
+// =============================================================================
+
+// RegexDetector reports every match of a regular expression.
+type RegexDetector struct {
+	name        string
+	severity    types.Severity
+	description string
+	keywords    []string
+	regex       *regexp.Regexp
+}
+
+// NewRegexDetector compiles expr into a detector. Keywords should be
+// literals implied by expr so the prefilter never hides a real match.
+func NewRegexDetector(name string, keywords []string, expr string) (*RegexDetector, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("compile %s: %w", name, err)
+	}
+
+	lowered := make([]string, len(keywords))
+	for i, k := range keywords {
+		lowered[i] = strings.ToLower(k)
+	}
+
+	return &RegexDetector{name: name, keywords: lowered, regex: re}, nil
+}
+
+// Name returns the detector name.
+func (d *RegexDetector) Name() string {
+	return d.name
+}
+
+// Description returns what the detector looks for.
+func (d *RegexDetector) Description() string {
+	return d.description
+}
+
+// Severity returns the severity of the detector's findings.
+func (d *RegexDetector) Severity() types.Severity {
+	if d.severity == "" {
+		return types.SeverityMedium
+	}
+	return d.severity
+}
+
+// WithRule sets the severity and description reported for the detector's
+// findings and returns the detector.
+func (d *RegexDetector) WithRule(severity types.Severity, description string) *RegexDetector {
+	d.severity = severity
+	d.description = description
+	return d
+}
+
+// Keywords returns the prefilter literals.
+func (d *RegexDetector) Keywords() []string {
+	return d.keywords
+}
+
+// Detect returns every non-overlapping match in the region. A named
+// group "secret" in the expression populates Finding.Secret.
+func (d *RegexDetector) Detect(region Region) []Finding {
+	secretGroup := d.regex.SubexpIndex("secret")
+
+	var findings []Finding
+	for _, loc := range d.regex.FindAllSubmatchIndex(region.Data, -1) {
+		if loc[1] == loc[0] {
+			continue
+		}
+
+		f := Finding{
+			Match: string(region.Data[loc[0]:loc[1]]),
+			Start: loc[0],
+			End:   loc[1],
+		}
+		if secretGroup > 0 && loc[2*secretGroup] >= 0 {
+			f.Secret = string(region.Data[loc[2*secretGroup]:loc[2*secretGroup+1]])
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
@@ -1,67 +1,88 @@
-// Package extract provides secret detection via regex pattern matching.
+// Package extract provides secret detection via pluggable detectors, with
+// regex pattern matching as the built-in implementation.
 package extract
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/output"
 	"github.com/loosehose/azonk/internal/types"
 	"github.com/loosehose/azonk/internal/ui"
 )
 
 // =============================================================================
-// Secret Patterns
+// Built-in Detectors
 // =============================================================================
 
-type pattern struct {
-	name  string
-	regex *regexp.Regexp
-}
-
-func secretPatterns() []pattern {
-	return []pattern{
+// builtinDetectors returns the regex detectors registered by NewExtractor.
+// Keywords are lowercase literals, at least one of which must appear on a
+// line for the regex to be worth running. A "secret" group marks the
+// password itself so it can be tried against protected key files.
+func builtinDetectors() []Detector {
+	return []Detector{
 		// Azure/Microsoft
-		{name: "Azure Client Secret", regex: regexp.MustCompile(`(?i)(client[_-]?secret|clientsecret)["'\s:=]+([A-Za-z0-9~._\-]{30,})`)},
-		{name: "Azure Tenant/App ID", regex: regexp.MustCompile(`(?i)(tenant[_-]?id|app[_-]?id|client[_-]?id|application[_-]?id)["'\s:=]+([a-f0-9\-]{36})`)},
-		{name: "Azure Storage Key", regex: regexp.MustCompile(`(?i)(account[_-]?key|storage[_-]?key)["'\s:=]+([A-Za-z0-9+/=]{60,})`)},
-		{name: "Azure SAS Token", regex: regexp.MustCompile(`(\?sv=.+&sig=[A-Za-z0-9%]+)`)},
+		&RegexDetector{name: "Azure Client Secret", severity: types.SeverityCritical, description: "Client secret for an Entra ID application registration", keywords: []string{"secret"}, regex: regexp.MustCompile(`(?i)(client[_-]?secret|clientsecret)["'\s:=]+([A-Za-z0-9~._\-]{30,})`)},
+		&RegexDetector{name: "Azure Tenant/App ID", severity: types.SeverityLow, description: "Entra ID tenant or application identifier, useful for targeting", keywords: []string{"tenant", "app", "client"}, regex: regexp.MustCompile(`(?i)(tenant[_-]?id|app[_-]?id|client[_-]?id|application[_-]?id)["'\s:=]+([a-f0-9\-]{36})`)},
+		&RegexDetector{name: "Azure Storage Key", severity: types.SeverityCritical, description: "Azure Storage account access key", keywords: []string{"account", "storage"}, regex: regexp.MustCompile(`(?i)(account[_-]?key|storage[_-]?key)["'\s:=]+([A-Za-z0-9+/=]{60,})`)},
+		&RegexDetector{name: "Azure SAS Token", severity: types.SeverityHigh, description: "Azure Storage shared access signature", keywords: []string{"sig="}, regex: regexp.MustCompile(`(\?sv=.+&sig=[A-Za-z0-9%]+)`)},
+		&RegexDetector{name: "Entra App Secret", severity: types.SeverityCritical, description: "Entra ID application client secret in the current format", keywords: []string{"q~"}, regex: regexp.MustCompile(`\b[A-Za-z0-9_~.\-]{3}\dQ~[A-Za-z0-9_~.\-]{31,34}`)},
+		&RegexDetector{name: "Azure DevOps PAT", severity: types.SeverityCritical, description: "Azure DevOps personal access token", keywords: []string{"azdo"}, regex: regexp.MustCompile(`\b[A-Za-z0-9]{52}JQQJ99[A-Za-z0-9]{18}AZDO[A-Za-z0-9]{4}\b`)},
+		&RegexDetector{name: "Azure DevOps PAT (Legacy)", severity: types.SeverityHigh, description: "Azure DevOps personal access token in the legacy format", keywords: []string{"devops", "ado", "vsts", "pat", "personal"}, regex: regexp.MustCompile(`(?i)(azure[_-]?devops|ado|vsts|pat|personal[_-]?access[_-]?token)[_-]?(token)?["'\s:=]+([a-z2-7]{52})\b`)},
+		&RegexDetector{name: "Azure Function Key", severity: types.SeverityHigh, description: "Azure Functions access key", keywords: []string{"x-functions-key", "azurewebsites"}, regex: regexp.MustCompile(`(?i)(x-functions-key["'\s:=]+[A-Za-z0-9_\-]{30,}={0,2}|\.azurewebsites\.net/api/[^\s"'?]+\?([^\s"']*&)?code=[A-Za-z0-9_\-]{30,}={0,2})`)},
+		&RegexDetector{name: "Logic App/Power Automate URL", severity: types.SeverityHigh, description: "Logic App or Power Automate trigger URL with its signature", keywords: []string{"sig="}, regex: regexp.MustCompile(`(?i)https://[a-z0-9\-.]+\.(logic\.azure\.com|api\.powerplatform\.com)(:443)?/[^\s"']*workflows/[^\s"']*[?&]sig=[A-Za-z0-9_\-%]{20,}`)},
+		&RegexDetector{name: "Azure Service Bus/Event Hub Key", severity: types.SeverityCritical, description: "Service Bus or Event Hubs connection string with a shared access key", keywords: []string{"sharedaccesskey"}, regex: regexp.MustCompile(`(?i)Endpoint=sb://[^;\s]+;SharedAccessKeyName=[^;\s]+;SharedAccessKey=[A-Za-z0-9+/=]{40,}`)},
+		&RegexDetector{name: "Azure IoT Hub Key", severity: types.SeverityCritical, description: "IoT Hub connection string with a shared access key", keywords: []string{"sharedaccesskey"}, regex: regexp.MustCompile(`(?i)HostName=[^;\s]+\.azure-devices\.net;(DeviceId|SharedAccessKeyName)=[^;\s]+;SharedAccessKey=[A-Za-z0-9+/=]{40,}`)},
+		&RegexDetector{name: "Azure Cosmos DB Key", severity: types.SeverityCritical, description: "Cosmos DB connection string with an account key", keywords: []string{"accountkey"}, regex: regexp.MustCompile(`(?i)AccountEndpoint=https://[^;\s]+\.documents\.azure\.com[^;\s]*;AccountKey=[A-Za-z0-9+/=]{80,}`)},
+		&RegexDetector{name: "Azure SQL Connection", severity: types.SeverityCritical, description: "Azure SQL connection string with a password", keywords: []string{"database.windows.net"}, regex: regexp.MustCompile(`(?i)Server=(tcp:)?[^;\s]+\.database\.windows\.net[^\n]*?;\s*(Password|Pwd)=(?P<secret>[^;\n]+)`)},
+		&RegexDetector{name: "Azure Redis Connection", severity: types.SeverityCritical, description: "Azure Cache for Redis connection string with an access key", keywords: []string{"redis.cache"}, regex: regexp.MustCompile(`(?i)[a-z0-9\-]+\.redis\.cache\.windows\.net:\d+,[^\n]*?password=(?P<secret>[^,\s"']+)`)},
+		&RegexDetector{name: "Azure App Configuration", severity: types.SeverityCritical, description: "App Configuration connection string with a secret", keywords: []string{"azconfig"}, regex: regexp.MustCompile(`(?i)Endpoint=https://[a-z0-9\-]+\.azconfig\.io;Id=[^;\s]+;Secret=[A-Za-z0-9+/=]{40,}`)},
+		&RegexDetector{name: "Azure Container Registry Password", severity: types.SeverityCritical, description: "Azure Container Registry admin or token password", keywords: []string{"+acr", "password"}, regex: regexp.MustCompile(`(\b[A-Za-z0-9+/]{42}\+ACR[A-Za-z0-9]{6}\b|(?i)(acr|registry)[_-]?password["'\s:=]+[A-Za-z0-9+/=]{32,})`)},
+		&RegexDetector{name: "Teams Incoming Webhook", severity: types.SeverityMedium, description: "Teams incoming webhook URL that allows posting to a channel", keywords: []string{"webhook.office"}, regex: regexp.MustCompile(`(?i)https://[a-z0-9\-]+\.webhook\.office\.com/webhookb2/[a-z0-9@\-]+/IncomingWebhook/[a-z0-9]+/[a-z0-9\-]+`)},
+		&RegexDetector{name: "Azure Key Vault Secret URI", severity: types.SeverityLow, description: "Reference to a Key Vault secret", keywords: []string{"vault.azure.net"}, regex: regexp.MustCompile(`(?i)https://[a-z0-9\-]{3,24}\.vault\.azure\.net/secrets/[a-z0-9\-]+(/[a-f0-9]{32})?`)},
 
 		// Generic Credentials
-		{name: "Password", regex: regexp.MustCompile(`(?i)(password|passwd|pwd)["'\s:=]+([^\s"',\]\}]{4,50})`)},
-		{name: "API Key", regex: regexp.MustCompile(`(?i)(api[_-]?key|apikey)["'\s:=]+([A-Za-z0-9_\-]{16,})`)},
-		{name: "Generic Secret", regex: regexp.MustCompile(`(?i)(secret[_-]?id|secret[_-]?key)["'\s:=]+([^\s"',]{8,})`)},
-		{name: "Bearer Token", regex: regexp.MustCompile(`(?i)(bearer|authorization)["'\s:=]+(eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+)`)},
+		&RegexDetector{name: "Password", severity: types.SeverityHigh, description: "Password assigned to a password-like key", keywords: []string{"pass", "pwd"}, regex: regexp.MustCompile(`(?i)(password|passwd|pwd)["'\s:=]+(?P<secret>[^\s"',\]\}]{4,50})`)},
+		&RegexDetector{name: "API Key", severity: types.SeverityHigh, description: "API key assigned to an api_key-like key", keywords: []string{"api"}, regex: regexp.MustCompile(`(?i)(api[_-]?key|apikey)["'\s:=]+([A-Za-z0-9_\-]{16,})`)},
+		&RegexDetector{name: "Generic Secret", severity: types.SeverityHigh, description: "Secret assigned to a secret_key-like key", keywords: []string{"secret"}, regex: regexp.MustCompile(`(?i)(secret[_-]?id|secret[_-]?key)["'\s:=]+([^\s"',]{8,})`)},
+		&RegexDetector{name: "Bearer Token", severity: types.SeverityHigh, description: "JWT bearer token", keywords: []string{"bearer", "authorization"}, regex: regexp.MustCompile(`(?i)(bearer|authorization)["'\s:=]+(eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+)`)},
 
 		// Connection Strings
-		{name: "Connection String", regex: regexp.MustCompile(`(?i)(connection[_-]?string|connstring|connectionstring)["'\s:=]+([^"'\n]{20,})`)},
-		{name: "SQL Connection", regex: regexp.MustCompile(`(?i)Server=.+;.*(Password|Pwd)=([^;]+)`)},
+		&RegexDetector{name: "Connection String", severity: types.SeverityHigh, description: "Connection string assigned to a connection_string-like key", keywords: []string{"conn"}, regex: regexp.MustCompile(`(?i)(connection[_-]?string|connstring|connectionstring)["'\s:=]+([^"'\n]{20,})`)},
+		&RegexDetector{name: "SQL Connection", severity: types.SeverityHigh, description: "SQL Server connection string with a password", keywords: []string{"server="}, regex: regexp.MustCompile(`(?i)Server=.+;.*(Password|Pwd)=(?P<secret>[^;]+)`)},
 
 		// Private Keys
-		{name: "Private Key", regex: regexp.MustCompile(`-----BEGIN (RSA |EC |OPENSSH )?PRIVATE KEY-----`)},
-		{name: "PFX/PKCS12", regex: regexp.MustCompile(`(?i)(\.pfx|\.p12|pkcs12)["'\s:=]+([^\s"',]+)`)},
+		&RegexDetector{name: "Private Key", severity: types.SeverityCritical, description: "PEM private key header", keywords: []string{"private key"}, regex: regexp.MustCompile(`-----BEGIN (RSA |EC |OPENSSH )?PRIVATE KEY-----`)},
+		&RegexDetector{name: "PFX/PKCS12", severity: types.SeverityMedium, description: "Reference to a PKCS#12 key store", keywords: []string{".pfx", ".p12", "pkcs12"}, regex: regexp.MustCompile(`(?i)(\.pfx|\.p12|pkcs12)["'\s:=]+([^\s"',]+)`)},
 
 		// AWS
-		{name: "AWS Access Key", regex: regexp.MustCompile(`AKIA[0-9A-Z]{16}`)},
-		{name: "AWS Secret Key", regex: regexp.MustCompile(`(?i)(aws[_-]?secret|secret[_-]?access[_-]?key)["'\s:=]+([A-Za-z0-9/+=]{40})`)},
+		&RegexDetector{name: "AWS Access Key", severity: types.SeverityCritical, description: "AWS access key ID", keywords: []string{"akia"}, regex: regexp.MustCompile(`AKIA[0-9A-Z]{16}`)},
+		&RegexDetector{name: "AWS Secret Key", severity: types.SeverityCritical, description: "AWS secret access key", keywords: []string{"secret"}, regex: regexp.MustCompile(`(?i)(aws[_-]?secret|secret[_-]?access[_-]?key)["'\s:=]+([A-Za-z0-9/+=]{40})`)},
 
 		// GCP
-		{name: "GCP API Key", regex: regexp.MustCompile(`AIza[0-9A-Za-z\-_]{35}`)},
-		{name: "GCP Service Account", regex: regexp.MustCompile(`"type"\s*:\s*"service_account"`)},
+		&RegexDetector{name: "GCP API Key", severity: types.SeverityHigh, description: "Google Cloud API key", keywords: []string{"aiza"}, regex: regexp.MustCompile(`AIza[0-9A-Za-z\-_]{35}`)},
+		&RegexDetector{name: "GCP Service Account", severity: types.SeverityHigh, description: "Google Cloud service account key file", keywords: []string{"service_account"}, regex: regexp.MustCompile(`"type"\s*:\s*"service_account"`)},
 
 		// GitHub/GitLab
-		{name: "GitHub Token", regex: regexp.MustCompile(`gh[pousr]_[A-Za-z0-9_]{36,}`)},
-		{name: "GitLab Token", regex: regexp.MustCompile(`glpat-[A-Za-z0-9\-]{20,}`)},
+		&RegexDetector{name: "GitHub Token", severity: types.SeverityCritical, description: "GitHub access token", keywords: []string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_"}, regex: regexp.MustCompile(`gh[pousr]_[A-Za-z0-9_]{36,}`)},
+		&RegexDetector{name: "GitLab Token", severity: types.SeverityCritical, description: "GitLab personal access token", keywords: []string{"glpat-"}, regex: regexp.MustCompile(`glpat-[A-Za-z0-9\-]{20,}`)},
 
 		// Slack
-		{name: "Slack Token", regex: regexp.MustCompile(`xox[baprs]-[0-9]{10,13}-[0-9]{10,13}[a-zA-Z0-9-]*`)},
+		&RegexDetector{name: "Slack Token", severity: types.SeverityHigh, description: "Slack API token", keywords: []string{"xox"}, regex: regexp.MustCompile(`xox[baprs]-[0-9]{10,13}-[0-9]{10,13}[a-zA-Z0-9-]*`)},
 
 		// Stripe
-		{name: "Stripe Key", regex: regexp.MustCompile(`sk_live_[0-9a-zA-Z]{24,}`)},
+		&RegexDetector{name: "Stripe Key", severity: types.SeverityCritical, description: "Stripe live secret key", keywords: []string{"sk_live_"}, regex: regexp.MustCompile(`sk_live_[0-9a-zA-Z]{24,}`)},
 	}
 }
 
@@ -69,81 +90,188 @@ func secretPatterns() []pattern {
 // Extractor
 // =============================================================================
 
+// Extractor scans content for secrets. Register detectors before scanning;
+// scanning itself is safe for concurrent use.
 type Extractor struct {
-	patterns []pattern
+	detectors []Detector
+	filter    *prefilter
+	workers   int
+	passwords *passwordPool
+	supplied  []string // Passwords given through AddPasswords
+
+	contextBefore int
+	contextAfter  int
+	contextWidth  int
+
+	openProtected bool
+	languages     map[string]bool // Language packs with a registered detector
 }
 
+// NewExtractor creates an Extractor with the built-in detectors and a
+// worker pool sized to the number of CPUs.
 func NewExtractor() *Extractor {
-	return &Extractor{patterns: secretPatterns()}
+	e := &Extractor{
+		workers:   runtime.NumCPU(),
+		passwords: newPasswordPool(config.DefaultKeyPasswords()),
+
+		contextBefore: config.DefaultContextLines,
+		contextAfter:  config.DefaultContextLines,
+		contextWidth:  config.DefaultContextWidth,
+	}
+	e.Register(builtinDetectors()...)
+	return e
+}
+
+// Register adds detectors to the extractor, e.g. Go-coded detectors
+// supplied by code embedding the extractor.
+func (e *Extractor) Register(detectors ...Detector) {
+	e.detectors = append(e.detectors, detectors...)
+
+	keywords := make([][]string, len(e.detectors))
+	for i, d := range e.detectors {
+		keywords[i] = d.Keywords()
+	}
+	e.filter = newPrefilter(keywords)
+}
+
+// Detectors returns the registered detectors in registration order.
+func (e *Extractor) Detectors() []Detector {
+	return append([]Detector(nil), e.detectors...)
+}
+
+// Rules describes every registered detector, plus the key material and
+// protected container findings, for reports that list rules alongside
+// results.
+func (e *Extractor) Rules() []types.RuleInfo {
+	rules := make([]types.RuleInfo, 0, len(e.detectors)+5)
+	for _, d := range e.detectors {
+		rule := types.RuleInfo{Name: d.Name(), Severity: severityOf(d)}
+		if r, ok := d.(Rule); ok {
+			rule.Description = r.Description()
+		}
+		rules = append(rules, rule)
+	}
+	rules = append(rules, keyMaterialRules()...)
+	return append(rules, protectionRules()...)
+}
+
+// SetWorkers sets how many files are scanned concurrently.
+func (e *Extractor) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	e.workers = n
+}
+
+// SetContext sets how many lines before and after each finding are kept as
+// context and how many characters of each line are kept. A width of zero
+// keeps lines whole.
+func (e *Extractor) SetContext(before, after, width int) {
+	e.contextBefore = max(before, 0)
+	e.contextAfter = max(after, 0)
+	e.contextWidth = max(width, 0)
 }
 
 // =============================================================================
 // Scanning Methods
 // =============================================================================
 
+// ScanFile scans a single file, deciding by content whether it is text,
+// a supported container, or binary that should be skipped. Given a git
+// directory, it scans the repository's history.
 func (e *Extractor) ScanFile(filePath string) ([]types.SecretMatch, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
+	pending := &pendingSet{}
+	matches, _, err := e.scanFile(filePath, pending)
 
-	var matches []types.SecretMatch
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
+	results := [][]types.SecretMatch{matches}
+	recovered := e.retryPending(results, pending)
+	return append(results[0], recovered...), err
+}
 
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
+// ScanReader scans content read from r, such as a network stream or a
+// mailbox dump piped from another tool. The name stands in for the file
+// path in findings and is used as the filename hint when sniffing.
+func (e *Extractor) ScanReader(r io.Reader, name string) ([]types.SecretMatch, error) {
+	results, errs := e.ScanReaders(1, func(int) (io.Reader, string, error) {
+		return r, name, nil
+	})
+	return results[0], errs[0]
+}
 
-		for _, p := range e.patterns {
-			if p.regex.MatchString(line) {
-				matches = append(matches, types.SecretMatch{
-					File:        filePath,
-					Line:        lineNum,
-					PatternName: p.name,
-					Match:       p.regex.FindString(line),
-					Context:     truncateContext(line, 100),
-				})
-			}
+// ScanReaders scans n streams in turn, such as messages fetched one at a
+// time. open returns the i-th stream and its name, or an error to skip it.
+// Passwords found in any stream are retried against the key stores and
+// containers of every other once all are scanned. Matches and errors are
+// returned in stream order.
+func (e *Extractor) ScanReaders(n int, open func(i int) (io.Reader, string, error)) ([][]types.SecretMatch, []error) {
+	pending := &pendingSet{}
+	results := make([][]types.SecretMatch, n)
+	errs := make([]error, n)
+	names := make([]string, n)
+
+	for i := 0; i < n; i++ {
+		r, name, err := open(i)
+		if err == nil {
+			results[i], _, err = e.scanStream(r, name, pending)
 		}
+		names[i], errs[i] = name, err
+	}
+
+	// Passwords found in later streams may open key stores seen earlier
+	placeRecovered(results, names, e.retryPending(results, pending))
+	return results, errs
+}
+
+// ScanStdin scans standard input under a logical name for use in shell
+// pipelines, e.g. curl ... | azonk extract --stdin --name web.config.
+func (e *Extractor) ScanStdin(name string) ([]types.SecretMatch, error) {
+	if name == "" {
+		name = config.StdinName
+	}
+	ui.Info("Scanning standard input as %s", name)
+
+	matches, err := e.ScanReader(os.Stdin, name)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
 	}
 
-	return matches, scanner.Err()
+	ui.Success("Scan complete: %d potential secrets found", len(matches))
+	return matches, nil
 }
 
+// ScanDirectory recursively scans every regular file under dirPath.
 func (e *Extractor) ScanDirectory(dirPath string) ([]types.SecretMatch, error) {
 	ui.Info("Scanning for secrets: %s", dirPath)
 
-	var allMatches []types.SecretMatch
-	scannableExts := config.ScannableExtensions()
-
+	var paths []string
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
+		if err != nil {
 			return nil
 		}
 
-		if info.Size() > config.MaxFileSizeForScan {
+		// Git directories are scanned as history rather than as files
+		if info.IsDir() {
+			if isGitDir(os.DirFS(path)) {
+				paths = append(paths, path)
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		if !scannableExts[strings.ToLower(filepath.Ext(path))] {
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
-		matches, err := e.ScanFile(path)
-		if err != nil {
+		if info.Size() > config.MaxFileSizeForScan {
 			return nil
 		}
 
-		if len(matches) > 0 {
-			ui.Warning("Found %d secrets in %s", len(matches), filepath.Base(path))
-			allMatches = append(allMatches, matches...)
-		}
-
+		paths = append(paths, path)
 		return nil
 	})
 
+	allMatches := flatten(e.scanFiles(paths, nil))
+
 	if err != nil {
 		return allMatches, err
 	}
@@ -152,35 +280,363 @@ func (e *Extractor) ScanDirectory(dirPath string) ([]types.SecretMatch, error) {
 	return allMatches, nil
 }
 
+// ScanDownloadedFiles scans downloaded files, tagging each match with the
+// SharePoint item it came from.
 func (e *Extractor) ScanDownloadedFiles(downloads []types.DownloadedFile) []types.SecretMatch {
 	ui.Info("Scanning %d files for secrets...", len(downloads))
 
-	var allMatches []types.SecretMatch
+	paths := make([]string, len(downloads))
+	for i, dl := range downloads {
+		paths[i] = dl.LocalPath
+	}
 
-	for _, dl := range downloads {
-		matches, err := e.ScanFile(dl.LocalPath)
-		if err != nil {
+	results := e.scanFiles(paths, func(idx int, matches []types.SecretMatch) {
+		item := downloads[idx].SourceItem
+		for i := range matches {
+			matches[i].SourceItem = item.Name
+			// Findings recovered without their file's scan have none yet
+			if matches[i].Provenance == nil {
+				matches[i].Provenance = &types.Provenance{LocalPath: downloads[idx].LocalPath}
+			}
+			matches[i].Provenance.FromDriveItem(item)
+		}
+	})
+
+	allMatches := flatten(results)
+	ui.Success("Extracted %d potential secrets", len(allMatches))
+	return allMatches
+}
+
+// snippetLocation is the location given to findings in search snippets.
+const snippetLocation = "search snippet"
+
+// ScanSnippets runs the detectors over the hit-highlighted snippets search
+// returned with each item, so hits can be triaged before anything is
+// downloaded. A snippet is a fragment of the file: a clean snippet says
+// nothing about the rest of it.
+func (e *Extractor) ScanSnippets(items []types.DriveItem) []types.SecretMatch {
+	depth := scanDepth{pending: &pendingSet{}}
+	var results [][]types.SecretMatch
+	for _, item := range items {
+		text := item.SnippetText()
+		if strings.TrimSpace(text) == "" {
 			continue
 		}
 
+		matches := e.scanText(item.Name, document{location: snippetLocation, data: []byte(text)}, depth)
+		if len(matches) == 0 {
+			continue
+		}
+		prov := &types.Provenance{}
+		prov.FromDriveItem(item)
 		for i := range matches {
-			matches[i].SourceItem = dl.SourceItem.Name
+			matches[i].SourceItem = item.Name
+			matches[i].Provenance = prov
 		}
+		results = append(results, matches)
+	}
 
-		if len(matches) > 0 {
-			ui.Warning("Found %d secrets in %s", len(matches), filepath.Base(dl.LocalPath))
-			allMatches = append(allMatches, matches...)
+	// Passwords in later snippets may open keys quoted in earlier ones
+	recovered := e.retryPending(results, depth.pending)
+	return append(flatten(results), recovered...)
+}
+
+// ScanListItem scans the column values of a SharePoint list item, one line
+// per column written as "Column: value" and located by column name. Rich
+// text columns are flattened from HTML first.
+func (e *Extractor) ScanListItem(item types.DriveItem, fields map[string]string) []types.SecretMatch {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	var refs []string
+	for _, name := range names {
+		value := fields[name]
+		if strings.HasPrefix(strings.TrimSpace(value), "<") {
+			value = string(htmlToText([]byte(value)))
 		}
+		buf.WriteString(name + ": " + strings.Join(strings.Fields(value), " "))
+		buf.WriteByte('\n')
+		refs = append(refs, name)
 	}
 
-	ui.Success("Extracted %d potential secrets", len(allMatches))
-	return allMatches
+	matches := e.scanText(item.Name, document{data: buf.Bytes(), lineRefs: refs}, scanDepth{})
+	if len(matches) == 0 {
+		return nil
+	}
+	prov := &types.Provenance{}
+	prov.FromDriveItem(item)
+	for i := range matches {
+		matches[i].SourceItem = item.Name
+		matches[i].Provenance = prov
+	}
+	return matches
+}
+
+// ScanChatMessage scans the body of a Teams message, flattening HTML first.
+// Findings are grouped under the chat or channel and located by message ID.
+func (e *Extractor) ScanChatMessage(msg types.ChatMessage, content string) []types.SecretMatch {
+	data := []byte(content)
+	if strings.HasPrefix(strings.TrimSpace(content), "<") {
+		data = htmlToText(data)
+	}
+
+	file := msg.Conversation()
+	matches := e.scanText(file, document{location: "message " + msg.ID, data: data}, scanDepth{})
+	for i := range matches {
+		matches[i].SourceItem = file
+		matches[i].Chat = &msg
+		matches[i].Provenance = &types.Provenance{Name: file, WebURL: msg.WebURL, Query: msg.MatchedOn}
+	}
+	return matches
+}
+
+// scanFile reads and scans one file, returning the number of bytes read.
+// Findings carry the file's local path and SHA-256 as provenance. A git
+// directory is scanned as history.
+func (e *Extractor) scanFile(filePath string, pending *pendingSet) ([]types.SecretMatch, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		return e.scanGitDir(filePath, pending)
+	}
+
+	matches, n, err := e.scanStream(file, filePath, pending)
+	if len(matches) > 0 {
+		matches[0].Provenance.LocalPath = filePath // Shared by all matches
+	}
+	return matches, n, err
+}
+
+// scanStream sniffs and scans content read from r, returning the number of
+// bytes read. Protected content it cannot open is collected in pending.
+func (e *Extractor) scanStream(r io.Reader, name string, pending *pendingSet) ([]types.SecretMatch, int64, error) {
+	s, err := readStream(r, name)
+	if err != nil {
+		return nil, s.bytes, err
+	}
+	return e.scanRead(name, s, scanDepth{pending: pending}), s.bytes, nil
+}
+
+// streamContent is content read by readStream.
+type streamContent struct {
+	data   []byte // Nil when sniffed as empty or binary
+	bytes  int64  // Bytes read
+	sha256 string // Hash of data
+	prefix bool   // The stream continued past MaxFileSizeForScan
+}
+
+// readStream reads content from r for scanning, stopping after the sniff
+// sample when it is empty or binary. Content past MaxFileSizeForScan is
+// neither read nor hashed, so the hash of a longer stream covers a prefix.
+func readStream(r io.Reader, name string) (streamContent, error) {
+	sample := make([]byte, config.SniffSampleSize)
+	n, err := io.ReadFull(r, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return streamContent{}, err
+	}
+	sample = sample[:n]
+
+	switch sniffKind(name, sample) {
+	case kindEmpty, kindBinary:
+		return streamContent{bytes: int64(n)}, nil
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(r, config.MaxFileSizeForScan-int64(n)))
+	if err != nil {
+		return streamContent{bytes: int64(n)}, err
+	}
+
+	data := append(sample, rest...)
+	s := streamContent{data: data, bytes: int64(len(data))}
+	if s.bytes >= config.MaxFileSizeForScan {
+		var probe [1]byte
+		n, err := io.ReadFull(r, probe[:])
+		if err != nil && err != io.EOF {
+			return s, err
+		}
+		s.prefix = n > 0
+	}
+
+	sum := sha256.Sum256(data)
+	s.sha256 = hex.EncodeToString(sum[:])
+	return s, nil
+}
+
+// scanRead scans content read by readStream. Findings carry its SHA-256 as
+// provenance.
+func (e *Extractor) scanRead(name string, s streamContent, depth scanDepth) []types.SecretMatch {
+	if s.data == nil {
+		return nil
+	}
+	matches := e.scanContent(name, name, "", s.data, depth)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	prov := &types.Provenance{SHA256: s.sha256, SHA256Prefix: s.prefix}
+	for i := range matches {
+		matches[i].Provenance = prov
+	}
+	return matches
+}
+
+// =============================================================================
+// Content Routing
+// =============================================================================
+
+// scanDepth tracks how far a scan has recursed into containers and into
+// encoded blobs; each is limited separately. It also carries the scan's
+// pending set, which a nil pointer discards, and optionally collects the
+// passwords the scan finds.
+type scanDepth struct {
+	containers int
+	decodes    int
+	pending    *pendingSet
+	harvest    *[]string
+}
+
+// scanContent routes content to the handler for its sniffed kind. The name
+// is used for filename hints and location is the position of the content
+// within file (empty for the file itself).
+func (e *Extractor) scanContent(file, name, location string, data []byte, depth scanDepth) []types.SecretMatch {
+	switch sniffKind(name, data) {
+	case kindText:
+		return e.scanText(file, document{location: location, data: decodeText(data)}, depth)
+	case kindDER:
+		return e.scanKeyMaterial(file, location, data, depth.pending)
+	case kindZip:
+		return e.scanZip(file, location, data, depth)
+	case kindMail:
+		return e.scanMail(file, location, data, depth)
+	case kindOLE:
+		return e.scanOLE(file, location, data, depth)
+	case kindKeePass:
+		return e.scanKeePass(file, location, data, depth)
+	}
+	return nil
+}
+
+// scanText runs the detectors over a text document, then analyzes any PEM
+// key material and rescans encoded segments once decoded. Findings derived
+// from a hidden region carry its tag.
+func (e *Extractor) scanText(file string, doc document, depth scanDepth) []types.SecretMatch {
+	matches := e.scanDocument(file, doc, depth.harvest)
+
+	var derived []types.SecretMatch
+	if bytes.Contains(doc.data, []byte("-----BEGIN ")) {
+		derived = e.scanKeyMaterial(file, doc.location, doc.data, depth.pending)
+	}
+	derived = append(derived, e.scanEncoded(file, doc, depth)...)
+	tagRegion(derived, doc.region)
+
+	return append(matches, derived...)
+}
+
+// scanDocument prefilters the document for detector keywords in one pass,
+// then runs each candidate detector only on the lines it hit. Secrets
+// found are added to the password pool and, when set, to harvest.
+func (e *Extractor) scanDocument(file string, doc document, harvest *[]string) []types.SecretMatch {
+	lines := lineOffsets(doc.data)
+
+	// Candidate detectors per line, as bitsets indexed by detector
+	words := (len(e.detectors) + 63) / 64
+	candidates := make(map[int][]uint64)
+	e.filter.scan(doc.data, func(end int, detectors []int) {
+		line := lineIndex(lines, end-1)
+		bits := candidates[line]
+		if bits == nil {
+			bits = make([]uint64, words)
+			candidates[line] = bits
+		}
+		for _, idx := range detectors {
+			bits[idx/64] |= 1 << (idx % 64)
+		}
+	})
+
+	if len(e.filter.always) > 0 {
+		for i := range lines {
+			if candidates[i] == nil {
+				candidates[i] = make([]uint64, words)
+			}
+			for _, idx := range e.filter.always {
+				candidates[i][idx/64] |= 1 << (idx % 64)
+			}
+		}
+	}
+
+	hitLines := make([]int, 0, len(candidates))
+	for i := range candidates {
+		hitLines = append(hitLines, i)
+	}
+	sort.Ints(hitLines)
+
+	var matches []types.SecretMatch
+	for _, i := range hitLines {
+		location := doc.lineLocation(i)
+		region := Region{
+			Data:   bytes.TrimSuffix(lineAt(doc.data, lines, i), []byte("\r")),
+			Source: joinLocation(file, location),
+			Line:   i + 1,
+			Offset: lines[i],
+		}
+		bits := candidates[i]
+
+		for idx, d := range e.detectors {
+			if bits[idx/64]&(1<<(idx%64)) == 0 {
+				continue
+			}
+
+			severity := severityOf(d)
+			if doc.region != "" {
+				severity = raiseSeverity(severity)
+			}
+
+			for _, f := range d.Detect(region) {
+				if f.Secret != "" {
+					e.passwords.add(f.Secret)
+					if harvest != nil {
+						*harvest = append(*harvest, f.Secret)
+					}
+				}
+				context, hit := e.contextLines(doc.data, lines, i, f)
+				matches = append(matches, types.SecretMatch{
+					File:         file,
+					Location:     location,
+					Line:         region.Line,
+					Column:       utf8.RuneCount(region.Data[:f.Start]) + 1,
+					PatternName:  d.Name(),
+					Severity:     severity,
+					Region:       doc.region,
+					Match:        f.Match,
+					Context:      strings.TrimSpace(context[hit].Text),
+					ContextLines: context,
+				})
+			}
+		}
+	}
+
+	return matches
 }
 
 // =============================================================================
 // Output Methods
 // =============================================================================
 
+// SaveSARIF writes matches to path as SARIF 2.1.0, with a rule for every
+// registered detector. Extraction, sweep, stdin and hunt results all export
+// through it.
+func (e *Extractor) SaveSARIF(path string, matches []types.SecretMatch) error {
+	return output.WriteSARIF(path, e.Rules(), matches)
+}
+
 func (e *Extractor) PrintMatches(matches []types.SecretMatch) {
 	if len(matches) == 0 {
 		return
@@ -196,21 +652,152 @@ func (e *Extractor) PrintMatches(matches []types.SecretMatch) {
 	for file, fileMatches := range byFile {
 		fmt.Printf("  %s\n", filepath.Base(file))
 		for _, m := range fileMatches {
-			ui.Critical("[%s] Line %d", m.PatternName, m.Line)
-			fmt.Printf("      %s\n", ui.Dim(m.Context))
+			where := fmt.Sprintf("Line %d", m.Line)
+			if m.Location != "" {
+				where = m.Location
+			}
+			if len(m.DecodeChain) > 0 {
+				where += " (decoded: " + strings.Join(m.DecodeChain, " → ") + ")"
+			}
+			if m.Region != "" {
+				where += " [" + m.Region + "]"
+			}
+			if c := m.Commit; c != nil {
+				where += fmt.Sprintf(" (commit %.7s by %s, %s)", c.Hash, c.Author, c.Date)
+			}
+			if mail := m.Mail; mail != nil {
+				where += fmt.Sprintf(" (from %s to %s, %s)", mail.From, strings.Join(mail.To, ", "), mail.Received)
+			}
+			if chat := m.Chat; chat != nil {
+				where += " (from " + chat.From
+				if chat.Created != "" {
+					where += ", " + chat.Created
+				}
+				where += ")"
+			}
+			ui.Critical("[%s] %s", m.PatternName, where)
+			if len(m.ContextLines) == 0 {
+				fmt.Printf("      %s\n", ui.Dim(m.Context))
+				continue
+			}
+			for _, line := range m.ContextLines {
+				printContextLine(line)
+			}
 		}
 		fmt.Println()
 	}
 }
 
+// printContextLine prints one numbered context line, highlighting the
+// matched span on the match line.
+func printContextLine(line types.ContextLine) {
+	marker := " "
+	if line.Match {
+		marker = ">"
+	}
+	fmt.Printf("    %s %s ", marker, ui.Dim(fmt.Sprintf("%4d", line.Number)))
+
+	if !line.Match {
+		fmt.Println(ui.Dim(line.Text))
+		return
+	}
+	text := []rune(line.Text)
+	start, end := min(line.MatchStart, len(text)), min(line.MatchEnd, len(text))
+	fmt.Println(ui.Dim(string(text[:start])) + ui.Highlight(string(text[start:end])) + ui.Dim(string(text[end:])))
+}
+
 // =============================================================================
 // Helpers
 // =============================================================================
 
-func truncateContext(s string, max int) string {
-	s = strings.TrimSpace(s)
-	if len(s) <= max {
-		return s
+// severityOf returns the severity a detector reports, defaulting to medium.
+func severityOf(d Detector) types.Severity {
+	if r, ok := d.(Rule); ok {
+		return r.Severity()
+	}
+	return types.SeverityMedium
+}
+
+// lineOffsets returns the byte offset at which each line starts.
+func lineOffsets(data []byte) []int {
+	offsets := []int{0}
+	for i, c := range data {
+		if c == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+// lineIndex returns the zero-based line containing byte offset pos.
+func lineIndex(offsets []int, pos int) int {
+	return sort.SearchInts(offsets, pos+1) - 1
+}
+
+// lineAt returns line i without its trailing newline.
+func lineAt(data []byte, offsets []int, i int) []byte {
+	end := len(data)
+	if i+1 < len(offsets) {
+		end = offsets[i+1] - 1
+	}
+	return data[offsets[i]:end]
+}
+
+// contextLines returns the configured lines around line i, with the span
+// of finding f marked on line i, and the index of that line.
+func (e *Extractor) contextLines(data []byte, offsets []int, i int, f Finding) ([]types.ContextLine, int) {
+	first := max(i-e.contextBefore, 0)
+	last := min(i+e.contextAfter, len(offsets)-1)
+	if last > i && offsets[last] == len(data) {
+		last-- // Nothing follows the final newline
+	}
+
+	context := make([]types.ContextLine, 0, last-first+1)
+	for j := first; j <= last; j++ {
+		text := []rune(string(bytes.TrimSuffix(lineAt(data, offsets, j), []byte("\r"))))
+		start, end := 0, 0
+		if j == i {
+			start = utf8.RuneCount(data[offsets[i] : offsets[i]+f.Start])
+			end = start + utf8.RuneCount(data[offsets[i]+f.Start:offsets[i]+f.End])
+		}
+
+		line := clipLine(text, start, end, e.contextWidth)
+		line.Number = j + 1
+		line.Match = j == i
+		if !line.Match {
+			line.MatchStart, line.MatchEnd = 0, 0
+		}
+		context = append(context, line)
+	}
+	return context, i - first
+}
+
+// clipLine cuts text to at most width characters (plus "..." markers),
+// keeping the window centred on the span [start, end) so the match stays
+// visible. Offsets in the result are adjusted to the clipped text.
+func clipLine(text []rune, start, end, width int) types.ContextLine {
+	if width <= 0 || len(text) <= width {
+		return types.ContextLine{Text: string(text), MatchStart: start, MatchEnd: end}
+	}
+
+	from := max(start-max(width-(end-start), 0)/2, 0)
+	to := min(from+width, len(text))
+	from = max(to-width, 0)
+
+	var b strings.Builder
+	prefix := 0
+	if from > 0 {
+		b.WriteString("...")
+		prefix = 3
+	}
+	b.WriteString(string(text[from:to]))
+	if to < len(text) {
+		b.WriteString("...")
+	}
+
+	return types.ContextLine{
+		Text:       b.String(),
+		MatchStart: min(start, to) - from + prefix,
+		MatchEnd:   min(end, to) - from + prefix,
 	}
-	return s[:max] + "..."
 }
@@ -0,0 +1,89 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// zipOf builds a ZIP archive from name/content pairs, in order.
+func zipOf(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanReaderRetriesOwnPending(t *testing.T) {
+	e := NewExtractor()
+	key := readPKCS12Fixture(t, "pkcs8.pem")
+
+	// Another scan in progress holds a locked key of its own
+	other := &pendingSet{}
+	if _, _, err := e.scanStream(bytes.NewReader(key), "other.pem", other); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key comes before the password that opens it
+	archive := zipOf(t, "key.pem", string(key), "notes.txt", "password = "+pkcs12Password)
+	matches, err := e.ScanReader(bytes.NewReader(archive), "bundle.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opened bool
+	for _, m := range matches {
+		if km := m.KeyMaterial; km != nil {
+			opened = km.Opened && km.Password == pkcs12Password
+		}
+	}
+	if !opened {
+		t.Error("key in the archive not opened by the password after it")
+	}
+	if len(other.keys) != 1 {
+		t.Errorf("other scan's pending keys = %d, want 1", len(other.keys))
+	}
+}
+
+func TestScanReadersRetriesAcrossStreams(t *testing.T) {
+	defer silenceStdout(t)()
+
+	e := NewExtractor()
+	e.SetOpenProtected(true)
+
+	// The archive arrives before the message holding its password
+	streams := []string{string(readProtectedFixture(t, "zipcrypto.zip")), "password = " + protectedPassword}
+	results, errs := e.ScanReaders(len(streams)+1, func(i int) (io.Reader, string, error) {
+		if i == len(streams) {
+			return nil, "", errors.New("fetch failed")
+		}
+		return strings.NewReader(streams[i]), fmt.Sprintf("message%d.eml", i), nil
+	})
+
+	var secret bool
+	for _, m := range results[0] {
+		if strings.Contains(m.Match, protectedSecret) {
+			secret = m.File == "message0.eml"
+		}
+	}
+	if !secret {
+		t.Error("archive not opened by the password in the next stream")
+	}
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Errorf("errors = %v, want only the last stream failed", errs)
+	}
+}
@@ -0,0 +1,427 @@
+// git.go scans git history: every commit reachable from the repository's
+// refs is diffed against its parent and the lines it added are scanned, so
+// secrets removed from HEAD are still found.
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Repository Detection
+// =============================================================================
+
+// isGitDir reports whether fsys is a git directory: a working copy's .git
+// or a bare repository.
+func isGitDir(fsys fs.FS) bool {
+	head, err := fs.Stat(fsys, "HEAD")
+	if err != nil || head.IsDir() {
+		return false
+	}
+	objects, err := fs.Stat(fsys, "objects")
+	return err == nil && objects.IsDir()
+}
+
+// zipGitDirs returns the directories of an archive that hold git
+// repositories, e.g. "project/.git" or "backup.git".
+func zipGitDirs(fsys fs.FS, names []string) []string {
+	var dirs []string
+	for _, name := range names {
+		if path.Base(name) != "HEAD" {
+			continue
+		}
+		dir := path.Dir(name)
+		sub, err := fs.Sub(fsys, dir)
+		if err == nil && isGitDir(sub) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// inGitDir reports whether an archive entry lies inside one of dirs.
+func inGitDir(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// History Scanning
+// =============================================================================
+
+// scanGitDir scans the history of a git directory on disk.
+func (e *Extractor) scanGitDir(dirPath string, pending *pendingSet) ([]types.SecretMatch, int64, error) {
+	matches, n := e.scanGitRepo(dirPath, "", os.DirFS(dirPath), scanDepth{pending: pending})
+	if len(matches) > 0 {
+		prov := &types.Provenance{LocalPath: dirPath}
+		for i := range matches {
+			matches[i].Provenance = prov
+		}
+	}
+	return matches, n, nil
+}
+
+// scanGitRepo walks the commits reachable from every ref, newest first,
+// and scans the lines each commit added relative to its first parent, so
+// a merge reports what it brought in from the merged branches, including
+// conflict resolutions. The repository config is scanned too, as remote
+// URLs often embed credentials. It returns the pack bytes read.
+func (e *Extractor) scanGitRepo(file, location string, fsys fs.FS, depth scanDepth) ([]types.SecretMatch, int64) {
+	if depth.containers >= config.MaxContainerDepth {
+		return nil, 0
+	}
+	depth.containers++
+
+	var matches []types.SecretMatch
+	if data, err := fs.ReadFile(fsys, "config"); err == nil {
+		matches = e.scanText(file, document{location: joinLocation(location, "config"), data: data}, depth)
+	}
+
+	store := openGitStore(fsys)
+	queue := gitRefs(fsys, store)
+	seen := make(map[gitHash]bool)
+	diffed := make(map[[2]gitHash]bool)
+
+	for len(queue) > 0 && len(seen) < config.MaxGitCommits {
+		h := queue[0]
+		queue = queue[1:]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+
+		commit, err := readGitCommit(store, h)
+		if err != nil {
+			continue
+		}
+		queue = append(queue, commit.parents...)
+
+		var parentTree gitHash
+		if len(commit.parents) > 0 {
+			if parent, err := readGitCommit(store, commit.parents[0]); err == nil {
+				parentTree = parent.tree
+			}
+		}
+
+		var changes []gitChange
+		diffGitTrees(store, parentTree, commit.tree, "", make(map[[2]gitHash]bool), &changes)
+		for _, c := range changes {
+			// Cherry-picks and rebased copies make the same change twice
+			if diffed[[2]gitHash{c.old, c.new}] {
+				continue
+			}
+			diffed[[2]gitHash{c.old, c.new}] = true
+
+			ref := commit.info.Hash[:7] + ":" + c.path
+			found := e.scanGitChange(file, joinLocation(location, ref), store, c, depth)
+			for i := range found {
+				info := commit.info
+				info.Path = c.path
+				found[i].Commit = &info
+			}
+			matches = append(matches, found...)
+		}
+	}
+
+	return matches, store.bytes
+}
+
+// scanGitChange scans the lines a change added, locating findings as
+// "<short hash>:<path>" within the repository. Binary files are only
+// scanned when newly added, through the normal content routing, so key
+// files and archives committed to the repository are analyzed.
+func (e *Extractor) scanGitChange(file, location string, store *gitStore, c gitChange, depth scanDepth) []types.SecretMatch {
+	kind, data, err := store.read(c.new)
+	if err != nil || kind != gitBlob {
+		return nil
+	}
+
+	if sniffKind(c.path, data) != kindText {
+		if c.old != (gitHash{}) {
+			return nil
+		}
+		return e.scanContent(file, c.path, location, data, depth)
+	}
+
+	var old []byte
+	if c.old != (gitHash{}) {
+		if _, oldData, err := store.read(c.old); err == nil {
+			old = decodeText(oldData)
+		}
+	}
+
+	text := decodeText(data)
+	added := addedLines(old, text)
+	if len(added) == 0 {
+		return nil
+	}
+
+	var matches []types.SecretMatch
+	for _, m := range e.scanText(file, document{location: location, data: text}, depth) {
+		if added[m.Line] {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// addedLines returns the 1-based numbers of lines in text that are not in
+// old. Lines are compared as a multiset, so moved lines are not reported.
+func addedLines(old, text []byte) map[int]bool {
+	counts := make(map[string]int)
+	for _, line := range bytes.Split(old, []byte("\n")) {
+		counts[string(line)]++
+	}
+
+	added := make(map[int]bool)
+	for i, line := range bytes.Split(text, []byte("\n")) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			continue
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			added[i+1] = true
+		}
+	}
+	return added
+}
+
+// =============================================================================
+// Refs
+// =============================================================================
+
+// gitRefs resolves HEAD, loose refs and packed refs to commits, following
+// annotated tags. HEAD comes first, so its history is scanned first.
+func gitRefs(fsys fs.FS, store *gitStore) []gitHash {
+	var names []string
+	if data, err := fs.ReadFile(fsys, "HEAD"); err == nil {
+		names = append(names, strings.TrimSpace(string(data)))
+	}
+
+	fs.WalkDir(fsys, "refs", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if data, err := fs.ReadFile(fsys, p); err == nil {
+				names = append(names, strings.TrimSpace(string(data)))
+			}
+		}
+		return nil
+	})
+
+	if data, err := fs.ReadFile(fsys, "packed-refs"); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" || line[0] == '#' || line[0] == '^' {
+				continue
+			}
+			if hash, _, ok := strings.Cut(line, " "); ok {
+				names = append(names, hash)
+			}
+		}
+	}
+
+	var tips []gitHash
+	seen := make(map[gitHash]bool)
+	for _, name := range names {
+		// Symbolic refs point at refs already collected
+		if strings.HasPrefix(name, "ref: ") {
+			continue
+		}
+		h, ok := parseGitHash(name)
+		if !ok {
+			continue
+		}
+		if h = peelGitTag(store, h); !seen[h] {
+			seen[h] = true
+			tips = append(tips, h)
+		}
+	}
+	return tips
+}
+
+// peelGitTag follows annotated tags to the object they tag.
+func peelGitTag(store *gitStore, h gitHash) gitHash {
+	for i := 0; i < 8; i++ {
+		kind, data, err := store.read(h)
+		if err != nil || kind != gitTag {
+			return h
+		}
+		target, ok := gitHeader(data, "object")
+		if !ok {
+			return h
+		}
+		if h, ok = parseGitHash(target); !ok {
+			return h
+		}
+	}
+	return h
+}
+
+// =============================================================================
+// Commits and Trees
+// =============================================================================
+
+type gitCommitObject struct {
+	tree    gitHash
+	parents []gitHash
+	info    types.GitCommit
+}
+
+// readGitCommit parses the headers and subject line of a commit.
+func readGitCommit(store *gitStore, h gitHash) (*gitCommitObject, error) {
+	kind, data, err := store.read(h)
+	if err != nil {
+		return nil, err
+	}
+	if kind != gitCommit {
+		return nil, fmt.Errorf("%s is a %s, not a commit", h, gitTypeName(kind))
+	}
+
+	c := &gitCommitObject{info: types.GitCommit{Hash: h.String()}}
+	headers, message, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree":
+			c.tree, _ = parseGitHash(value)
+		case "parent":
+			if p, ok := parseGitHash(value); ok {
+				c.parents = append(c.parents, p)
+			}
+		case "author":
+			c.info.Author, c.info.Email, c.info.Date = parseGitSignature(value)
+		}
+	}
+
+	subject, _, _ := bytes.Cut(message, []byte("\n"))
+	c.info.Subject = strings.TrimSpace(string(subject))
+	return c, nil
+}
+
+// parseGitSignature splits "Name <email> 1700000000 +0100" into the name,
+// email and an RFC 3339 date in the author's time zone.
+func parseGitSignature(s string) (string, string, string) {
+	lt, gt := strings.IndexByte(s, '<'), strings.LastIndexByte(s, '>')
+	if lt < 0 || gt < lt {
+		return s, "", ""
+	}
+	name, email := strings.TrimSpace(s[:lt]), s[lt+1:gt]
+
+	fields := strings.Fields(s[gt+1:])
+	if len(fields) != 2 {
+		return name, email, ""
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return name, email, ""
+	}
+	zone := time.UTC
+	if tz, err := strconv.Atoi(fields[1]); err == nil {
+		offset := (tz/100*60 + tz%100) * 60
+		zone = time.FixedZone(fields[1], offset)
+	}
+	return name, email, time.Unix(secs, 0).In(zone).Format(time.RFC3339)
+}
+
+// gitHeader returns the value of the first header line with key.
+func gitHeader(data []byte, key string) (string, bool) {
+	headers, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+type gitTreeEntry struct {
+	name string
+	dir  bool
+	hash gitHash
+}
+
+// readGitTree parses a tree into its entries, skipping symlinks and
+// submodules. A zero hash reads as an empty tree.
+func readGitTree(store *gitStore, h gitHash) []gitTreeEntry {
+	if h == (gitHash{}) {
+		return nil
+	}
+	kind, data, err := store.read(h)
+	if err != nil || kind != gitTree {
+		return nil
+	}
+
+	var entries []gitTreeEntry
+	for len(data) > 0 {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp < 0 || nul < sp || nul+21 > len(data) {
+			break
+		}
+		mode := string(data[:sp])
+		entry := gitTreeEntry{name: string(data[sp+1 : nul]), dir: mode == "40000"}
+		copy(entry.hash[:], data[nul+1:nul+21])
+		data = data[nul+21:]
+
+		if entry.dir || strings.HasPrefix(mode, "100") {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// gitChange is a file added or modified by a commit.
+type gitChange struct {
+	path string
+	old  gitHash // Zero for added files
+	new  gitHash
+}
+
+// diffGitTrees appends the files added or modified between two trees,
+// skipping subtrees whose hashes are unchanged. Object hashes are not
+// verified, so a tree may list itself; visited holds the pairs of trees
+// already compared, which bounds cycles and subtrees shared many times.
+func diffGitTrees(store *gitStore, oldTree, newTree gitHash, prefix string, visited map[[2]gitHash]bool, changes *[]gitChange) {
+	if oldTree == newTree || visited[[2]gitHash{oldTree, newTree}] {
+		return
+	}
+	visited[[2]gitHash{oldTree, newTree}] = true
+
+	old := make(map[string]gitTreeEntry)
+	for _, entry := range readGitTree(store, oldTree) {
+		old[entry.name] = entry
+	}
+
+	for _, entry := range readGitTree(store, newTree) {
+		prev, existed := old[entry.name]
+		entryPath := path.Join(prefix, entry.name)
+
+		switch {
+		case entry.dir:
+			var prevTree gitHash
+			if existed && prev.dir {
+				prevTree = prev.hash
+			}
+			diffGitTrees(store, prevTree, entry.hash, entryPath, visited, changes)
+		case !existed || prev.dir:
+			*changes = append(*changes, gitChange{path: entryPath, new: entry.hash})
+		case prev.hash != entry.hash:
+			*changes = append(*changes, gitChange{path: entryPath, old: prev.hash, new: entry.hash})
+		}
+	}
+}
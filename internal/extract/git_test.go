@@ -0,0 +1,153 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// gitRun runs git in dir with a fixed identity, returning its trimmed output.
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestScanGitMergeCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	defer silenceStdout(t)()
+
+	repo := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitRun(t, repo, "init", "-q")
+	write("app.config", "server = db01\n")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-qm", "initial")
+	gitRun(t, repo, "checkout", "-qb", "feature")
+	write("feature.txt", "feature work\n")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-qm", "feature")
+	gitRun(t, repo, "checkout", "-q", "main")
+	write("main.txt", "main work\n")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-qm", "main")
+
+	// The secret is only added while resolving the merge
+	gitRun(t, repo, "merge", "-q", "--no-commit", "feature")
+	write("app.config", "server = db01\npassword = Winter2024!\n")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-qm", "merge feature")
+	merge := gitRun(t, repo, "rev-parse", "HEAD")
+
+	matches, err := NewExtractor().ScanFile(filepath.Join(repo, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, m := range matches {
+		if m.Commit != nil && m.Commit.Hash == merge && m.Commit.Path == "app.config" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("secret added by merge commit %.7s not found in %d matches", merge, len(matches))
+	}
+}
+
+func TestGitPackDeltaLoop(t *testing.T) {
+	var a, b gitHash
+	a[0], b[0] = 1, 2
+
+	// Two ref deltas, each based on the other
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte{0, 0})
+	zw.Close()
+
+	data := []byte("PACK\x00\x00\x00\x02\x00\x00\x00\x02")
+	offsets := make(map[gitHash]int64)
+	for _, obj := range []struct{ self, base gitHash }{{a, b}, {b, a}} {
+		offsets[obj.self] = int64(len(data))
+		data = append(data, gitRefDelta<<4|2)
+		data = append(data, obj.base[:]...)
+		data = append(data, z.Bytes()...)
+	}
+
+	s := &gitStore{packs: []*gitPack{{data: data, offsets: offsets, cache: make(map[int64]gitCached)}}}
+	if _, _, err := s.read(a); err == nil {
+		t.Error("looping delta chain resolved")
+	}
+}
+
+func TestScanGitSelfReferencingTree(t *testing.T) {
+	defer silenceStdout(t)()
+
+	// Object names are not checked against content, so a tree can list
+	// itself, here twice over
+	tree, blob, commit := strings.Repeat("aa", 20), strings.Repeat("bb", 20), strings.Repeat("cc", 20)
+	entry := func(mode, name, hash string) string {
+		raw, err := hex.DecodeString(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mode + " " + name + "\x00" + string(raw)
+	}
+
+	repo := t.TempDir()
+	writeLoose := func(hash, kind, content string) {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		fmt.Fprintf(zw, "%s %d\x00%s", kind, len(content), content)
+		zw.Close()
+		dir := filepath.Join(repo, "objects", hash[:2])
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, hash[2:]), z.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLoose(tree, "tree", entry("40000", "a", tree)+entry("40000", "b", tree)+entry("100644", "app.config", blob))
+	writeLoose(blob, "blob", "password = Winter2024!\n")
+	writeLoose(commit, "commit", "tree "+tree+"\nauthor Test <test@example.com> 0 +0000\n\nloop\n")
+	if err := os.WriteFile(filepath.Join(repo, "HEAD"), []byte(commit+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []types.SecretMatch)
+	go func() {
+		matches, _ := NewExtractor().ScanFile(repo)
+		done <- matches
+	}()
+
+	select {
+	case matches := <-done:
+		if len(matches) == 0 {
+			t.Error("secret in the looping tree not found")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("scan of a self-referencing tree did not finish")
+	}
+}
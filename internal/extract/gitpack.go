@@ -0,0 +1,380 @@
+// gitpack.go reads git objects from loose object files and packfiles,
+// resolving delta chains, over an fs.FS.
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+
+	"github.com/loosehose/azonk/internal/config"
+)
+
+// =============================================================================
+// Object Store
+// =============================================================================
+
+// gitHash is a SHA-1 object name.
+type gitHash [20]byte
+
+func (h gitHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func parseGitHash(s string) (gitHash, bool) {
+	var h gitHash
+	if len(s) != 40 {
+		return h, false
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, false
+	}
+	return h, true
+}
+
+// Object types, numbered as in packfiles.
+const (
+	gitCommit   = 1
+	gitTree     = 2
+	gitBlob     = 3
+	gitTag      = 4
+	gitOfsDelta = 6
+	gitRefDelta = 7
+)
+
+var gitTypeNames = map[string]int{"commit": gitCommit, "tree": gitTree, "blob": gitBlob, "tag": gitTag}
+
+var errGitNotFound = errors.New("git object not found")
+
+// gitStore reads objects from a repository's objects directory.
+type gitStore struct {
+	fsys  fs.FS
+	packs []*gitPack
+	bytes int64 // Pack bytes loaded, for throughput reporting
+}
+
+// openGitStore loads the pack indexes of the repository in fsys. Packs
+// larger than MaxGitPackSize are ignored.
+func openGitStore(fsys fs.FS) *gitStore {
+	s := &gitStore{fsys: fsys}
+
+	idxFiles, _ := fs.Glob(fsys, "objects/pack/*.idx")
+	for _, idxFile := range idxFiles {
+		packFile := idxFile[:len(idxFile)-len(".idx")] + ".pack"
+		if info, err := fs.Stat(fsys, packFile); err != nil || info.Size() > config.MaxGitPackSize {
+			continue
+		}
+
+		idx, err := fs.ReadFile(fsys, idxFile)
+		if err != nil {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, packFile)
+		if err != nil {
+			continue
+		}
+
+		pack, err := parseGitPack(idx, data)
+		if err != nil {
+			continue
+		}
+		s.packs = append(s.packs, pack)
+		s.bytes += int64(len(data))
+	}
+	return s
+}
+
+// read returns the type and content of an object.
+func (s *gitStore) read(h gitHash) (int, []byte, error) {
+	return s.readDelta(h, 0)
+}
+
+// readDelta reads an object that is the base of a chain of depth deltas.
+func (s *gitStore) readDelta(h gitHash, depth int) (int, []byte, error) {
+	for _, p := range s.packs {
+		if offset, ok := p.offsets[h]; ok {
+			return p.readAt(offset, s, depth)
+		}
+	}
+	return s.readLoose(h)
+}
+
+// readLoose reads a zlib-compressed object from objects/xx/yyyy.
+func (s *gitStore) readLoose(h gitHash) (int, []byte, error) {
+	name := h.String()
+	f, err := s.fsys.Open(path.Join("objects", name[:2], name[2:]))
+	if err != nil {
+		return 0, nil, errGitNotFound
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(zr, config.MaxFileSizeForScan+64))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	nul := bytes.IndexByte(raw, 0)
+	if nul < 0 {
+		return 0, nil, fmt.Errorf("loose object %s: missing header", name)
+	}
+	var kindName string
+	var size int
+	if _, err := fmt.Sscanf(string(raw[:nul]), "%s %d", &kindName, &size); err != nil {
+		return 0, nil, fmt.Errorf("loose object %s: %w", name, err)
+	}
+	kind, ok := gitTypeNames[kindName]
+	if !ok {
+		return 0, nil, fmt.Errorf("loose object %s: unknown type %q", name, kindName)
+	}
+	return kind, raw[nul+1:], nil
+}
+
+// =============================================================================
+// Packfiles
+// =============================================================================
+
+// gitPack is a packfile held in memory with its index.
+type gitPack struct {
+	data    []byte
+	offsets map[gitHash]int64
+
+	cache      map[int64]gitCached // Delta bases by offset
+	cacheBytes int
+}
+
+type gitCached struct {
+	kind int
+	data []byte
+}
+
+// parseGitPack parses a version 2 pack index and checks the pack header.
+func parseGitPack(idx, data []byte) (*gitPack, error) {
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(idx[4:]) != 2 {
+		return nil, errors.New("unsupported pack index")
+	}
+	if len(data) < 12 || string(data[:4]) != "PACK" {
+		return nil, errors.New("not a packfile")
+	}
+
+	n := int(binary.BigEndian.Uint32(idx[8+255*4:]))
+	names := 8 + 256*4
+	offsets := names + n*20 + n*4
+	large := offsets + n*4
+	if len(idx) < large {
+		return nil, errors.New("truncated pack index")
+	}
+
+	p := &gitPack{data: data, offsets: make(map[gitHash]int64, n), cache: make(map[int64]gitCached)}
+	for i := 0; i < n; i++ {
+		var h gitHash
+		copy(h[:], idx[names+i*20:])
+
+		off := int64(binary.BigEndian.Uint32(idx[offsets+i*4:]))
+		if off&0x80000000 != 0 {
+			pos := large + int(off&0x7fffffff)*8
+			if pos+8 > len(idx) {
+				return nil, errors.New("truncated pack index")
+			}
+			off = int64(binary.BigEndian.Uint64(idx[pos:]))
+		}
+		p.offsets[h] = off
+	}
+	return p, nil
+}
+
+// readAt reads the object at offset, resolving deltas against bases in
+// this pack or, for ref deltas, anywhere in the store. Depth counts the
+// deltas already being resolved, so self-referencing and looping chains
+// fail once they pass MaxGitDeltaDepth.
+func (p *gitPack) readAt(offset int64, s *gitStore, depth int) (int, []byte, error) {
+	if c, ok := p.cache[offset]; ok {
+		return c.kind, c.data, nil
+	}
+	if offset < 12 || offset >= int64(len(p.data)) {
+		return 0, nil, errors.New("pack offset out of range")
+	}
+
+	pos := int(offset)
+	c := p.data[pos]
+	pos++
+	kind := int(c>>4) & 7
+	size := int64(c & 15)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if pos >= len(p.data) || shift > 56 {
+			return 0, nil, errors.New("bad pack object header")
+		}
+		c = p.data[pos]
+		pos++
+		size |= int64(c&0x7f) << shift
+	}
+	if size > config.MaxFileSizeForScan {
+		return 0, nil, errors.New("pack object too large")
+	}
+
+	var baseKind int
+	var base []byte
+	if (kind == gitOfsDelta || kind == gitRefDelta) && depth >= config.MaxGitDeltaDepth {
+		return 0, nil, errors.New("delta chain too deep")
+	}
+	switch kind {
+	case gitOfsDelta:
+		if pos >= len(p.data) {
+			return 0, nil, errors.New("bad delta offset")
+		}
+		c = p.data[pos]
+		pos++
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if pos >= len(p.data) {
+				return 0, nil, errors.New("bad delta offset")
+			}
+			c = p.data[pos]
+			pos++
+			rel = (rel+1)<<7 | int64(c&0x7f)
+		}
+		if rel <= 0 || rel > offset {
+			return 0, nil, errors.New("bad delta offset")
+		}
+		var err error
+		if baseKind, base, err = p.readAt(offset-rel, s, depth+1); err != nil {
+			return 0, nil, err
+		}
+	case gitRefDelta:
+		if pos+20 > len(p.data) {
+			return 0, nil, errors.New("bad delta base")
+		}
+		var h gitHash
+		copy(h[:], p.data[pos:])
+		pos += 20
+		var err error
+		if baseKind, base, err = s.readDelta(h, depth+1); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(p.data[pos:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, size))
+	zr.Close()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if base != nil {
+		if data, err = applyGitDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+		kind = baseKind
+	}
+
+	// Trees and commits are read repeatedly while diffing and are common
+	// delta bases, so keep them; blobs are read once per change
+	if kind != gitBlob {
+		if p.cacheBytes > config.MaxGitCacheSize {
+			p.cache = make(map[int64]gitCached)
+			p.cacheBytes = 0
+		}
+		p.cache[offset] = gitCached{kind: kind, data: data}
+		p.cacheBytes += len(data)
+	}
+	return kind, data, nil
+}
+
+// applyGitDelta rebuilds an object from its base and a delta of copy and
+// insert instructions.
+func applyGitDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta, ok := gitDeltaSize(delta)
+	if !ok || srcSize != len(base) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	dstSize, delta, ok := gitDeltaSize(delta)
+	if !ok || dstSize > config.MaxFileSizeForScan {
+		return nil, errors.New("bad delta size")
+	}
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case op&0x80 != 0:
+			var offset, size int
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errors.New("truncated delta")
+					}
+					offset |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errors.New("truncated delta")
+					}
+					size |= int(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("delta copy out of range")
+			}
+			out = append(out, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errors.New("truncated delta")
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errors.New("bad delta instruction")
+		}
+	}
+
+	if len(out) != dstSize {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return out, nil
+}
+
+// gitDeltaSize reads a little-endian base-128 size from a delta header.
+func gitDeltaSize(b []byte) (int, []byte, bool) {
+	size := 0
+	for i, shift := 0, 0; i < len(b) && shift < 63; i, shift = i+1, shift+7 {
+		size |= int(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return size, b[i+1:], true
+		}
+	}
+	return 0, nil, false
+}
+
+// gitTypeName returns the name of an object type, for error messages.
+func gitTypeName(kind int) string {
+	for name, k := range gitTypeNames {
+		if k == kind {
+			return name
+		}
+	}
+	return strconv.Itoa(kind)
+}
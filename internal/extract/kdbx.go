@@ -0,0 +1,289 @@
+// kdbx.go recognizes KeePass password databases and unlocks KDBX 3.1 and
+// 4.x databases protected by AES-KDF with a candidate password.
+package extract
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+const (
+	kdbxSignature = 0xB54BFB67 // Second signature of KDBX (KeePass 2.x)
+	kdbSignature  = 0xB54BFB65 // Second signature of KDB (KeePass 1.x)
+)
+
+// Outer header field IDs.
+const (
+	kdbxEnd             = 0
+	kdbxCipherID        = 2
+	kdbxMasterSeed      = 4
+	kdbxTransformSeed   = 5 // KDBX 3.1
+	kdbxTransformRounds = 6 // KDBX 3.1
+	kdbxEncryptionIV    = 7
+	kdbxStreamStart     = 9  // KDBX 3.1
+	kdbxKdfParameters   = 11 // KDBX 4
+)
+
+// KDF and cipher UUIDs, hex encoded.
+var (
+	kdbxAESKDF = map[string]bool{
+		"c9d9f39a628a4460bf740d08c18a4fea": true,
+		"7c02bb8279a74ac0927d114a00648238": true,
+	}
+	kdbxArgon2 = map[string]string{
+		"ef636ddf8c29444b91f7a9a403e30a0c": "Argon2d",
+		"9e298b1956db4773b23dfc3ec6f0a1e6": "Argon2id",
+	}
+	kdbxCiphers = map[string]string{
+		"31c1f2e6bf714350be5805216afc5aff": "AES-256",
+		"d6038a2b8b6f4cb5a524339a31dbb59a": "ChaCha20",
+		"ad68f29f576f4bb9a36ad47af965346c": "Twofish",
+	}
+)
+
+// =============================================================================
+// KeePass Databases
+// =============================================================================
+
+// scanKeePass reports a KeePass database, unlocking it when opening is
+// enabled and a candidate password works.
+func (e *Extractor) scanKeePass(file, location string, data []byte, depth scanDepth) []types.SecretMatch {
+	db, err := parseKeePass(data)
+	if err != nil {
+		return nil
+	}
+	return e.scanProtected(file, location, db, depth)
+}
+
+// keePassDatabase holds what is needed to check a password: the outer
+// header, its HMAC (KDBX 4) or the start of the payload (KDBX 3.1).
+type keePassDatabase struct {
+	p       *types.Protection
+	major   int
+	cipher  string
+	rounds  uint64
+	header  []byte
+	payload []byte
+
+	masterSeed, transformSeed, iv, streamStart, headerHMAC []byte
+}
+
+func parseKeePass(data []byte) (*keePassDatabase, error) {
+	if len(data) < 12 {
+		return nil, errors.New("truncated database")
+	}
+
+	db := &keePassDatabase{p: &types.Protection{Format: "KeePass"}}
+	switch binary.LittleEndian.Uint32(data[4:]) {
+	case kdbSignature:
+		db.p.Scheme = "KDB 1.x"
+		return db, nil
+	case kdbxSignature:
+	default:
+		return nil, errors.New("not a KeePass database")
+	}
+
+	version := binary.LittleEndian.Uint32(data[8:])
+	db.major = int(version >> 16)
+	if db.major != 3 && db.major != 4 {
+		db.p.Scheme = fmt.Sprintf("KDBX %d.%d", db.major, version&0xFFFF)
+		return db, nil
+	}
+
+	// Header fields: an ID, a 2-byte (3.1) or 4-byte (4.x) size and data
+	pos := 12
+	kdf := "AES-KDF"
+	var kdfParams []byte
+	for {
+		sizeLen := 2
+		if db.major == 4 {
+			sizeLen = 4
+		}
+		if pos+1+sizeLen > len(data) {
+			return nil, errors.New("truncated header")
+		}
+		id := data[pos]
+		size := int(binary.LittleEndian.Uint16(data[pos+1:]))
+		if db.major == 4 {
+			size = int(binary.LittleEndian.Uint32(data[pos+1:]))
+		}
+		pos += 1 + sizeLen
+		if size < 0 || pos+size > len(data) {
+			return nil, errors.New("truncated header")
+		}
+		field := data[pos : pos+size]
+		pos += size
+
+		switch id {
+		case kdbxEnd:
+		case kdbxCipherID:
+			db.cipher = kdbxCiphers[hex.EncodeToString(field)]
+		case kdbxMasterSeed:
+			db.masterSeed = field
+		case kdbxTransformSeed:
+			db.transformSeed = field
+		case kdbxTransformRounds:
+			if len(field) == 8 {
+				db.rounds = binary.LittleEndian.Uint64(field)
+			}
+		case kdbxEncryptionIV:
+			db.iv = field
+		case kdbxStreamStart:
+			db.streamStart = field
+		case kdbxKdfParameters:
+			kdfParams = field
+		}
+		if id == kdbxEnd {
+			break
+		}
+	}
+	db.header = data[:pos]
+
+	if db.major == 4 {
+		// SHA-256 of the header, then its HMAC
+		if pos+64 > len(data) {
+			return nil, errors.New("truncated header")
+		}
+		db.headerHMAC = data[pos+32 : pos+64]
+
+		params := parseVariantDictionary(kdfParams)
+		uuid := hex.EncodeToString(params["$UUID"])
+		switch {
+		case kdbxAESKDF[uuid]:
+			db.transformSeed = params["S"]
+			if r := params["R"]; len(r) == 8 {
+				db.rounds = binary.LittleEndian.Uint64(r)
+			}
+		case kdbxArgon2[uuid] != "":
+			kdf = kdbxArgon2[uuid]
+		default:
+			kdf = "unknown KDF"
+		}
+		if kdf != "AES-KDF" {
+			var iterations, memory uint64
+			if v := params["I"]; len(v) == 8 {
+				iterations = binary.LittleEndian.Uint64(v)
+			}
+			if v := params["M"]; len(v) == 8 {
+				memory = binary.LittleEndian.Uint64(v)
+			}
+			db.p.KDF = fmt.Sprintf("%s x%d, %d MB", kdf, iterations, memory>>20)
+		}
+	} else {
+		db.payload = data[pos:]
+	}
+
+	cipherName := db.cipher
+	if cipherName == "" {
+		cipherName = "unknown cipher"
+	}
+	db.p.Scheme = fmt.Sprintf("KDBX %d.%d %s", db.major, version&0xFFFF, cipherName)
+	if kdf == "AES-KDF" {
+		db.p.KDF = fmt.Sprintf("AES-KDF x%d", db.rounds)
+	}
+
+	// KDBX 4 is checked by header HMAC whatever the cipher; KDBX 3.1 by
+	// decrypting the stream start bytes, so only for AES
+	db.p.Openable = kdf == "AES-KDF" && db.rounds <= config.MaxKeePassRounds &&
+		len(db.masterSeed) == 32 && len(db.transformSeed) == 32 &&
+		(db.major == 4 || (db.cipher == "AES-256" && len(db.iv) == aes.BlockSize && len(db.streamStart) == 32 && len(db.payload) >= 32))
+	return db, nil
+}
+
+func (db *keePassDatabase) protection() *types.Protection { return db.p }
+
+// open checks a password. The database is unlocked, not decrypted, so
+// there is nothing further to scan.
+func (db *keePassDatabase) open(password string) ([]protectedEntry, bool) {
+	transformed, err := db.transformKey(password)
+	if err != nil {
+		return nil, false
+	}
+
+	if db.major == 4 {
+		h := sha512.New()
+		h.Write(db.masterSeed)
+		h.Write(transformed)
+		h.Write([]byte{1})
+		hmacKey := h.Sum(nil)
+
+		// The header's HMAC key is derived for block index 2^64-1
+		h.Reset()
+		h.Write(bytes.Repeat([]byte{0xFF}, 8))
+		h.Write(hmacKey)
+		mac := hmac.New(sha256.New, h.Sum(nil))
+		mac.Write(db.header)
+		return nil, hmac.Equal(mac.Sum(nil), db.headerHMAC)
+	}
+
+	masterKey := sha256.Sum256(append(append([]byte(nil), db.masterSeed...), transformed...))
+	block, err := aes.NewCipher(masterKey[:])
+	if err != nil {
+		return nil, false
+	}
+	start := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, db.iv).CryptBlocks(start, db.payload[:32])
+	return nil, bytes.Equal(start, db.streamStart)
+}
+
+// transformKey hashes a password into the composite key and runs it
+// through the AES-KDF rounds.
+func (db *keePassDatabase) transformKey(password string) ([]byte, error) {
+	pw := sha256.Sum256([]byte(password))
+	key := sha256.Sum256(pw[:])
+
+	block, err := aes.NewCipher(db.transformSeed)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < db.rounds; i++ {
+		block.Encrypt(key[:16], key[:16])
+		block.Encrypt(key[16:], key[16:])
+	}
+	sum := sha256.Sum256(key[:])
+	return sum[:], nil
+}
+
+// parseVariantDictionary reads the typed name/value pairs that hold KDBX 4
+// KDF parameters, keeping the raw value bytes.
+func parseVariantDictionary(data []byte) map[string][]byte {
+	params := make(map[string][]byte)
+	if len(data) < 2 {
+		return params
+	}
+
+	pos := 2 // Version
+	for pos < len(data) && data[pos] != 0 {
+		pos++ // Value type
+		if pos+4 > len(data) {
+			break
+		}
+		nameLen := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if nameLen < 0 || pos+nameLen+4 > len(data) {
+			break
+		}
+		name := string(data[pos : pos+nameLen])
+		pos += nameLen
+
+		valueLen := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if valueLen < 0 || pos+valueLen > len(data) {
+			break
+		}
+		params[name] = data[pos : pos+valueLen]
+		pos += valueLen
+	}
+	return params
+}
@@ -0,0 +1,555 @@
+// keys.go analyzes certificates and private key material (PFX, PEM, DER and
+// OpenSSH) offline, trying candidate passwords gathered during the scan.
+package extract
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// Pattern names used for key material findings.
+const (
+	patternKeyStore = "PKCS#12 Key Store"
+	patternKeyFile  = "Private Key File"
+)
+
+// =============================================================================
+// Password Candidates
+// =============================================================================
+
+// passwordPool collects candidate passwords for protected key material:
+// configured defaults plus passwords found by detectors during the scan.
+type passwordPool struct {
+	mu   sync.Mutex
+	list []string
+	seen map[string]bool
+}
+
+func newPasswordPool(initial []string) *passwordPool {
+	p := &passwordPool{seen: make(map[string]bool)}
+	p.add(initial...)
+	return p
+}
+
+func (p *passwordPool) add(passwords ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pw := range passwords {
+		if p.seen[pw] || len(p.list) >= config.MaxPasswordCandidates {
+			continue
+		}
+		p.seen[pw] = true
+		p.list = append(p.list, pw)
+	}
+}
+
+func (p *passwordPool) snapshot() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.list...)
+}
+
+// AddPasswords adds candidate passwords to try against protected key files
+// and, when opening is enabled, encrypted containers.
+func (e *Extractor) AddPasswords(passwords ...string) {
+	e.passwords.add(passwords...)
+	e.supplied = append(e.supplied, passwords...)
+}
+
+// pendingKey is protected key material whose password was not among the
+// candidates known when it was scanned.
+type pendingKey struct {
+	file     string
+	location string
+	data     []byte
+}
+
+// pendingSet collects the protected key material and containers one scan
+// could not open, so they can be retried once the scan has seen all its
+// passwords. Each scan has its own set; concurrent scans never share one.
+type pendingSet struct {
+	mu        sync.Mutex
+	keys      []pendingKey
+	protected []pendingProtected
+}
+
+func (s *pendingSet) addKey(p pendingKey) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.keys = append(s.keys, p)
+	s.mu.Unlock()
+}
+
+func (s *pendingSet) addProtected(p pendingProtected) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.protected = append(s.protected, p)
+	s.mu.Unlock()
+}
+
+// retryPending re-opens the protected key material and containers in
+// pending with passwords discovered after they were scanned, updating the
+// matching findings in place. Opened containers whose findings are not in
+// results are returned as new findings.
+func (e *Extractor) retryPending(results [][]types.SecretMatch, pending *pendingSet) []types.SecretMatch {
+	if pending == nil {
+		return nil
+	}
+
+	candidates := e.passwords.snapshot()
+	for _, p := range pending.keys {
+		km := openKeyMaterial(p.data, candidates)
+		if km == nil || !km.Opened {
+			continue
+		}
+
+		for _, matches := range results {
+			for i := range matches {
+				m := &matches[i]
+				if m.File == p.file && m.Location == p.location && m.KeyMaterial != nil {
+					m.KeyMaterial = km
+					m.Match, m.Context = describeKeyMaterial(km)
+					m.Severity = keyMaterialSeverity(km)
+					ui.Warning("Recovered password for %s", joinLocation(p.file, p.location))
+				}
+			}
+		}
+	}
+
+	return e.retryProtected(results, pending.protected)
+}
+
+// =============================================================================
+// Key Material Scanning
+// =============================================================================
+
+// scanKeyMaterial reports key material found in data. Text input is only
+// analyzed when it contains PEM blocks.
+func (e *Extractor) scanKeyMaterial(file, location string, data []byte, pending *pendingSet) []types.SecretMatch {
+	km := openKeyMaterial(data, e.passwords.snapshot())
+	if km == nil {
+		return nil
+	}
+
+	if km.Protected && !km.Opened && km.Unopenable == "" {
+		pending.addKey(pendingKey{file: file, location: location, data: data})
+	}
+
+	name, line := patternKeyFile, 0
+	if km.Format == "PKCS#12" {
+		name = patternKeyStore
+	}
+	if idx := bytes.Index(data, []byte("-----BEGIN ")); idx >= 0 {
+		line = bytes.Count(data[:idx], []byte("\n")) + 1
+	}
+
+	match, context := describeKeyMaterial(km)
+	return []types.SecretMatch{{
+		File:        file,
+		Location:    location,
+		Line:        line,
+		PatternName: name,
+		Severity:    keyMaterialSeverity(km),
+		Match:       match,
+		Context:     context,
+		KeyMaterial: km,
+	}}
+}
+
+// openKeyMaterial identifies and, where possible, opens key material using
+// the candidate passwords. It returns nil when data holds no private key
+// and is not a PKCS#12 key store.
+func openKeyMaterial(data []byte, candidates []string) *types.KeyMaterial {
+	var km *types.KeyMaterial
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		km = openPEM(data, candidates)
+	default:
+		if pfx, authSafe, err := parsePFXHeader(data); err == nil {
+			return openPFX(pfx, authSafe, candidates)
+		}
+		km = openDER(data)
+	}
+
+	if km == nil || (!km.HasPrivateKey && !km.Protected) {
+		return nil
+	}
+	return km
+}
+
+func openPFX(pfx *pfxPDU, authSafe []byte, candidates []string) *types.KeyMaterial {
+	hasMac := pfx.MacData.Mac.Algorithm.Algorithm != nil
+	if err := checkIterations(pfx.MacData.Iterations); hasMac && err != nil {
+		return &types.KeyMaterial{Format: "PKCS#12", Protected: true, Unopenable: err.Error()}
+	}
+
+	km := &types.KeyMaterial{Format: "PKCS#12", Protected: !verifyPFXMac(pfx, authSafe, "")}
+
+	tries := []string{""}
+	if km.Protected || !hasMac {
+		tries = append(tries, candidates...)
+	}
+
+	for _, pw := range tries {
+		if !verifyPFXMac(pfx, authSafe, pw) {
+			continue
+		}
+
+		contents, err := decodePFX(authSafe, pw)
+		if errors.Is(err, errIterationLimit) {
+			km.Protected, km.Unopenable = true, err.Error()
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		// Without a MAC the empty password only counts if it decrypts
+		km.Protected = pw != ""
+		km.Opened = true
+		if km.Protected {
+			km.Password = pw
+		}
+		fillKeyMaterial(km, contents.keys, contents.certs)
+		break
+	}
+
+	// Without a MAC only decryption tells whether a password is needed, so
+	// contents no candidate decrypts are locked
+	if !hasMac && !km.Opened {
+		km.Protected = true
+	}
+	return km
+}
+
+func openPEM(data []byte, candidates []string) *types.KeyMaterial {
+	km := &types.KeyMaterial{Format: "PEM"}
+	var keys []any
+	var certs []*x509.Certificate
+	locked := false
+
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
+			}
+
+		case "RSA PRIVATE KEY", "EC PRIVATE KEY", "DSA PRIVATE KEY", "PRIVATE KEY":
+			km.HasPrivateKey = true
+			// Legacy encrypted PEM (Proc-Type header) is still common in the wild
+			if !x509.IsEncryptedPEMBlock(block) {
+				if key, err := parsePrivateKeyDER(block.Bytes); err == nil {
+					keys = append(keys, key)
+				}
+				continue
+			}
+
+			km.Protected = true
+			key, pw, ok := tryPasswords(candidates, func(pw string) (any, error) {
+				der, err := x509.DecryptPEMBlock(block, []byte(pw))
+				if err != nil {
+					return nil, err
+				}
+				return parsePrivateKeyDER(der)
+			})
+			if ok {
+				keys, km.Password = append(keys, key), pw
+			} else {
+				locked = true
+			}
+
+		case "ENCRYPTED PRIVATE KEY":
+			km.HasPrivateKey, km.Protected = true, true
+			var limitErr error
+			key, pw, ok := tryPasswords(candidates, func(pw string) (any, error) {
+				der, err := decryptPKCS8(block.Bytes, pw)
+				if err != nil {
+					if errors.Is(err, errIterationLimit) {
+						limitErr = err
+					}
+					return nil, err
+				}
+				return parsePrivateKeyDER(der)
+			})
+			if ok {
+				keys, km.Password = append(keys, key), pw
+			} else {
+				locked = true
+			}
+			if limitErr != nil {
+				km.Unopenable = limitErr.Error()
+			}
+
+		case "OPENSSH PRIVATE KEY":
+			km.HasPrivateKey = true
+			keyType, encrypted, ok := parseOpenSSHKey(block.Bytes)
+			if !ok {
+				continue
+			}
+			km.Format, km.KeyType = "OpenSSH", keyType
+			if encrypted {
+				// Encrypted OpenSSH keys are only reported, not opened:
+				// their bcrypt_pbkdf key derivation is not implemented
+				km.Protected, locked = true, true
+				km.Unopenable = "OpenSSH bcrypt_pbkdf encryption is not supported for opening"
+			}
+		}
+	}
+
+	km.Opened = !locked
+	fillKeyMaterial(km, keys, certs)
+	return km
+}
+
+// openDER recognizes a bare DER private key. Certificates on their own are
+// not secrets and are ignored.
+func openDER(data []byte) *types.KeyMaterial {
+	key, err := parsePrivateKeyDER(data)
+	if err != nil {
+		if _, err := decryptPKCS8Header(data); err == nil {
+			return &types.KeyMaterial{Format: "DER", HasPrivateKey: true, Protected: true}
+		}
+		return nil
+	}
+
+	km := &types.KeyMaterial{Format: "DER", HasPrivateKey: true, Opened: true}
+	fillKeyMaterial(km, []any{key}, nil)
+	return km
+}
+
+// decryptPKCS8Header checks that data is an EncryptedPrivateKeyInfo.
+func decryptPKCS8Header(data []byte) (*encryptedPrivateKeyInfo, error) {
+	var epki encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(data, &epki); err != nil {
+		return nil, err
+	}
+	if epki.Algorithm.Algorithm == nil || len(epki.EncryptedData) == 0 {
+		return nil, fmt.Errorf("not an encrypted private key")
+	}
+	return &epki, nil
+}
+
+func tryPasswords(candidates []string, open func(pw string) (any, error)) (any, string, bool) {
+	for _, pw := range candidates {
+		if key, err := open(pw); err == nil {
+			return key, pw, true
+		}
+	}
+	return nil, "", false
+}
+
+// =============================================================================
+// Reporting
+// =============================================================================
+
+// fillKeyMaterial records key and certificate details, listing the
+// certificate that belongs to the private key first.
+func fillKeyMaterial(km *types.KeyMaterial, keys []any, certs []*x509.Certificate) {
+	if len(keys) > 0 {
+		km.HasPrivateKey = true
+		km.KeyType = keyType(keys[0])
+	}
+
+	for i, cert := range certs {
+		if len(keys) > 0 && publicKeyMatches(keys[0], cert.PublicKey) && i > 0 {
+			certs[0], certs[i] = certs[i], certs[0]
+			break
+		}
+	}
+
+	km.Certificates = km.Certificates[:0]
+	for _, cert := range certs {
+		km.Certificates = append(km.Certificates, certificateInfo(cert))
+	}
+}
+
+func certificateInfo(cert *x509.Certificate) types.CertificateInfo {
+	thumb := sha1.Sum(cert.Raw)
+	return types.CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		Thumbprint:   strings.ToUpper(hex.EncodeToString(thumb[:])),
+		SerialNumber: strings.ToUpper(cert.SerialNumber.Text(16)),
+		NotBefore:    cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:     cert.NotAfter.UTC().Format(time.RFC3339),
+		DNSNames:     cert.DNSNames,
+		KeyType:      keyType(cert.PublicKey),
+		Expired:      time.Now().After(cert.NotAfter),
+	}
+}
+
+// describeKeyMaterial renders the match and context strings for a finding.
+func describeKeyMaterial(km *types.KeyMaterial) (string, string) {
+	var match string
+	switch {
+	case len(km.Certificates) > 0:
+		match = fmt.Sprintf("%s %s (%s)", km.Format, km.Certificates[0].Subject, km.Certificates[0].Thumbprint)
+	case km.KeyType != "":
+		match = fmt.Sprintf("%s %s private key", km.Format, km.KeyType)
+	default:
+		match = km.Format + " key material"
+	}
+
+	var parts []string
+	switch {
+	case km.Protected && km.Opened:
+		parts = append(parts, fmt.Sprintf("password: %s", km.Password))
+	case km.Protected && km.Unopenable != "":
+		parts = append(parts, "password protected, not openable: "+km.Unopenable)
+	case km.Protected:
+		parts = append(parts, "password protected")
+	default:
+		parts = append(parts, "not password protected")
+	}
+	if km.KeyType != "" {
+		parts = append(parts, "key: "+km.KeyType)
+	}
+	if len(km.Certificates) > 0 {
+		c := km.Certificates[0]
+		parts = append(parts, "issuer: "+c.Issuer, fmt.Sprintf("valid: %s to %s", c.NotBefore[:10], c.NotAfter[:10]))
+	}
+
+	return match, strings.Join(parts, "; ")
+}
+
+// keyMaterialSeverity rates a usable private key as critical, a key still
+// behind an unknown password as high, and bare certificates as low.
+func keyMaterialSeverity(km *types.KeyMaterial) types.Severity {
+	switch {
+	case km.HasPrivateKey && (!km.Protected || km.Opened):
+		return types.SeverityCritical
+	case km.Protected && !km.Opened:
+		return types.SeverityHigh
+	}
+	return types.SeverityLow
+}
+
+// keyMaterialRules describes the key material findings, which come from
+// key file analysis rather than a registered detector.
+func keyMaterialRules() []types.RuleInfo {
+	return []types.RuleInfo{
+		{Name: patternKeyStore, Severity: types.SeverityCritical, Description: "PKCS#12 key store, opened with a candidate password where possible"},
+		{Name: patternKeyFile, Severity: types.SeverityCritical, Description: "PEM, DER or OpenSSH private key, decrypted with a candidate password where possible"},
+	}
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+func keyType(key any) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PrivateKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return "Ed25519"
+	case *dsa.PublicKey:
+		return fmt.Sprintf("DSA %d", k.P.BitLen())
+	}
+	return "unknown"
+}
+
+func publicKeyMatches(key any, pub crypto.PublicKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	eq, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && eq.Equal(pub)
+}
+
+// parseOpenSSHKey reads the key type and cipher from an "openssh-key-v1"
+// blob without decrypting it.
+func parseOpenSSHKey(data []byte) (string, bool, bool) {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return "", false, false
+	}
+	rest := data[len(magic):]
+
+	readString := func() ([]byte, bool) {
+		if len(rest) < 4 {
+			return nil, false
+		}
+		n := binary.BigEndian.Uint32(rest)
+		if uint32(len(rest)-4) < n {
+			return nil, false
+		}
+		s := rest[4 : 4+n]
+		rest = rest[4+n:]
+		return s, true
+	}
+
+	cipherName, ok := readString()
+	if !ok {
+		return "", false, false
+	}
+	readString() // kdfname
+	readString() // kdfoptions
+	if len(rest) < 4 {
+		return "", false, false
+	}
+	rest = rest[4:] // number of keys
+	pub, ok := readString()
+	if !ok {
+		return "", false, false
+	}
+
+	rest = pub
+	algo, ok := readString()
+	if !ok {
+		return "", false, false
+	}
+
+	keyType := string(algo)
+	switch {
+	case keyType == "ssh-rsa":
+		readString() // public exponent
+		if n, ok := readString(); ok {
+			keyType = fmt.Sprintf("RSA %d", len(bytes.TrimLeft(n, "\x00"))*8)
+		}
+	case keyType == "ssh-ed25519":
+		keyType = "Ed25519"
+	case strings.HasPrefix(keyType, "ecdsa-sha2-nistp"):
+		keyType = "ECDSA P-" + strings.TrimPrefix(keyType, "ecdsa-sha2-nistp")
+	}
+
+	return keyType, string(cipherName) != "none", true
+}
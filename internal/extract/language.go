@@ -0,0 +1,102 @@
+// language.go registers password detectors for the key names of the
+// built-in language packs, so "Kennwort: ..." is found like "password: ...".
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Language Packs
+// =============================================================================
+
+// AddLanguages registers a password detector for each language pack given
+// by ISO 639-1 code. Languages already added are skipped. Call it before
+// scanning.
+func (e *Extractor) AddLanguages(codes ...string) error {
+	packs := config.LanguagePacks()
+	for _, code := range codes {
+		code = strings.ToLower(strings.TrimSpace(code))
+		pack, ok := packs[code]
+		if !ok {
+			return fmt.Errorf("no language pack for %q", code)
+		}
+		if e.languages[code] {
+			continue
+		}
+
+		d, err := languageDetector(pack)
+		if err != nil {
+			return err
+		}
+		if e.languages == nil {
+			e.languages = make(map[string]bool)
+		}
+		e.languages[code] = true
+		e.Register(d)
+	}
+	return nil
+}
+
+// languageDetector builds the equivalent of the Password detector for a
+// language pack's key names. Short key names must be followed by a colon
+// or equals sign.
+func languageDetector(pack config.LanguagePack) (*RegexDetector, error) {
+	var keywords []string
+	keyNames := func(names []string) string {
+		var exprs []string
+		for _, name := range names {
+			words := strings.FieldsFunc(name, isKeySeparator)
+			for i, w := range words {
+				words[i] = regexp.QuoteMeta(w)
+			}
+			exprs = append(exprs, strings.Join(words, `[\s_\-]?`))
+			keywords = append(keywords, asciiStem(name))
+		}
+		return strings.Join(exprs, "|")
+	}
+
+	var keys []string
+	if len(pack.KeyNames) > 0 {
+		keys = append(keys, `(?:`+keyNames(pack.KeyNames)+`)["'\s:=]+`)
+	}
+	if len(pack.ShortKeyNames) > 0 {
+		keys = append(keys, `(?:`+keyNames(pack.ShortKeyNames)+`)["']?\s*[:=][\s"']*`)
+	}
+
+	name := fmt.Sprintf("Password (%s)", pack.Name)
+	expr := `(?i)\b(?:` + strings.Join(keys, "|") + `)(?P<secret>[^\s"',\]\}]{4,50})`
+	d, err := NewRegexDetector(name, keywords, expr)
+	if err != nil {
+		return nil, err
+	}
+	return d.WithRule(types.SeverityHigh, fmt.Sprintf("Password assigned to a %s password-like key", pack.Name)), nil
+}
+
+func isKeySeparator(r rune) bool {
+	return r == ' ' || r == '_' || r == '-'
+}
+
+// asciiStem returns the longest run of ASCII letters in a key name. The
+// prefilter matches ASCII case-insensitively and cannot rely on separators,
+// so the stem is what every spelling of the name has in common.
+func asciiStem(name string) string {
+	var best, cur []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			cur = append(cur, c)
+			if len(cur) > len(best) {
+				best = append(best[:0], cur...)
+			}
+			continue
+		}
+		cur = cur[:0]
+	}
+	return string(best)
+}
@@ -0,0 +1,47 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLanguageShortKeyNames(t *testing.T) {
+	e := NewExtractor()
+	if err := e.AddLanguages("fr", "es"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text   string
+		secret string
+	}{
+		{`clave: Verano2024!`, "Verano2024!"},
+		{`"clave"="Verano2024!"`, "Verano2024!"},
+		{`mdp = Ete2024!`, "Ete2024!"},
+		{`mot_de_passe Ete2024!`, "Ete2024!"},
+		{`contraseña "Verano2024!"`, "Verano2024!"},
+		{`Guarde la clave privada en el almacén`, ""},
+		{`La clave del proyecto es la documentación`, ""},
+		{`mdp oublié pour le compte`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var found []string
+			for _, m := range e.scanText("notes.txt", document{data: []byte(tt.text)}, scanDepth{}) {
+				if strings.HasPrefix(m.PatternName, "Password (") {
+					found = append(found, m.Match)
+				}
+			}
+			if tt.secret == "" {
+				if len(found) != 0 {
+					t.Errorf("found %q in prose", found)
+				}
+				return
+			}
+			if len(found) != 1 || !strings.HasSuffix(found[0], tt.secret) {
+				t.Errorf("found %q, want a match ending in %q", found, tt.secret)
+			}
+		})
+	}
+}
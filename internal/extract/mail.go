@@ -0,0 +1,297 @@
+// mail.go scans exported email: MIME .eml files and Outlook .msg files,
+// including their bodies and attachments.
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// MIME (.eml)
+// =============================================================================
+
+// mailHeaders are the header names used to recognize a MIME message and to
+// build the scanned header document.
+var mailHeaders = []string{"From", "To", "Cc", "Subject", "Date", "Message-Id", "Received", "Mime-Version", "Return-Path"}
+
+// looksLikeMail reports whether text starts with an RFC 5322 header block
+// containing at least two well-known mail headers.
+func looksLikeMail(sample []byte) bool {
+	known := 0
+	sc := bufio.NewScanner(bytes.NewReader(sample))
+	for lines := 0; sc.Scan() && lines < 50; lines++ {
+		line := sc.Text()
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // Folded header continuation
+		}
+
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || strings.ContainsAny(name, " \t") {
+			return false
+		}
+		for _, h := range mailHeaders {
+			if strings.EqualFold(name, h) {
+				known++
+			}
+		}
+	}
+	return known >= 2
+}
+
+// scanMail scans the headers, bodies and attachments of a MIME message.
+func (e *Extractor) scanMail(file, location string, data []byte, depth scanDepth) []types.SecretMatch {
+	if depth.containers >= config.MaxContainerDepth {
+		return nil
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var hdr bytes.Buffer
+	dec := new(mime.WordDecoder)
+	for _, name := range []string{"From", "To", "Cc", "Subject"} {
+		if v := msg.Header.Get(name); v != "" {
+			if decoded, err := dec.DecodeHeader(v); err == nil {
+				v = decoded
+			}
+			fmt.Fprintf(&hdr, "%s: %s\n", name, v)
+		}
+	}
+
+	matches := e.scanText(file, document{location: joinLocation(location, "headers"), data: hdr.Bytes()}, depth)
+
+	depth.containers++
+	part := mimePart{header: msg.Header, body: msg.Body}
+	return append(matches, e.scanMIMEPart(file, location, part, depth)...)
+}
+
+// mimePart is a MIME entity with its raw (still transfer-encoded) body.
+type mimePart struct {
+	header map[string][]string
+	body   io.Reader
+}
+
+func (p mimePart) get(key string) string {
+	if v := p.header[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// scanMIMEPart walks a MIME entity: multiparts recurse, text bodies are
+// scanned in place and attachments go through normal content routing.
+// Each multipart level counts as a container against MaxContainerDepth.
+func (e *Extractor) scanMIMEPart(file, location string, p mimePart, depth scanDepth) []types.SecretMatch {
+	mediaType, params, err := mime.ParseMediaType(p.get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth.containers >= config.MaxContainerDepth {
+			return nil
+		}
+		depth.containers++
+
+		var matches []types.SecretMatch
+		mr := multipart.NewReader(p.body, params["boundary"])
+		for {
+			sub, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			matches = append(matches, e.scanMIMEPart(file, location, mimePart{header: sub.Header, body: sub}, depth)...)
+		}
+		return matches
+	}
+
+	body, err := io.ReadAll(io.LimitReader(transferDecoder(p.get("Content-Transfer-Encoding"), p.body), config.MaxFileSizeForScan))
+	if err != nil && len(body) == 0 {
+		return nil
+	}
+
+	filename := ""
+	if _, dparams, err := mime.ParseMediaType(p.get("Content-Disposition")); err == nil {
+		filename = dparams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	switch {
+	case filename != "":
+		return e.scanContent(file, filename, joinLocation(location, filename), body, depth)
+	case mediaType == "message/rfc822":
+		return e.scanMail(file, joinLocation(location, "message.eml"), body, depth)
+	case mediaType == "text/html":
+		return e.scanText(file, document{location: joinLocation(location, "body.html"), data: htmlToText(body)}, depth)
+	case strings.HasPrefix(mediaType, "text/"):
+		return e.scanText(file, document{location: joinLocation(location, "body"), data: decodeText(body)}, depth)
+	}
+	return nil
+}
+
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// =============================================================================
+// Outlook (.msg)
+// =============================================================================
+
+// MAPI property tags (id + type) read from .msg streams.
+const (
+	msgPropSubject     = "0037"
+	msgPropSenderName  = "0C1A"
+	msgPropSenderEmail = "0C1F"
+	msgPropDisplayTo   = "0E04"
+	msgPropDisplayCc   = "0E03"
+	msgPropHeaders     = "007D"
+	msgPropBody        = "1000"
+	msgPropHTML        = "1013"
+	msgPropAttachData  = "3701"
+	msgPropAttachLong  = "3707"
+	msgPropAttachShort = "3704"
+)
+
+// isMSG reports whether a compound file root looks like an Outlook item.
+func isMSG(root *cfbNode) bool {
+	return root.child("__properties_version1.0") != nil
+}
+
+// scanMSG scans an Outlook message storage: headers, plain and HTML bodies,
+// and attachments (including embedded messages).
+func (e *Extractor) scanMSG(file, location string, c *cfbFile, node *cfbNode, depth scanDepth) []types.SecretMatch {
+	if depth.containers >= config.MaxContainerDepth {
+		return nil
+	}
+
+	var hdr bytes.Buffer
+	for _, f := range []struct{ label, prop string }{
+		{"From", msgPropSenderName}, {"From", msgPropSenderEmail},
+		{"To", msgPropDisplayTo}, {"Cc", msgPropDisplayCc}, {"Subject", msgPropSubject},
+	} {
+		if v := msgString(c, node, f.prop); v != "" {
+			fmt.Fprintf(&hdr, "%s: %s\n", f.label, v)
+		}
+	}
+	if v := msgString(c, node, msgPropHeaders); v != "" {
+		hdr.WriteString(v)
+	}
+
+	matches := e.scanText(file, document{location: joinLocation(location, "headers"), data: hdr.Bytes()}, depth)
+
+	if body := msgString(c, node, msgPropBody); body != "" {
+		matches = append(matches, e.scanText(file, document{location: joinLocation(location, "body"), data: []byte(body)}, depth)...)
+	} else if raw := msgBinary(c, node, msgPropHTML); len(raw) > 0 {
+		matches = append(matches, e.scanText(file, document{location: joinLocation(location, "body.html"), data: htmlToText(raw)}, depth)...)
+	}
+
+	depth.containers++
+	for _, ch := range node.children {
+		if !ch.storage || !strings.HasPrefix(strings.ToLower(ch.name), "__attach_version1.0_") {
+			continue
+		}
+
+		name := msgString(c, ch, msgPropAttachLong)
+		if name == "" {
+			name = msgString(c, ch, msgPropAttachShort)
+		}
+
+		// Embedded messages are stored as a nested storage
+		if sub := ch.child("__substg1.0_" + msgPropAttachData + "000D"); sub != nil && sub.storage {
+			if name == "" {
+				name = "message.msg"
+			}
+			matches = append(matches, e.scanMSG(file, joinLocation(location, name), c, sub, depth)...)
+			continue
+		}
+
+		data := msgBinary(c, ch, msgPropAttachData)
+		if len(data) == 0 {
+			continue
+		}
+		if name == "" {
+			name = "attachment"
+		}
+		matches = append(matches, e.scanContent(file, name, joinLocation(location, name), data, depth)...)
+	}
+
+	return matches
+}
+
+// msgString reads a string property in either its Unicode or ANSI form.
+func msgString(c *cfbFile, node *cfbNode, prop string) string {
+	if data, err := c.read(node.child("__substg1.0_" + prop + "001F")); err == nil {
+		return strings.TrimRight(string(decodeUTF16(data, false)), "\x00")
+	}
+	if data, err := c.read(node.child("__substg1.0_" + prop + "001E")); err == nil {
+		return strings.TrimRight(string(data), "\x00")
+	}
+	return ""
+}
+
+// msgBinary reads a binary property, falling back to its string forms.
+func msgBinary(c *cfbFile, node *cfbNode, prop string) []byte {
+	if data, err := c.read(node.child("__substg1.0_" + prop + "0102")); err == nil {
+		return data
+	}
+	return []byte(msgString(c, node, prop))
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+var (
+	htmlDropRegex  = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	htmlBreakRegex = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])\b[^>]*>`)
+	htmlCellRegex  = regexp.MustCompile(`(?i)</t[dh]>`)
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText flattens HTML into text with one line per block element, so
+// line-based detectors see "Password: x" rather than markup.
+func htmlToText(data []byte) []byte {
+	s := string(decodeText(data))
+	s = htmlDropRegex.ReplaceAllString(s, "")
+	s = strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+	s = htmlBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlCellRegex.ReplaceAllString(s, "\t")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	var out bytes.Buffer
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
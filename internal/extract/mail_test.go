@@ -0,0 +1,51 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// nestedMultipart builds a message whose text body sits inside levels of
+// multipart/mixed entities.
+func nestedMultipart(levels int, body string) []byte {
+	var b strings.Builder
+	b.WriteString("Subject: nested\r\n")
+	for i := 0; i < levels; i++ {
+		fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n", i, i)
+	}
+	b.WriteString("Content-Type: text/plain\r\n\r\n" + body + "\r\n")
+	for i := levels - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "--b%d--\r\n", i)
+	}
+	return []byte(b.String())
+}
+
+func TestScanMailNestedMultipart(t *testing.T) {
+	tests := []struct {
+		levels int
+		found  bool
+	}{
+		{levels: 0, found: true},
+		{levels: 2, found: true}, // mixed, then alternative
+		{levels: 3, found: true},
+		{levels: 1000, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.levels), func(t *testing.T) {
+			data := nestedMultipart(tt.levels, "password = Winter2024!")
+			matches := NewExtractor().scanMail("nested.eml", "", data, scanDepth{})
+
+			var found bool
+			for _, m := range matches {
+				if strings.Contains(m.Match, "Winter2024!") {
+					found = true
+				}
+			}
+			if found != tt.found {
+				t.Errorf("secret under %d multiparts found = %v, want %v", tt.levels, found, tt.found)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+// office.go surfaces the parts of Office documents that are hidden from
+// casual view: hidden sheets and slides, defined names, comments, tracked
+// deletions, hidden text, document properties and embedded objects.
+// Findings in these regions are tagged with the region and rated one
+// severity level higher, as a secret tucked away is rarely an accident.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Regions
+// =============================================================================
+
+// Region tags reported in SecretMatch.Region.
+const (
+	regionHiddenSheet     = "hidden-sheet"
+	regionVeryHiddenSheet = "very-hidden-sheet"
+	regionDefinedName     = "defined-name"
+	regionComment         = "comment"
+	regionThreadedComment = "threaded-comment"
+	regionTrackedDeletion = "tracked-deletion"
+	regionHiddenText      = "hidden-text"
+	regionHiddenSlide     = "hidden-slide"
+	regionDocProperties   = "doc-properties"
+	regionEmbeddedObject  = "embedded-object"
+	regionVBAModule       = "vba-module"
+)
+
+// raiseSeverity returns the next severity up.
+func raiseSeverity(s types.Severity) types.Severity {
+	switch s {
+	case types.SeverityLow:
+		return types.SeverityMedium
+	case types.SeverityMedium:
+		return types.SeverityHigh
+	}
+	return types.SeverityCritical
+}
+
+// tagRegion tags matches that have no region yet with region, raising
+// their severity.
+func tagRegion(matches []types.SecretMatch, region string) {
+	if region == "" {
+		return
+	}
+	for i := range matches {
+		if matches[i].Region == "" {
+			matches[i].Region = region
+			matches[i].Severity = raiseSeverity(matches[i].Severity)
+		}
+	}
+}
+
+// =============================================================================
+// Embedded Objects
+// =============================================================================
+
+// scanOfficeParts scans the binary parts of an Office package: embedded
+// objects and VBA projects. VBA modules are tagged by the VBA handler;
+// anything else found inside an embedding is tagged as embedded.
+func (e *Extractor) scanOfficeParts(file, location string, zr *zip.Reader, depth scanDepth) []types.SecretMatch {
+	if depth.containers >= config.MaxContainerDepth {
+		return nil
+	}
+	depth.containers++
+
+	var matches []types.SecretMatch
+	for _, f := range zr.File {
+		embedded := strings.Contains(f.Name, "/embeddings/")
+		if !embedded && path.Base(f.Name) != "vbaProject.bin" {
+			continue
+		}
+		if f.UncompressedSize64 > config.MaxFileSizeForScan {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			continue
+		}
+
+		found := e.scanContent(file, f.Name, joinLocation(location, f.Name), content, depth)
+		if embedded {
+			tagRegion(found, regionEmbeddedObject)
+		}
+		matches = append(matches, found...)
+	}
+	return matches
+}
+
+// ole10Native unpacks a file embedded with Object Packager: a size, flags,
+// NUL-terminated label and source path, a temporary path and the data.
+func ole10Native(data []byte) (string, []byte, bool) {
+	if len(data) < 6 {
+		return "", nil, false
+	}
+	rest := data[6:]
+
+	cstring := func() (string, bool) {
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			return "", false
+		}
+		s := string(rest[:i])
+		rest = rest[i+1:]
+		return s, true
+	}
+
+	label, ok := cstring()
+	if !ok {
+		return "", nil, false
+	}
+	if _, ok := cstring(); !ok { // Source path
+		return "", nil, false
+	}
+	if len(rest) < 8 {
+		return "", nil, false
+	}
+	tempLen := int(binary.LittleEndian.Uint32(rest[4:]))
+	if tempLen < 0 || 8+tempLen+4 > len(rest) {
+		return "", nil, false
+	}
+	rest = rest[8+tempLen:]
+
+	size := int(binary.LittleEndian.Uint32(rest))
+	if size < 0 || 4+size > len(rest) {
+		return "", nil, false
+	}
+	return label, rest[4 : 4+size], true
+}
+
+// =============================================================================
+// Workbooks
+// =============================================================================
+
+// xlsxSheetRegion returns the region for a worksheet's visibility state.
+func xlsxSheetRegion(state string) string {
+	switch state {
+	case "hidden":
+		return regionHiddenSheet
+	case "veryHidden":
+		return regionVeryHiddenSheet
+	}
+	return ""
+}
+
+// xlsxComments returns the legacy notes and threaded comments attached to
+// a worksheet, located as "Sheet!B4".
+func xlsxComments(zr *zip.Reader, sheet xlsxSheet) []document {
+	rels := partRels(zr, sheet.path)
+	ids := make([]string, 0, len(rels))
+	for id := range rels {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var docs []document
+	for _, id := range ids {
+		rel := rels[id]
+		var item, text, region string
+		switch {
+		case strings.HasSuffix(rel.typ, "/comments"):
+			item, text, region = "comment", "t", regionComment
+		case strings.HasSuffix(rel.typ, "/threadedComment"):
+			item, text, region = "threadedComment", "text", regionThreadedComment
+		default:
+			continue
+		}
+
+		data, err := readZipEntry(zr, rel.target)
+		if err != nil {
+			continue
+		}
+		if doc, ok := cellDocument(sheet.name, xmlRefTexts(data, item, text)); ok {
+			doc.region = region
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// xlsxDefinedNames returns the workbook's defined names as "name=value"
+// lines located as "Names!name". Names often hold connection strings and
+// credentials for formulas, and can be hidden from the Name Manager.
+func xlsxDefinedNames(zr *zip.Reader) (document, bool) {
+	data, err := readZipEntry(zr, "xl/workbook.xml")
+	if err != nil {
+		return document{}, false
+	}
+
+	var wb struct {
+		Names []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"definedNames>definedName"`
+	}
+	if err := xml.Unmarshal(data, &wb); err != nil || len(wb.Names) == 0 {
+		return document{}, false
+	}
+
+	var buf bytes.Buffer
+	var refs []string
+	for _, n := range wb.Names {
+		buf.WriteString(n.Name + "=" + strings.ReplaceAll(n.Value, "\n", " "))
+		buf.WriteByte('\n')
+		refs = append(refs, n.Name)
+	}
+	return document{location: "Names", data: buf.Bytes(), lineRefs: refs, region: regionDefinedName}, true
+}
+
+// xmlRefTexts returns the text of each item element with a "ref"
+// attribute, collected from its text elements.
+func xmlRefTexts(data []byte, item, text string) []xlsxCell {
+	var cells []xlsxCell
+	var cur strings.Builder
+	ref, inText := "", false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case item:
+				ref = xmlAttr(t, "ref")
+				cur.Reset()
+			case text:
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case item:
+				if strings.TrimSpace(cur.String()) != "" {
+					cells = append(cells, xlsxCell{ref: ref, value: cur.String()})
+				}
+			case text:
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	return cells
+}
+
+// =============================================================================
+// Word Documents
+// =============================================================================
+
+// docxText splits WordprocessingML into visible text, tracked deletions
+// (<w:delText>) and text formatted as hidden (<w:vanish/>), one line per
+// paragraph in each.
+func docxText(data []byte) (visible, deleted, hidden []byte) {
+	var bufs [3]bytes.Buffer
+	var paras [3]strings.Builder
+	target, inText, runHidden := -1, false, false
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "r":
+				runHidden = false
+			case "vanish":
+				val := xmlAttr(t, "val")
+				runHidden = val != "0" && val != "false"
+			case "t":
+				inText, target = true, 0
+				if runHidden {
+					target = 2
+				}
+			case "delText":
+				inText, target = true, 1
+			case "tab":
+				paras[0].WriteByte('\t')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t", "delText":
+				inText = false
+			case "p":
+				for i := range paras {
+					if s := strings.TrimSpace(paras[i].String()); s != "" {
+						bufs[i].WriteString(s)
+						bufs[i].WriteByte('\n')
+					}
+					paras[i].Reset()
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paras[target].Write(t)
+			}
+		}
+	}
+	return bufs[0].Bytes(), bufs[1].Bytes(), bufs[2].Bytes()
+}
+
+// =============================================================================
+// Presentations
+// =============================================================================
+
+// pptxHidden reports whether a slide part is hidden from the slide show.
+func pptxHidden(data []byte) bool {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			show := xmlAttr(el, "show")
+			return show == "0" || show == "false"
+		}
+	}
+}
+
+// pptxComments returns legacy (<p:text>) and modern (<a:t>) slide
+// comments, one line per comment paragraph.
+func pptxComments(zr *zip.Reader) []document {
+	var docs []document
+	for _, name := range sortedEntries(zr, "ppt/comments/", ".xml") {
+		data, err := readZipEntry(zr, name)
+		if err != nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		var cur strings.Builder
+		inText := false
+		flush := func() {
+			if s := strings.TrimSpace(cur.String()); s != "" {
+				buf.WriteString(s)
+				buf.WriteByte('\n')
+			}
+			cur.Reset()
+		}
+
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				inText = t.Name.Local == "text" || t.Name.Local == "t"
+			case xml.EndElement:
+				inText = false
+				if t.Name.Local == "text" || t.Name.Local == "p" {
+					flush()
+				}
+			case xml.CharData:
+				if inText {
+					cur.Write(t)
+				}
+			}
+		}
+
+		if buf.Len() > 0 {
+			location := "Comments " + strings.TrimSuffix(path.Base(name), ".xml")
+			docs = append(docs, document{location: location, data: buf.Bytes(), region: regionComment})
+		}
+	}
+	return docs
+}
+
+// =============================================================================
+// Document Properties
+// =============================================================================
+
+// docProperties returns the core, extended and custom document properties
+// as "name: value" lines located as "Properties!name".
+func docProperties(zr *zip.Reader) (document, bool) {
+	var buf bytes.Buffer
+	var refs []string
+
+	for _, part := range []string{"docProps/core.xml", "docProps/app.xml", "docProps/custom.xml"} {
+		data, err := readZipEntry(zr, part)
+		if err != nil {
+			continue
+		}
+
+		// Custom properties are named by attribute, the rest by element
+		var name, property string
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				name = t.Name.Local
+				if name == "property" {
+					property = xmlAttr(t, "name")
+				}
+			case xml.EndElement:
+				if t.Name.Local == "property" {
+					property = ""
+				}
+			case xml.CharData:
+				value := strings.TrimSpace(string(t))
+				if value == "" {
+					continue
+				}
+				if property != "" {
+					name = property
+				}
+				buf.WriteString(name + ": " + strings.ReplaceAll(value, "\n", " "))
+				buf.WriteByte('\n')
+				refs = append(refs, name)
+			}
+		}
+	}
+
+	if len(refs) == 0 {
+		return document{}, false
+	}
+	return document{location: "Properties", data: buf.Bytes(), lineRefs: refs, region: regionDocProperties}, true
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+type partRel struct {
+	typ    string
+	target string
+}
+
+// partRels returns the relationships of a package part, with targets
+// resolved to part paths.
+func partRels(zr *zip.Reader, partPath string) map[string]partRel {
+	dir, base := path.Split(partPath)
+	data, err := readZipEntry(zr, path.Join(dir, "_rels", base+".rels"))
+	if err != nil {
+		return nil
+	}
+
+	var r struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Type   string `xml:"Type,attr"`
+			Target string `xml:"Target,attr"`
+			Mode   string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if xml.Unmarshal(data, &r) != nil {
+		return nil
+	}
+
+	rels := make(map[string]partRel, len(r.Relationships))
+	for _, rel := range r.Relationships {
+		if rel.Mode == "External" {
+			continue
+		}
+		rels[rel.ID] = partRel{typ: rel.Type, target: resolvePartPath(strings.TrimSuffix(dir, "/"), rel.Target)}
+	}
+	return rels
+}
+
+// cellDocument builds a document with one line per cell, located as
+// "Sheet!A1".
+func cellDocument(location string, cells []xlsxCell) (document, bool) {
+	var buf bytes.Buffer
+	var refs []string
+	for _, c := range cells {
+		buf.WriteString(strings.ReplaceAll(c.value, "\n", " "))
+		buf.WriteByte('\n')
+		refs = append(refs, c.ref)
+	}
+	return document{location: location, data: buf.Bytes(), lineRefs: refs}, len(refs) > 0
+}
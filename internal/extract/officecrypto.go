@@ -0,0 +1,523 @@
+// officecrypto.go recognizes password-protected Office documents
+// (MS-OFFCRYPTO) and decrypts ECMA-376 Agile and Standard encryption.
+package extract
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// Encrypted OOXML
+// =============================================================================
+
+// Block keys that separate the keys derived from one password hash
+// (MS-OFFCRYPTO 2.3.4.13).
+var (
+	agileVerifierInputBlock = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	agileVerifierValueBlock = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	agileKeyValueBlock      = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+)
+
+const (
+	agileSegmentSize  = 4096
+	standardSpinCount = 50000
+	standardAlgAES128 = 0x660E
+	standardAlgAES256 = 0x6610
+	standardFlagAES   = 0x20
+)
+
+// officeEncryption recognizes an OOXML document encrypted into a compound
+// file: an EncryptionInfo stream describing the scheme and an
+// EncryptedPackage stream holding the encrypted zip.
+func officeEncryption(c *cfbFile, root *cfbNode) (protectedContainer, bool) {
+	info, err := c.read(root.child("EncryptionInfo"))
+	if err != nil || len(info) < 8 {
+		return nil, false
+	}
+	pkg, err := c.read(root.child("EncryptedPackage"))
+	if err != nil || len(pkg) < 8 {
+		return nil, false
+	}
+
+	major := binary.LittleEndian.Uint16(info)
+	minor := binary.LittleEndian.Uint16(info[2:])
+	switch {
+	case major == 4 && minor == 4:
+		if a, err := parseAgileInfo(info[8:], pkg); err == nil {
+			return a, true
+		}
+	case (major == 2 || major == 3 || major == 4) && minor == 2:
+		if s, err := parseStandardInfo(info[8:], pkg); err == nil {
+			return s, true
+		}
+	}
+
+	return lockedContainer{&types.Protection{
+		Format: "Office",
+		Scheme: fmt.Sprintf("ECMA-376 encryption %d.%d", major, minor),
+	}}, true
+}
+
+// lockedContainer is a protected container in a scheme that is reported
+// but cannot be opened.
+type lockedContainer struct {
+	p *types.Protection
+}
+
+func (l lockedContainer) protection() *types.Protection { return l.p }
+
+func (l lockedContainer) open(string) ([]protectedEntry, bool) { return nil, false }
+
+// =============================================================================
+// Agile Encryption
+// =============================================================================
+
+// agileParams are the cipher and hash parameters shared by the keyData
+// and encryptedKey elements of an Agile EncryptionInfo.
+type agileParams struct {
+	SaltSize        int    `xml:"saltSize,attr"`
+	BlockSize       int    `xml:"blockSize,attr"`
+	KeyBits         int    `xml:"keyBits,attr"`
+	HashSize        int    `xml:"hashSize,attr"`
+	CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+	CipherChaining  string `xml:"cipherChaining,attr"`
+	HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+	SaltValue       string `xml:"saltValue,attr"`
+}
+
+type agileKeyEncryptor struct {
+	agileParams
+	SpinCount                  int    `xml:"spinCount,attr"`
+	EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+	EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+	EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+}
+
+// agileDocument is a document with Agile encryption (MS-OFFCRYPTO 2.3.4.10),
+// the default since Office 2010.
+type agileDocument struct {
+	p       *types.Protection
+	pkg     []byte
+	keyData agileParams
+	key     agileKeyEncryptor
+
+	keySalt, verifierInput, verifierValue, keyValue []byte
+	newHash                                         func() hash.Hash
+}
+
+func parseAgileInfo(xmlData, pkg []byte) (*agileDocument, error) {
+	var enc struct {
+		KeyData       agileParams `xml:"keyData"`
+		KeyEncryptors []struct {
+			URI          string            `xml:"uri,attr"`
+			EncryptedKey agileKeyEncryptor `xml:"encryptedKey"`
+		} `xml:"keyEncryptors>keyEncryptor"`
+	}
+	if err := xml.Unmarshal(xmlData, &enc); err != nil {
+		return nil, err
+	}
+
+	a := &agileDocument{pkg: pkg, keyData: enc.KeyData}
+	for _, ke := range enc.KeyEncryptors {
+		if strings.HasSuffix(ke.URI, "/password") {
+			a.key = ke.EncryptedKey
+		}
+	}
+
+	a.p = &types.Protection{
+		Format: "Office",
+		Scheme: fmt.Sprintf("Agile %s-%d", a.keyData.CipherAlgorithm, a.keyData.KeyBits),
+		KDF:    fmt.Sprintf("%s x%d", a.key.HashAlgorithm, a.key.SpinCount),
+	}
+
+	a.newHash = officeHash(a.key.HashAlgorithm)
+	var err error
+	decode := func(s string) []byte {
+		b, e := base64.StdEncoding.DecodeString(s)
+		if e != nil {
+			err = e
+		}
+		return b
+	}
+	a.keySalt = decode(a.key.SaltValue)
+	a.verifierInput = decode(a.key.EncryptedVerifierHashInput)
+	a.verifierValue = decode(a.key.EncryptedVerifierHashValue)
+	a.keyValue = decode(a.key.EncryptedKeyValue)
+
+	// Only AES-CBC with a known hash and in-spec sizes and spin count is
+	// opened; anything else is still reported
+	a.p.Openable = err == nil && a.newHash != nil && officeHash(a.keyData.HashAlgorithm) != nil &&
+		a.key.SpinCount <= config.MaxOfficeSpinCount && a.key.SaltSize > 0 && a.key.HashSize > 0 &&
+		aesKeyBits(a.key.KeyBits) && aesKeyBits(a.keyData.KeyBits) &&
+		a.key.BlockSize == aes.BlockSize && a.keyData.BlockSize == aes.BlockSize &&
+		a.key.CipherAlgorithm == "AES" && a.keyData.CipherAlgorithm == "AES" &&
+		a.key.CipherChaining == "ChainingModeCBC" && a.keyData.CipherChaining == "ChainingModeCBC"
+	return a, nil
+}
+
+func (a *agileDocument) protection() *types.Protection { return a.p }
+
+// open derives the password hash, checks it against the encrypted verifier
+// and decrypts the package with the intermediate key it unwraps.
+func (a *agileDocument) open(password string) ([]protectedEntry, bool) {
+	h := a.newHash()
+	h.Write(a.keySalt)
+	h.Write(utf16LE(password))
+	sum := h.Sum(nil)
+
+	var iter [4]byte
+	for i := 0; i < a.key.SpinCount; i++ {
+		binary.LittleEndian.PutUint32(iter[:], uint32(i))
+		h.Reset()
+		h.Write(iter[:])
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+
+	keyLen := a.key.KeyBits / 8
+	derive := func(block []byte) []byte {
+		h.Reset()
+		h.Write(sum)
+		h.Write(block)
+		return fitSize(h.Sum(nil), keyLen, 0x36)
+	}
+	iv := fitSize(a.keySalt, a.key.BlockSize, 0x36)
+
+	input, err := aesCBCRaw(derive(agileVerifierInputBlock), iv, a.verifierInput)
+	if err != nil || len(input) < a.key.SaltSize {
+		return nil, false
+	}
+	value, err := aesCBCRaw(derive(agileVerifierValueBlock), iv, a.verifierValue)
+	if err != nil || len(value) < a.key.HashSize {
+		return nil, false
+	}
+	h.Reset()
+	h.Write(input[:a.key.SaltSize])
+	if a.key.HashSize > h.Size() || !bytes.Equal(h.Sum(nil)[:a.key.HashSize], value[:a.key.HashSize]) {
+		return nil, false
+	}
+
+	key, err := aesCBCRaw(derive(agileKeyValueBlock), iv, a.keyValue)
+	if err != nil || len(key) < a.keyData.KeyBits/8 {
+		return nil, false
+	}
+	pkg, err := a.decryptPackage(key[:a.keyData.KeyBits/8])
+	if err != nil {
+		return nil, false
+	}
+	return []protectedEntry{{data: pkg}}, true
+}
+
+// decryptPackage decrypts the package in 4096-byte segments, each with an
+// IV derived from the keyData salt and the segment index.
+func (a *agileDocument) decryptPackage(key []byte) ([]byte, error) {
+	size, body, err := encryptedPackage(a.pkg)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(a.keyData.SaltValue)
+	if err != nil {
+		return nil, err
+	}
+
+	newHash := officeHash(a.keyData.HashAlgorithm)
+	out := make([]byte, 0, len(body))
+	var idx [4]byte
+	for i := 0; len(body) > 0; i++ {
+		n := min(len(body), agileSegmentSize)
+		binary.LittleEndian.PutUint32(idx[:], uint32(i))
+		h := newHash()
+		h.Write(salt)
+		h.Write(idx[:])
+
+		segment, err := aesCBCRaw(key, fitSize(h.Sum(nil), a.keyData.BlockSize, 0x36), body[:n])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segment...)
+		body = body[n:]
+	}
+	return out[:min(size, len(out))], nil
+}
+
+// =============================================================================
+// Standard Encryption
+// =============================================================================
+
+// standardDocument is a document with Standard encryption (MS-OFFCRYPTO
+// 2.3.4.5): AES-ECB with a SHA-1 key derivation, used by Office 2007.
+type standardDocument struct {
+	p      *types.Protection
+	pkg    []byte
+	keyLen int
+
+	salt, verifier, verifierHash []byte
+}
+
+func parseStandardInfo(data, pkg []byte) (*standardDocument, error) {
+	if len(data) < 4 {
+		return nil, errors.New("truncated encryption info")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	if headerSize < 24 || 4+headerSize+4+16+16+4 > len(data) {
+		return nil, errors.New("truncated encryption header")
+	}
+	header := data[4 : 4+headerSize]
+	flags := binary.LittleEndian.Uint32(header)
+	algID := binary.LittleEndian.Uint32(header[8:])
+	keyBits := int(binary.LittleEndian.Uint32(header[16:]))
+
+	s := &standardDocument{pkg: pkg, keyLen: keyBits / 8}
+	verifier := data[4+headerSize:]
+	saltSize := int(binary.LittleEndian.Uint32(verifier))
+	if saltSize != 16 {
+		return nil, errors.New("unexpected salt size")
+	}
+	s.salt = verifier[4:20]
+	s.verifier = verifier[20:36]
+	s.verifierHash = verifier[40:]
+
+	isAES := flags&standardFlagAES != 0 && algID >= standardAlgAES128 && algID <= standardAlgAES256
+	scheme := fmt.Sprintf("Standard algorithm 0x%04X", algID)
+	if isAES {
+		if s.keyLen == 0 {
+			s.keyLen = 16
+		}
+		scheme = fmt.Sprintf("Standard AES-%d", s.keyLen*8)
+	}
+
+	s.p = &types.Protection{
+		Format:   "Office",
+		Scheme:   scheme,
+		KDF:      fmt.Sprintf("SHA1 x%d", standardSpinCount),
+		Openable: isAES && aesKeyBits(s.keyLen*8) && len(s.verifierHash) >= 32,
+	}
+	return s, nil
+}
+
+func (s *standardDocument) protection() *types.Protection { return s.p }
+
+// open derives the key (MS-OFFCRYPTO 2.3.4.7), checks the verifier and
+// decrypts the package.
+func (s *standardDocument) open(password string) ([]protectedEntry, bool) {
+	h := sha1.New()
+	h.Write(s.salt)
+	h.Write(utf16LE(password))
+	sum := h.Sum(nil)
+
+	var iter [4]byte
+	for i := 0; i < standardSpinCount; i++ {
+		binary.LittleEndian.PutUint32(iter[:], uint32(i))
+		h.Reset()
+		h.Write(iter[:])
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+	h.Reset()
+	h.Write(sum)
+	h.Write([]byte{0, 0, 0, 0}) // Block 0
+	final := h.Sum(nil)
+
+	derived := make([]byte, 0, 2*sha1.Size)
+	for _, pad := range []byte{0x36, 0x5c} {
+		buf := bytes.Repeat([]byte{pad}, 64)
+		for i, b := range final {
+			buf[i] ^= b
+		}
+		x := sha1.Sum(buf)
+		derived = append(derived, x[:]...)
+	}
+	key := derived[:s.keyLen]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, false
+	}
+	verifier := ecbDecrypt(block, s.verifier)
+	verifierHash := ecbDecrypt(block, s.verifierHash[:32])
+	if want := sha1.Sum(verifier); !bytes.Equal(want[:], verifierHash[:sha1.Size]) {
+		return nil, false
+	}
+
+	size, body, err := encryptedPackage(s.pkg)
+	if err != nil {
+		return nil, false
+	}
+	pkg := ecbDecrypt(block, body)
+	return []protectedEntry{{data: pkg[:min(size, len(pkg))]}}, true
+}
+
+// =============================================================================
+// Legacy Binary Formats
+// =============================================================================
+
+// legacyOfficeEncryption recognizes Word and Excel 97-2003 documents
+// protected with RC4 or XOR obfuscation. These are reported only.
+func legacyOfficeEncryption(c *cfbFile, root *cfbNode) *types.Protection {
+	if data, err := c.read(root.child("WordDocument")); err == nil {
+		if scheme := wordEncryption(c, root, data); scheme != "" {
+			return &types.Protection{Format: "Office", Scheme: "Word 97-2003 " + scheme}
+		}
+	}
+	if data, err := c.read(root.child("Workbook")); err == nil {
+		if scheme := excelEncryption(data); scheme != "" {
+			return &types.Protection{Format: "Office", Scheme: "Excel 97-2003 " + scheme}
+		}
+	}
+	return nil
+}
+
+// wordEncryption reads the fEncrypted and fObfuscated flags of the File
+// Information Block and, for RC4, the version from the table stream.
+func wordEncryption(c *cfbFile, root *cfbNode, doc []byte) string {
+	if len(doc) < 12 || binary.LittleEndian.Uint16(doc) != 0xA5EC {
+		return ""
+	}
+	flags := binary.LittleEndian.Uint16(doc[0x0A:])
+	switch {
+	case flags&0x0100 == 0:
+		return ""
+	case flags&0x8000 != 0:
+		return "XOR obfuscation"
+	}
+
+	table := "0Table"
+	if flags&0x0200 != 0 {
+		table = "1Table"
+	}
+	data, err := c.read(root.child(table))
+	if err != nil {
+		return "RC4"
+	}
+	return rc4Version(data)
+}
+
+// excelEncryption looks for a FILEPASS record in the workbook globals.
+func excelEncryption(data []byte) string {
+	for pos := 0; pos+4 <= len(data); {
+		typ := binary.LittleEndian.Uint16(data[pos:])
+		size := int(binary.LittleEndian.Uint16(data[pos+2:]))
+		body := data[pos+4 : min(pos+4+size, len(data))]
+		pos += 4 + size
+
+		switch typ {
+		case 0x002F: // FILEPASS
+			if len(body) >= 2 && binary.LittleEndian.Uint16(body) == 0 {
+				return "XOR obfuscation"
+			}
+			if len(body) >= 6 {
+				return rc4Version(body[2:])
+			}
+			return "RC4"
+		case 0x000A: // EOF of the globals substream
+			return ""
+		}
+	}
+	return ""
+}
+
+// rc4Version names the RC4 variant from an EncryptionVersionInfo.
+func rc4Version(data []byte) string {
+	if len(data) >= 4 && binary.LittleEndian.Uint16(data) >= 2 {
+		return "RC4 CryptoAPI"
+	}
+	return "RC4"
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// officeHash returns the hash named by an Agile hashAlgorithm attribute.
+func officeHash(name string) func() hash.Hash {
+	switch name {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA384":
+		return sha512.New384
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+func aesKeyBits(bits int) bool {
+	return bits == 128 || bits == 192 || bits == 256
+}
+
+// encryptedPackage splits an EncryptedPackage stream into the size of the
+// decrypted package and the ciphertext, trimmed to whole AES blocks.
+func encryptedPackage(data []byte) (int, []byte, error) {
+	if len(data) < 8 {
+		return 0, nil, errors.New("truncated encrypted package")
+	}
+	size := binary.LittleEndian.Uint64(data)
+	if size > config.MaxFileSizeForScan {
+		return 0, nil, errors.New("encrypted package too large")
+	}
+	body := data[8:]
+	return int(size), body[:len(body)&^(aes.BlockSize-1)], nil
+}
+
+// fitSize truncates b to size or pads it with pad.
+func fitSize(b []byte, size int, pad byte) []byte {
+	if len(b) >= size {
+		return b[:size]
+	}
+	out := append([]byte(nil), b...)
+	for len(out) < size {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// aesCBCRaw decrypts whole blocks with AES-CBC, without removing padding.
+func aesCBCRaw(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid ciphertext")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
+
+// ecbDecrypt decrypts whole blocks in ECB mode.
+func ecbDecrypt(block cipher.Block, data []byte) []byte {
+	bs := block.BlockSize()
+	out := make([]byte, len(data)&^(bs-1))
+	for i := 0; i < len(out); i += bs {
+		block.Decrypt(out[i:i+bs], data[i:i+bs])
+	}
+	return out
+}
+
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(out[2*i:], u)
+	}
+	return out
+}
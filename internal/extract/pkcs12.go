@@ -0,0 +1,586 @@
+// pkcs12.go implements an offline PKCS#12 (PFX) reader with the password-based
+// encryption schemes seen in Windows, OpenSSL and Java exports.
+package extract
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+
+	"github.com/loosehose/azonk/internal/config"
+)
+
+// =============================================================================
+// ASN.1 Structures (RFC 7292)
+// =============================================================================
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidPBEWithSHA3DES      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHA40BitRC2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBEWithSHA128BitRC2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1        = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC          = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// errWrongPassword is returned when a password fails MAC or padding checks.
+var errWrongPassword = errors.New("wrong password")
+
+// errIterationLimit is returned when a key derivation asks for more
+// iterations than config.MaxPKCS12Iterations.
+var errIterationLimit = errors.New("iteration count over the limit")
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm algorithmIdentifier
+	Digest    []byte
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm algorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue     `asn1:"tag:0,explicit"`
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                 `asn1:"optional"`
+	PRF        algorithmIdentifier `asn1:"optional"`
+}
+
+// =============================================================================
+// PFX Parsing
+// =============================================================================
+
+// pfxContents holds whatever could be read from a PFX with a given password.
+type pfxContents struct {
+	certs []*x509.Certificate
+	keys  []any
+}
+
+// parsePFXHeader decodes the outer PFX structure and returns the raw
+// authenticated-safe bytes that the MAC covers.
+func parsePFXHeader(data []byte) (*pfxPDU, []byte, error) {
+	var pfx pfxPDU
+	rest, err := asn1.Unmarshal(data, &pfx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 || pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, errors.New("not a PKCS#12 file")
+	}
+
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, fmt.Errorf("auth safe: %w", err)
+	}
+	return &pfx, authSafe, nil
+}
+
+// verifyPFXMac checks a password against the PFX integrity MAC. PFX files
+// without a MAC accept any password here and fail later at decryption.
+func verifyPFXMac(pfx *pfxPDU, authSafe []byte, password string) bool {
+	if pfx.MacData.Mac.Algorithm.Algorithm == nil {
+		return true
+	}
+	if checkIterations(pfx.MacData.Iterations) != nil {
+		return false
+	}
+
+	newHash := hashForOID(pfx.MacData.Mac.Algorithm.Algorithm)
+	if newHash == nil {
+		return false
+	}
+
+	for _, pw := range bmpPasswords(password) {
+		key := pkcs12KDF(newHash, pw, pfx.MacData.MacSalt, 3, pfx.MacData.Iterations, newHash().Size())
+		mac := hmac.New(newHash, key)
+		mac.Write(authSafe)
+		if hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodePFX decrypts the safe contents of a PFX with a password already
+// accepted by verifyPFXMac.
+func decodePFX(authSafe []byte, password string) (*pfxContents, error) {
+	var infos []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &infos); err != nil {
+		return nil, fmt.Errorf("content infos: %w", err)
+	}
+
+	out := &pfxContents{}
+	for _, ci := range infos {
+		var bagsDER []byte
+
+		switch {
+		case ci.ContentType.Equal(oidData):
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &bagsDER); err != nil {
+				return nil, err
+			}
+		case ci.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+				return nil, err
+			}
+			plain, err := pbeDecrypt(ed.EncryptedContentInfo.ContentEncryptionAlgorithm,
+				ed.EncryptedContentInfo.EncryptedContent, password)
+			if err != nil {
+				return nil, err
+			}
+			bagsDER = plain
+		default:
+			continue
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(bagsDER, &bags); err != nil {
+			return nil, fmt.Errorf("safe bags: %w", err)
+		}
+
+		for _, bag := range bags {
+			if err := out.addBag(bag, password); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (c *pfxContents) addBag(bag safeBag, password string) error {
+	switch {
+	case bag.ID.Equal(oidCertBag):
+		var cb certBag
+		if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+			return err
+		}
+		if !cb.ID.Equal(oidX509Certificate) {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(cb.Data)
+		if err != nil {
+			return err
+		}
+		c.certs = append(c.certs, cert)
+
+	case bag.ID.Equal(oidShroudedKeyBag):
+		plain, err := decryptPKCS8(bag.Value.Bytes, password)
+		if err != nil {
+			return err
+		}
+		key, err := parsePrivateKeyDER(plain)
+		if err != nil {
+			return err
+		}
+		c.keys = append(c.keys, key)
+
+	case bag.ID.Equal(oidKeyBag):
+		key, err := parsePrivateKeyDER(bag.Value.Bytes)
+		if err != nil {
+			return err
+		}
+		c.keys = append(c.keys, key)
+	}
+	return nil
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo structure.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var epki encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &epki); err != nil {
+		return nil, err
+	}
+	return pbeDecrypt(epki.Algorithm, epki.EncryptedData, password)
+}
+
+// =============================================================================
+// Password-Based Encryption
+// =============================================================================
+
+// pbeDecrypt decrypts data under the PKCS#12 PBE or PKCS#5 PBES2 scheme
+// named by alg. A padding failure is reported as errWrongPassword.
+func pbeDecrypt(alg algorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+
+	switch {
+	case alg.Algorithm.Equal(oidPBEWithSHA3DES), alg.Algorithm.Equal(oidPBEWithSHA40BitRC2),
+		alg.Algorithm.Equal(oidPBEWithSHA128BitRC2):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if err := checkIterations(params.Iterations); err != nil {
+			return nil, err
+		}
+
+		// Legacy schemes use the BMPString password; try both encodings
+		// of the empty password before giving up.
+		for _, pw := range bmpPasswords(password) {
+			plain, err := legacyPBEDecrypt(alg.Algorithm, params, pw, data)
+			if err == nil {
+				return plain, nil
+			}
+		}
+		return nil, errWrongPassword
+
+	case alg.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+			return nil, errors.New("unsupported PBES2 key derivation")
+		}
+
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, err
+		}
+		if err := checkIterations(kdf.Iterations); err != nil {
+			return nil, err
+		}
+
+		prf := sha1.New
+		if kdf.PRF.Algorithm != nil {
+			prf = hmacHashForOID(kdf.PRF.Algorithm)
+			if prf == nil {
+				return nil, errors.New("unsupported PBKDF2 PRF")
+			}
+		}
+
+		var keyLen int
+		switch scheme := params.EncryptionScheme.Algorithm; {
+		case scheme.Equal(oidAES128CBC):
+			keyLen = 16
+		case scheme.Equal(oidAES192CBC):
+			keyLen = 24
+		case scheme.Equal(oidAES256CBC):
+			keyLen = 32
+		case scheme.Equal(oidDESEDE3CBC):
+			keyLen = 24
+		default:
+			return nil, errors.New("unsupported PBES2 cipher")
+		}
+
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+
+		key := pbkdf2([]byte(password), kdf.Salt, kdf.Iterations, keyLen, prf)
+		var err error
+		if params.EncryptionScheme.Algorithm.Equal(oidDESEDE3CBC) {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block, err = aes.NewCipher(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported encryption %v", alg.Algorithm)
+	}
+
+	return cbcDecrypt(block, iv, data)
+}
+
+func legacyPBEDecrypt(oid asn1.ObjectIdentifier, params pbeParams, pw, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+
+	switch {
+	case oid.Equal(oidPBEWithSHA3DES):
+		key := pkcs12KDF(sha1.New, pw, params.Salt, 1, params.Iterations, 24)
+		block, err = des.NewTripleDESCipher(key)
+	case oid.Equal(oidPBEWithSHA40BitRC2):
+		key := pkcs12KDF(sha1.New, pw, params.Salt, 1, params.Iterations, 5)
+		block, err = newRC2Cipher(key, 40)
+	default:
+		key := pkcs12KDF(sha1.New, pw, params.Salt, 1, params.Iterations, 16)
+		block, err = newRC2Cipher(key, 128)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	iv := pkcs12KDF(sha1.New, pw, params.Salt, 2, params.Iterations, 8)
+	return cbcDecrypt(block, iv, data)
+}
+
+// cbcDecrypt decrypts and strips PKCS#7 padding.
+func cbcDecrypt(block cipher.Block, iv, data []byte) ([]byte, error) {
+	bs := block.BlockSize()
+	if len(iv) != bs || len(data) == 0 || len(data)%bs != 0 {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > bs {
+		return nil, errWrongPassword
+	}
+	for _, b := range out[len(out)-pad:] {
+		if int(b) != pad {
+			return nil, errWrongPassword
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// =============================================================================
+// Key Derivation
+// =============================================================================
+
+// pkcs12KDF implements the PKCS#12 key derivation (RFC 7292 appendix B.2).
+// id selects the purpose: 1 = key, 2 = IV, 3 = MAC key.
+func pkcs12KDF(newHash func() hash.Hash, password, salt []byte, id byte, iterations, size int) []byte {
+	h := newHash()
+	v := h.BlockSize()
+
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+
+	fill := func(src []byte) []byte {
+		if len(src) == 0 {
+			return nil
+		}
+		n := v * ((len(src) + v - 1) / v)
+		out := make([]byte, n)
+		for i := range out {
+			out[i] = src[i%len(src)]
+		}
+		return out
+	}
+	I := append(fill(salt), fill(password)...)
+
+	one := big.NewInt(1)
+	out := make([]byte, 0, size)
+	for len(out) < size {
+		h.Reset()
+		h.Write(D)
+		h.Write(I)
+		A := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(A)
+			A = h.Sum(A[:0])
+		}
+		out = append(out, A...)
+
+		if len(out) >= size {
+			break
+		}
+
+		// I_j = (I_j + B + 1) mod 2^(8v) for each v-byte block of I
+		B := new(big.Int).SetBytes(fill(A)[:v])
+		B.Add(B, one)
+		for j := 0; j < len(I); j += v {
+			Ij := new(big.Int).SetBytes(I[j : j+v])
+			Ij.Add(Ij, B)
+			b := Ij.Bytes()
+			if len(b) > v {
+				b = b[len(b)-v:]
+			}
+			chunk := I[j : j+v]
+			for k := range chunk {
+				chunk[k] = 0
+			}
+			copy(chunk[v-len(b):], b)
+		}
+	}
+
+	return out[:size]
+}
+
+// pbkdf2 implements PBKDF2 (RFC 8018 section 5.2).
+func pbkdf2(password, salt []byte, iterations, keyLen int, newHash func() hash.Hash) []byte {
+	prf := hmac.New(newHash, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	out := make([]byte, 0, blocks*hashLen)
+	buf := make([]byte, 4)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		buf[0], buf[1], buf[2], buf[3] = byte(block>>24), byte(block>>16), byte(block>>8), byte(block)
+		prf.Write(buf)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// checkIterations rejects key derivations too slow to try every candidate
+// password against.
+func checkIterations(n int) error {
+	if n > config.MaxPKCS12Iterations {
+		return fmt.Errorf("%w: %d KDF iterations exceed the limit of %d", errIterationLimit, n, config.MaxPKCS12Iterations)
+	}
+	return nil
+}
+
+// bmpPasswords encodes a password as a NUL-terminated BMPString. The empty
+// password is ambiguous in the wild, so both encodings are returned.
+func bmpPasswords(password string) [][]byte {
+	if password == "" {
+		return [][]byte{nil, {0, 0}}
+	}
+
+	units := utf16.Encode([]rune(password))
+	out := make([]byte, 0, 2*len(units)+2)
+	for _, u := range units {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return [][]byte{append(out, 0, 0)}
+}
+
+func hashForOID(oid asn1.ObjectIdentifier) func() hash.Hash {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New
+	case oid.Equal(oidSHA256):
+		return sha256.New
+	case oid.Equal(oidSHA384):
+		return sha512.New384
+	case oid.Equal(oidSHA512):
+		return sha512.New
+	}
+	return nil
+}
+
+func hmacHashForOID(oid asn1.ObjectIdentifier) func() hash.Hash {
+	switch {
+	case oid.Equal(oidHMACWithSHA1):
+		return sha1.New
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New
+	}
+	return nil
+}
+
+// parsePrivateKeyDER parses PKCS#8, PKCS#1 or SEC 1 private keys.
+func parsePrivateKeyDER(der []byte) (any, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unrecognized private key")
+}
@@ -0,0 +1,102 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pkcs12Password is the password testdata/pkcs12/gen.sh encrypts every
+// fixture with.
+const pkcs12Password = "Winter2024!"
+
+func readPKCS12Fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "pkcs12", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestOpenKeyMaterial(t *testing.T) {
+	tests := []struct {
+		file      string
+		format    string
+		hasCert   bool
+		withMAC   bool // a wrong password is detected without decrypting
+		noLimit   bool // iterations within config.MaxPKCS12Iterations
+		plaintext bool
+	}{
+		{file: "aes256.pfx", format: "PKCS#12", hasCert: true, withMAC: true, noLimit: true},
+		{file: "legacy-rc2.pfx", format: "PKCS#12", hasCert: true, withMAC: true, noLimit: true},
+		{file: "legacy-rc2-128.pfx", format: "PKCS#12", hasCert: true, withMAC: true, noLimit: true},
+		{file: "legacy-3des.pfx", format: "PKCS#12", hasCert: true, withMAC: true, noLimit: true},
+		{file: "nomac.pfx", format: "PKCS#12", hasCert: true, noLimit: true},
+		{file: "pkcs8.pem", format: "PEM", noLimit: true},
+		{file: "manyiter.pfx", format: "PKCS#12", withMAC: true},
+		{file: "manyiter-pkcs8.pem", format: "PEM"},
+		{file: "key.pem", format: "PEM", noLimit: true, plaintext: true},
+	}
+
+	for _, tt := range tests {
+		data := readPKCS12Fixture(t, tt.file)
+
+		t.Run(tt.file+"/right password", func(t *testing.T) {
+			start := time.Now()
+			km := openKeyMaterial(data, []string{"Summer2024!", pkcs12Password})
+			if km == nil {
+				t.Fatal("not recognized as key material")
+			}
+			if km.Format != tt.format {
+				t.Errorf("Format = %q, want %q", km.Format, tt.format)
+			}
+
+			switch {
+			case tt.plaintext:
+				if km.Protected || !km.HasPrivateKey || km.KeyType != "ECDSA P-256" {
+					t.Errorf("plaintext key: %+v", km)
+				}
+			case !tt.noLimit:
+				if !km.Protected || km.Opened || km.Unopenable == "" {
+					t.Errorf("over the iteration limit, want protected and unopenable: %+v", km)
+				}
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("took %v to give up on an over-limit file", elapsed)
+				}
+			default:
+				if !km.Protected || !km.Opened || km.Password != pkcs12Password {
+					t.Fatalf("want opened with %q: %+v", pkcs12Password, km)
+				}
+				if !km.HasPrivateKey || km.KeyType != "ECDSA P-256" {
+					t.Errorf("key = %v %q, want ECDSA P-256", km.HasPrivateKey, km.KeyType)
+				}
+				if tt.hasCert && (len(km.Certificates) != 1 || km.Certificates[0].Subject != "CN=azonk-test") {
+					t.Errorf("certificates = %+v, want CN=azonk-test", km.Certificates)
+				}
+			}
+		})
+
+		if tt.plaintext {
+			continue
+		}
+
+		t.Run(tt.file+"/wrong password", func(t *testing.T) {
+			km := openKeyMaterial(data, []string{"Summer2024!"})
+			if km == nil {
+				t.Fatal("locked file dropped from results")
+			}
+			if !km.Protected || km.Opened || km.Password != "" {
+				t.Errorf("want locked: %+v", km)
+			}
+			if tt.withMAC && tt.hasCert && len(km.Certificates) != 0 {
+				t.Errorf("certificates read without the password: %+v", km.Certificates)
+			}
+			if _, got := describeKeyMaterial(km); !strings.Contains(got, "password protected") {
+				t.Errorf("description %q does not say password protected", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// pool.go scans files concurrently across a bounded set of goroutines.
+package extract
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// scanResult carries one file's outcome back from a worker.
+type scanResult struct {
+	idx     int
+	matches []types.SecretMatch
+	bytes   int64
+	err     error
+}
+
+// scanFunc scans one file, returning its matches and the bytes read.
+// Protected content it cannot open is collected in pending.
+type scanFunc func(path string, pending *pendingSet) ([]types.SecretMatch, int64, error)
+
+// scanFiles scans paths across the worker pool and returns the matches for
+// each path in input order. The optional tag callback runs on the calling
+// goroutine as each file completes, before its findings are reported.
+func (e *Extractor) scanFiles(paths []string, tag func(idx int, matches []types.SecretMatch)) [][]types.SecretMatch {
+	return e.runPool(paths, e.scanFile, tag, nil)
+}
+
+// runPool scans paths with scan across the worker pool. The optional
+// progress callback runs on the calling goroutine after every file with
+// the count of files done and bytes read so far.
+func (e *Extractor) runPool(paths []string, scan scanFunc, tag func(idx int, matches []types.SecretMatch), progress func(done int, bytes int64)) [][]types.SecretMatch {
+	start := time.Now()
+	jobs := make(chan int)
+	results := make(chan scanResult)
+
+	workers := e.workers
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	pending := &pendingSet{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				matches, n, err := scan(paths[idx], pending)
+				results <- scanResult{idx: idx, matches: matches, bytes: n, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for idx := range paths {
+			jobs <- idx
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	out := make([][]types.SecretMatch, len(paths))
+	var totalBytes int64
+	done := 0
+
+	for r := range results {
+		totalBytes += r.bytes
+		done++
+		if progress != nil {
+			progress(done, totalBytes)
+		}
+		if r.err != nil || len(r.matches) == 0 {
+			continue
+		}
+
+		if tag != nil {
+			tag(r.idx, r.matches)
+		}
+
+		ui.Warning("Found %d secrets in %s", len(r.matches), filepath.Base(paths[r.idx]))
+		out[r.idx] = r.matches
+	}
+
+	// Passwords found in later files may open key stores scanned earlier.
+	// Containers whose findings were dropped come back as new findings,
+	// tagged like the rest of their file's.
+	recovered := make([][]types.SecretMatch, len(paths))
+	placeRecovered(recovered, paths, e.retryPending(out, pending))
+	for idx, found := range recovered {
+		if len(found) == 0 {
+			continue
+		}
+		if tag != nil {
+			tag(idx, found)
+		}
+		out[idx] = append(out[idx], found...)
+	}
+
+	ui.Detail("%d files, %s", len(paths), formatThroughput(totalBytes, time.Since(start)))
+	return out
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+func flatten(results [][]types.SecretMatch) []types.SecretMatch {
+	var all []types.SecretMatch
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// placeRecovered appends findings recovered by a retry to the result of
+// the scan they belong to, or to the last result when the file is unknown.
+func placeRecovered(results [][]types.SecretMatch, files []string, recovered []types.SecretMatch) {
+	for _, m := range recovered {
+		idx := slices.Index(files, m.File)
+		if idx < 0 {
+			idx = len(results) - 1
+		}
+		results[idx] = append(results[idx], m)
+	}
+}
+
+// formatThroughput renders bytes scanned and the resulting rate in MB/s.
+func formatThroughput(n int64, elapsed time.Duration) string {
+	mb := float64(n) / (1024 * 1024)
+	secs := elapsed.Seconds()
+	if secs <= 0 {
+		return fmt.Sprintf("%.1f MB", mb)
+	}
+	return fmt.Sprintf("%.1f MB in %s (%.1f MB/s)", mb, elapsed.Round(time.Millisecond), mb/secs)
+}
@@ -0,0 +1,116 @@
+// prefilter.go implements a case-insensitive Aho-Corasick keyword matcher
+// used to find candidate lines before running the (much slower) regexes.
+package extract
+
+// =============================================================================
+// Aho-Corasick Automaton
+// =============================================================================
+
+// prefilter finds every occurrence of the patterns' literal keywords in a
+// single pass over the content. Matching is ASCII case-insensitive.
+type prefilter struct {
+	next    [][256]int32 // Full DFA transition table
+	outputs [][]int      // Pattern indices reported when reaching each state
+	always  []int        // Patterns without keywords; they run on every line
+}
+
+// newPrefilter builds the automaton from per-pattern keyword lists.
+// keywords[i] holds the literals that must appear for pattern i to match.
+func newPrefilter(keywords [][]string) *prefilter {
+	p := &prefilter{
+		next:    make([][256]int32, 1),
+		outputs: make([][]int, 1),
+	}
+
+	// Build the keyword trie
+	for idx, words := range keywords {
+		if len(words) == 0 {
+			p.always = append(p.always, idx)
+			continue
+		}
+
+		for _, word := range words {
+			state := int32(0)
+			for i := 0; i < len(word); i++ {
+				c := lowerASCII(word[i])
+				if p.next[state][c] == 0 {
+					p.next = append(p.next, [256]int32{})
+					p.outputs = append(p.outputs, nil)
+					p.next[state][c] = int32(len(p.next) - 1)
+				}
+				state = p.next[state][c]
+			}
+			p.outputs[state] = appendUnique(p.outputs[state], idx)
+		}
+	}
+
+	// Breadth-first pass computes failure links and folds them into the
+	// transition table so scanning never backtracks.
+	fail := make([]int32, len(p.next))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if s := p.next[0][c]; s != 0 {
+			queue = append(queue, s)
+		}
+	}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, idx := range p.outputs[fail[state]] {
+			p.outputs[state] = appendUnique(p.outputs[state], idx)
+		}
+
+		for c := 0; c < 256; c++ {
+			child := p.next[state][c]
+			if child == 0 {
+				p.next[state][c] = p.next[fail[state]][c]
+				continue
+			}
+			fail[child] = p.next[fail[state]][c]
+			queue = append(queue, child)
+		}
+	}
+
+	// Fold upper-case input onto the lower-case transitions
+	for state := range p.next {
+		for c := 'A'; c <= 'Z'; c++ {
+			p.next[state][c] = p.next[state][c+'a'-'A']
+		}
+	}
+
+	return p
+}
+
+// scan calls fn with the end offset of every keyword occurrence and the
+// patterns that keyword belongs to.
+func (p *prefilter) scan(data []byte, fn func(end int, patterns []int)) {
+	state := int32(0)
+	for i, c := range data {
+		state = p.next[state][c]
+		if out := p.outputs[state]; len(out) > 0 {
+			fn(i+1, out)
+		}
+	}
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+func lowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func appendUnique(list []int, v int) []int {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
@@ -0,0 +1,240 @@
+// protected.go reports password-protected containers (encrypted Office
+// documents, encrypted ZIP archives and KeePass databases) as findings of
+// their own and, when enabled, opens them with candidate passwords.
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// Pattern names used for protected container findings.
+const (
+	patternEncryptedOffice = "Encrypted Office Document"
+	patternEncryptedZip    = "Encrypted ZIP Archive"
+	patternKeePass         = "KeePass Database"
+)
+
+// protectedContainer is an encrypted container recognized during a scan.
+type protectedContainer interface {
+	// protection describes the container's encryption. The caller
+	// updates it once the container is opened.
+	protection() *types.Protection
+
+	// open tries a password, returning the decrypted contents on success.
+	open(password string) ([]protectedEntry, bool)
+}
+
+// protectedEntry is decrypted content to scan, named relative to the
+// container (empty when the container holds a single document).
+type protectedEntry struct {
+	name string
+	data []byte
+}
+
+// SetOpenProtected sets whether encrypted Office documents, ZIP archives
+// and KeePass databases are opened with candidate passwords. Each
+// candidate costs one run of the container's key derivation, so opening
+// is off by default and containers are only reported.
+func (e *Extractor) SetOpenProtected(open bool) {
+	e.openProtected = open
+}
+
+// =============================================================================
+// Scanning
+// =============================================================================
+
+// scanProtected reports a protected container and, when opening is
+// enabled and a candidate password works, scans its decrypted contents.
+func (e *Extractor) scanProtected(file, location string, c protectedContainer, depth scanDepth) []types.SecretMatch {
+	p := c.protection()
+
+	var contents []protectedEntry
+	if e.openProtected && p.Openable {
+		candidates := e.passwords.snapshot()
+		contents = openProtected(c, candidates)
+		if !p.Opened {
+			depth.pending.addProtected(pendingProtected{file: file, location: location, container: c, tried: len(candidates), depth: depth})
+		}
+	}
+
+	matches := []types.SecretMatch{protectedFinding(file, location, p)}
+	return append(matches, e.scanProtectedContents(file, location, contents, depth)...)
+}
+
+// openProtected tries each candidate password, recording the one that
+// opens the container.
+func openProtected(c protectedContainer, candidates []string) []protectedEntry {
+	for _, pw := range candidates {
+		if contents, ok := c.open(pw); ok {
+			p := c.protection()
+			p.Opened = true
+			p.Password = pw
+			return contents
+		}
+	}
+	return nil
+}
+
+// scanProtectedContents scans the decrypted contents of a container.
+func (e *Extractor) scanProtectedContents(file, location string, contents []protectedEntry, depth scanDepth) []types.SecretMatch {
+	if len(contents) == 0 || depth.containers >= config.MaxContainerDepth {
+		return nil
+	}
+	depth.containers++
+
+	var matches []types.SecretMatch
+	for _, c := range contents {
+		matches = append(matches, e.scanContent(file, c.name, joinLocation(location, c.name), c.data, depth)...)
+	}
+	return matches
+}
+
+// =============================================================================
+// Pending Containers
+// =============================================================================
+
+// pendingProtected is a container none of the candidates known when it
+// was scanned could open.
+type pendingProtected struct {
+	file      string
+	location  string
+	container protectedContainer
+	tried     int // Candidates already tried; the pool only grows
+	depth     scanDepth
+}
+
+// retryProtected tries passwords discovered after each pending container
+// was scanned. Opened containers have their finding updated in place and
+// their contents' findings, which take the container's source, appended
+// to the same result. A container whose finding is not in results, such
+// as one from a file whose scan later failed, is returned with its
+// contents' findings instead.
+func (e *Extractor) retryProtected(results [][]types.SecretMatch, pending []pendingProtected) []types.SecretMatch {
+	var orphans []types.SecretMatch
+	candidates := e.passwords.snapshot()
+	for _, p := range pending {
+		if p.tried >= len(candidates) {
+			continue
+		}
+		contents := openProtected(p.container, candidates[p.tried:])
+		prot := p.container.protection()
+		if !prot.Opened {
+			continue
+		}
+		ui.Warning("Recovered password for %s", joinLocation(p.file, p.location))
+		found := e.scanProtectedContents(p.file, p.location, contents, p.depth)
+
+		if i, j, ok := findProtected(results, p); ok {
+			m := &results[i][j]
+			m.Match, m.Context = describeProtection(prot)
+			m.Severity = protectionSeverity(prot)
+			for k := range found {
+				inheritSource(&found[k], *m)
+			}
+			results[i] = append(results[i], found...)
+			continue
+		}
+		orphans = append(orphans, protectedFinding(p.file, p.location, prot))
+		orphans = append(orphans, found...)
+	}
+	return orphans
+}
+
+// findProtected returns the position of a pending container's finding.
+func findProtected(results [][]types.SecretMatch, p pendingProtected) (int, int, bool) {
+	for i, matches := range results {
+		for j, m := range matches {
+			if m.File == p.file && m.Location == p.location && m.Protection != nil {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// inheritSource copies where a finding came from, such as its drive item,
+// commit or message, from the finding of the container that held it.
+func inheritSource(m *types.SecretMatch, from types.SecretMatch) {
+	m.SourceItem = from.SourceItem
+	m.Provenance = from.Provenance
+	m.Commit = from.Commit
+	m.Mail = from.Mail
+	m.Chat = from.Chat
+}
+
+// =============================================================================
+// Reporting
+// =============================================================================
+
+// protectedFinding builds the finding for a protected container.
+func protectedFinding(file, location string, p *types.Protection) types.SecretMatch {
+	match, context := describeProtection(p)
+	return types.SecretMatch{
+		File:        file,
+		Location:    location,
+		PatternName: protectionPattern(p),
+		Severity:    protectionSeverity(p),
+		Match:       match,
+		Context:     context,
+		Protection:  p,
+	}
+}
+
+func protectionPattern(p *types.Protection) string {
+	switch p.Format {
+	case "ZIP":
+		return patternEncryptedZip
+	case "KeePass":
+		return patternKeePass
+	}
+	return patternEncryptedOffice
+}
+
+// describeProtection renders the match and context strings for a finding.
+func describeProtection(p *types.Protection) (string, string) {
+	match := fmt.Sprintf("%s (%s)", protectionPattern(p), p.Scheme)
+	switch {
+	case p.Entries == 1:
+		match = fmt.Sprintf("%s (%s, 1 encrypted entry)", protectionPattern(p), p.Scheme)
+	case p.Entries > 1:
+		match = fmt.Sprintf("%s (%s, %d encrypted entries)", protectionPattern(p), p.Scheme, p.Entries)
+	}
+
+	var parts []string
+	switch {
+	case p.Opened:
+		parts = append(parts, "password: "+p.Password)
+	case p.Openable:
+		parts = append(parts, "password protected")
+	default:
+		parts = append(parts, "password protected, scheme not supported for opening")
+	}
+	if p.KDF != "" {
+		parts = append(parts, "kdf: "+p.KDF)
+	}
+	return match, strings.Join(parts, "; ")
+}
+
+// protectionSeverity rates an opened container as critical and one still
+// locked as high: it was protected because it holds something valuable.
+func protectionSeverity(p *types.Protection) types.Severity {
+	if p.Opened {
+		return types.SeverityCritical
+	}
+	return types.SeverityHigh
+}
+
+// protectionRules describes the protected container findings, which come
+// from container analysis rather than a registered detector.
+func protectionRules() []types.RuleInfo {
+	return []types.RuleInfo{
+		{Name: patternEncryptedOffice, Severity: types.SeverityHigh, Description: "Password-protected Office document, opened with a candidate password where enabled"},
+		{Name: patternEncryptedZip, Severity: types.SeverityHigh, Description: "ZIP archive with ZipCrypto or AES encrypted entries, opened with a candidate password where enabled"},
+		{Name: patternKeePass, Severity: types.SeverityHigh, Description: "KeePass password database, unlocked with a candidate password where enabled"},
+	}
+}
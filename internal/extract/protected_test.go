@@ -0,0 +1,238 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// protectedPassword is the password testdata/protected/gen.js encrypts
+// every fixture with; each container holds this secret.
+const (
+	protectedPassword = "Winter2024!"
+	protectedSecret   = "Summer2025!"
+)
+
+func readProtectedFixture(tb testing.TB, name string) []byte {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "protected", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+func TestProtectedKnownAnswers(t *testing.T) {
+	defer silenceStdout(t)()
+
+	tests := []struct {
+		file     string
+		pattern  string
+		scheme   string
+		openable bool
+		contents bool // Decrypted contents are scanned
+	}{
+		{"zipcrypto.zip", patternEncryptedZip, "ZipCrypto", true, true},
+		{"zipcrypto-stream.zip", patternEncryptedZip, "ZipCrypto", true, true},
+		{"winzip-aes.zip", patternEncryptedZip, "WinZip AES-256", true, true},
+		{"agile.docx", patternEncryptedOffice, "Agile AES-256", true, true},
+		{"standard.docx", patternEncryptedOffice, "Standard AES-128", true, true},
+		{"kdbx3.kdbx", patternKeePass, "KDBX 3.1 AES-256", true, false},
+		{"kdbx4.kdbx", patternKeePass, "KDBX 4.0 AES-256", true, false},
+		{"kdbx4-argon2.kdbx", patternKeePass, "KDBX 4.0 AES-256", false, false},
+	}
+
+	for _, tt := range tests {
+		for _, password := range []string{protectedPassword, "Autumn2023!"} {
+			right := password == protectedPassword
+			t.Run(tt.file+"/"+password, func(t *testing.T) {
+				e := NewExtractor()
+				e.SetOpenProtected(true)
+				e.AddPasswords(password)
+
+				matches, err := e.ScanFile(filepath.Join("testdata", "protected", tt.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var container, secret bool
+				for _, m := range matches {
+					if p := m.Protection; p != nil && m.PatternName == tt.pattern {
+						container = true
+						if p.Scheme != tt.scheme || p.Openable != tt.openable {
+							t.Errorf("scheme %q openable %v, want %q %v", p.Scheme, p.Openable, tt.scheme, tt.openable)
+						}
+						wantOpened := right && tt.openable
+						if p.Opened != wantOpened || (wantOpened && p.Password != protectedPassword) {
+							t.Errorf("opened %v with %q, want opened %v", p.Opened, p.Password, wantOpened)
+						}
+					}
+					if strings.Contains(m.Match, protectedSecret) {
+						secret = true
+					}
+				}
+				if !container {
+					t.Fatalf("no %s finding in %d matches", tt.pattern, len(matches))
+				}
+				if want := right && tt.contents; secret != want {
+					t.Errorf("secret from the decrypted contents found = %v, want %v", secret, want)
+				}
+			})
+		}
+	}
+}
+
+func FuzzParseKeePass(f *testing.F) {
+	for _, name := range []string{"kdbx3.kdbx", "kdbx4.kdbx", "kdbx4-argon2.kdbx"} {
+		f.Add(readProtectedFixture(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		db, err := parseKeePass(data)
+		if err != nil || !db.p.Openable || db.rounds > 10000 {
+			return
+		}
+		db.open(protectedPassword)
+	})
+}
+
+func FuzzZipEncryption(f *testing.F) {
+	for _, name := range []string{"zipcrypto.zip", "zipcrypto-stream.zip", "winzip-aes.zip"} {
+		f.Add(readProtectedFixture(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		if z, ok := zipEncryption(zr); ok && z.p.Openable {
+			z.open(protectedPassword)
+		}
+	})
+}
+
+func FuzzOfficeEncryption(f *testing.F) {
+	for _, name := range []string{"agile.docx", "standard.docx"} {
+		f.Add(readProtectedFixture(f, name))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := openCFB(data)
+		if err != nil {
+			return
+		}
+		root := c.root()
+		container, ok := officeEncryption(c, root)
+		if !ok {
+			legacyOfficeEncryption(c, root)
+			return
+		}
+		// Opening costs a full key derivation; keep the fuzzer fast
+		if a, ok := container.(*agileDocument); ok && a.p.Openable && a.key.SpinCount <= 1000 {
+			a.open(protectedPassword)
+		}
+	})
+}
+
+func FuzzParseOfficeInfo(f *testing.F) {
+	for _, name := range []string{"agile.docx", "standard.docx"} {
+		c, err := openCFB(readProtectedFixture(f, name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		info, _ := c.read(c.root().child("EncryptionInfo"))
+		f.Add(info[8:])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pkg := make([]byte, 8+64)
+		pkg[0] = 32
+		if s, err := parseStandardInfo(data, pkg); err == nil && s.p.Openable {
+			s.open(protectedPassword)
+		}
+		parseAgileInfo(data, pkg)
+	})
+}
+
+func TestRetryProtectedWithoutFinding(t *testing.T) {
+	defer silenceStdout(t)()
+
+	data := readProtectedFixture(t, "zipcrypto.zip")
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, ok := zipEncryption(zr)
+	if !ok {
+		t.Fatal("not recognized as an encrypted archive")
+	}
+
+	// The container's finding is not among the results, as when its file
+	// was scanned in another batch
+	e := NewExtractor()
+	e.AddPasswords(protectedPassword)
+	results := [][]types.SecretMatch{{{File: "other.txt", PatternName: "Password"}}}
+	pending := []pendingProtected{{file: "archive.zip", container: z}}
+
+	recovered := e.retryProtected(results, pending)
+	var opened, secret bool
+	for _, m := range recovered {
+		if m.File != "archive.zip" {
+			t.Errorf("recovered finding for %s", m.File)
+		}
+		if m.Protection != nil && m.Protection.Opened {
+			opened = true
+		}
+		if strings.Contains(m.Match, protectedSecret) {
+			secret = true
+		}
+	}
+	if !opened || !secret {
+		t.Errorf("recovered %d findings: container opened %v, secret %v", len(recovered), opened, secret)
+	}
+	if len(results[0]) != 1 {
+		t.Errorf("unrelated results changed: %+v", results[0])
+	}
+}
+
+func TestScanDownloadedFilesRecoveredProvenance(t *testing.T) {
+	defer silenceStdout(t)()
+
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "backup.zip")
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(archive, readProtectedFixture(t, "zipcrypto.zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(notes, []byte("password = "+protectedPassword+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One worker scans the archive before the file holding its password
+	e := NewExtractor()
+	e.SetWorkers(1)
+	e.SetOpenProtected(true)
+	matches := e.ScanDownloadedFiles([]types.DownloadedFile{
+		{LocalPath: archive, SourceItem: types.DriveItem{Name: "backup.zip", WebURL: "https://contoso.sharepoint.com/backup.zip"}},
+		{LocalPath: notes, SourceItem: types.DriveItem{Name: "notes.txt", WebURL: "https://contoso.sharepoint.com/notes.txt"}},
+	})
+
+	var found bool
+	for _, m := range matches {
+		if !strings.Contains(m.Match, protectedSecret) {
+			continue
+		}
+		found = true
+		if m.SourceItem != "backup.zip" {
+			t.Errorf("SourceItem = %q, want backup.zip", m.SourceItem)
+		}
+		if p := m.Provenance; p == nil || p.WebURL != "https://contoso.sharepoint.com/backup.zip" || p.SHA256 == "" || p.LocalPath != archive {
+			t.Errorf("recovered finding provenance = %+v", p)
+		}
+	}
+	if !found {
+		t.Errorf("secret in the archive not recovered from %d matches", len(matches))
+	}
+}
@@ -0,0 +1,122 @@
+// searchterms.go derives search queries from the registered detectors, so
+// a detector for a token format (AKIA..., ghp_...) also finds the files
+// holding such tokens without a human keyword for them.
+package extract
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// minSearchTermLength is the shortest literal worth searching for; shorter
+// prefixes match far too much.
+const minSearchTermLength = 3
+
+// =============================================================================
+// Search Terms
+// =============================================================================
+
+// Searcher is optionally implemented by detectors to give the KQL queries
+// that find content they would match. Detectors without it are searched by
+// their token-like keywords (ghp_, glpat-) as prefix wildcards.
+type Searcher interface {
+	SearchTerms() []string
+}
+
+// SearchQueries returns the search queries derived from every registered
+// detector, each tagged with the detector it came from. A query derived
+// from several detectors is kept once, for the first.
+func (e *Extractor) SearchQueries() []types.DetectorQuery {
+	var queries []types.DetectorQuery
+	seen := make(map[string]bool)
+	for _, d := range e.detectors {
+		var terms []string
+		if s, ok := d.(Searcher); ok {
+			terms = s.SearchTerms()
+		} else {
+			terms = keywordTerms(d.Keywords())
+		}
+
+		for _, t := range terms {
+			if key := strings.ToLower(t); !seen[key] {
+				seen[key] = true
+				queries = append(queries, types.DetectorQuery{Detector: d.Name(), Query: t})
+			}
+		}
+	}
+	return queries
+}
+
+// SearchTerms derives queries from the expression's literal prefix. A
+// prefix running straight into the token (AKIA, sk_live_) becomes a prefix
+// wildcard; one ending in a space (-----BEGIN ) is too common alone and is
+// ANDed with the keywords it does not contain. Case-insensitive
+// expressions have no literal prefix and fall back to the keywords.
+func (d *RegexDetector) SearchTerms() []string {
+	prefix, _ := d.regex.LiteralPrefix()
+	word := strings.TrimFunc(prefix, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(word) < minSearchTermLength || !isSimpleTerm(word) {
+		return keywordTerms(d.keywords)
+	}
+
+	last := prefix[len(prefix)-1]
+	switch {
+	case isTokenByte(last):
+		return []string{word + "*"}
+	case last == ' ':
+		terms := []string{word}
+		for _, k := range d.keywords {
+			if !strings.Contains(strings.ToLower(word), k) {
+				terms = append(terms, kqlPhrase(k))
+			}
+		}
+		if len(terms) > 1 {
+			return []string{strings.Join(terms, " ")}
+		}
+	}
+	return keywordTerms(d.keywords)
+}
+
+// keywordTerms keeps the keywords that look like token prefixes: a single
+// word holding an underscore, hyphen or digit. Plain words such as
+// "secret" or "pass" would match most of a tenant.
+func keywordTerms(keywords []string) []string {
+	var terms []string
+	for _, k := range keywords {
+		word := strings.Trim(k, "_-")
+		if len(word) < minSearchTermLength || !isSimpleTerm(k) || !strings.ContainsAny(k, "_-0123456789") {
+			continue
+		}
+		terms = append(terms, k+"*")
+	}
+	return terms
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// isSimpleTerm reports whether s can be searched as a bare KQL token.
+func isSimpleTerm(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isTokenByte(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isTokenByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func kqlPhrase(s string) string {
+	if isSimpleTerm(s) {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
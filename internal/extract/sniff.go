@@ -0,0 +1,191 @@
+// sniff.go decides what to scan based on file content rather than extension.
+package extract
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/loosehose/azonk/internal/config"
+)
+
+// =============================================================================
+// File Kinds
+// =============================================================================
+
+// fileKind classifies content so it can be routed to the right handler.
+type fileKind int
+
+const (
+	kindEmpty   fileKind = iota // Nothing to scan
+	kindText                    // Plain text in any supported encoding
+	kindZip                     // ZIP archive, including OOXML (docx/xlsx/pptx)
+	kindOLE                     // OLE compound file (legacy Office, Outlook .msg)
+	kindDER                     // ASN.1 DER, e.g. PFX/PKCS#12 or a binary private key
+	kindMail                    // MIME email message (.eml)
+	kindKeePass                 // KeePass password database (.kdbx, .kdb)
+	kindBinary                  // Unsupported binary format
+)
+
+// magicSignatures maps leading bytes to the kind of content they identify.
+var magicSignatures = []struct {
+	magic []byte
+	kind  fileKind
+}{
+	{[]byte("PK\x03\x04"), kindZip},
+	{[]byte("PK\x05\x06"), kindZip}, // Empty archive
+	{[]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, kindOLE},
+	{[]byte{0x03, 0xD9, 0xA2, 0x9A}, kindKeePass},
+	{[]byte{0x30, 0x82}, kindDER}, // SEQUENCE with a two-byte length
+	{[]byte{0x30, 0x83}, kindDER},
+	{[]byte{0x30, 0x81}, kindDER},
+	{[]byte{0x30, 0x80}, kindDER}, // Indefinite length (BER)
+	{[]byte("%PDF-"), kindBinary},
+	{[]byte("\x89PNG"), kindBinary},
+	{[]byte{0xFF, 0xD8, 0xFF}, kindBinary}, // JPEG
+	{[]byte("GIF8"), kindBinary},
+	{[]byte("\x7FELF"), kindBinary},
+	{[]byte("MZ"), kindBinary},       // PE executables
+	{[]byte{0x1F, 0x8B}, kindBinary}, // gzip
+	{[]byte("7z\xBC\xAF\x27\x1C"), kindBinary},
+	{[]byte("Rar!\x1A\x07"), kindBinary},
+}
+
+// sniffKind classifies content from its leading bytes, falling back to
+// filename knowledge when the content alone is ambiguous.
+func sniffKind(name string, sample []byte) fileKind {
+	if len(sample) == 0 {
+		return kindEmpty
+	}
+
+	if hasUnicodeBOM(sample) {
+		return kindText
+	}
+
+	for _, sig := range magicSignatures {
+		if bytes.HasPrefix(sample, sig.magic) {
+			return sig.kind
+		}
+	}
+
+	if looksText(sample) || isUTF16Text(sample) {
+		if looksLikeMail(sample) {
+			return kindMail
+		}
+		return kindText
+	}
+
+	// Content is ambiguous (e.g. a few stray control bytes); trust the name
+	// only when it points at a known text format.
+	if !bytes.Contains(sample, []byte{0}) && isKnownTextName(name) {
+		return kindText
+	}
+
+	return kindBinary
+}
+
+// isKnownTextName reports whether a filename is a well-known secret file or
+// carries a text extension, ignoring backup suffixes like "~" or ".bak".
+func isKnownTextName(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	if config.SecretFileNames()[base] {
+		return true
+	}
+
+	for _, suffix := range []string{"~", ".bak", ".old", ".orig", ".save", ".swp"} {
+		base = strings.TrimSuffix(base, suffix)
+	}
+	if config.SecretFileNames()[base] {
+		return true
+	}
+
+	return config.ScannableExtensions()[filepath.Ext(base)]
+}
+
+// =============================================================================
+// Text Detection
+// =============================================================================
+
+// looksText reports whether a sample is mostly printable UTF-8 or ASCII.
+// A multi-byte rune cut off at the end of the sample is tolerated.
+func looksText(sample []byte) bool {
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+
+	control := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size <= 1 {
+			// Allow a truncated rune at the sample boundary only
+			if len(sample)-i >= utf8.UTFMax {
+				return false
+			}
+			break
+		}
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != 0x1B {
+			control++
+		}
+		i += size
+	}
+
+	return control*100 <= len(sample)*config.MaxControlCharPercent
+}
+
+// isUTF16Text detects BOM-less UTF-16 text by the pattern of zero bytes
+// that ASCII characters leave in every other position.
+func isUTF16Text(sample []byte) bool {
+	if len(sample) < 4 {
+		return false
+	}
+
+	n := len(sample) &^ 1
+	evenZero, oddZero := 0, 0
+	for i := 0; i < n; i += 2 {
+		if sample[i] == 0 {
+			evenZero++
+		}
+		if sample[i+1] == 0 {
+			oddZero++
+		}
+	}
+
+	pairs := n / 2
+	return (oddZero*10 >= pairs*9 && evenZero == 0) || (evenZero*10 >= pairs*9 && oddZero == 0)
+}
+
+func hasUnicodeBOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) ||
+		bytes.HasPrefix(data, []byte{0xFF, 0xFE}) ||
+		bytes.HasPrefix(data, []byte{0xFE, 0xFF})
+}
+
+// decodeText normalizes text content to UTF-8, stripping any BOM and
+// converting UTF-16 (common in PowerShell and registry exports).
+func decodeText(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true)
+	case isUTF16Text(data):
+		return decodeUTF16(data, data[0] == 0)
+	}
+	return data
+}
+
+func decodeUTF16(data []byte, bigEndian bool) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
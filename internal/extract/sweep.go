@@ -0,0 +1,484 @@
+// sweep.go scans local trees and mounted file shares with include/exclude
+// filters, size budgets and a cache of content already scanned.
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Sweep
+// =============================================================================
+
+// Sweep scans every file under opts.Root that passes the filters and
+// budgets. Files whose content was already scanned, earlier in the sweep
+// or in a sweep recorded in the cache file, are not scanned again; the
+// findings recorded for that content are reported for them instead.
+func (e *Extractor) Sweep(opts types.SweepOptions) (*types.SweepResult, error) {
+	ui.Info("Sweeping %s", opts.Root)
+
+	info, err := os.Stat(opts.Root)
+	if err != nil {
+		return nil, fmt.Errorf("sweep root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("sweep root %s is not a directory", opts.Root)
+	}
+
+	s, err := newSweeper(e, opts)
+	if err != nil {
+		return nil, err
+	}
+	if isGitDir(os.DirFS(opts.Root)) {
+		s.paths = append(s.paths, opts.Root)
+	} else {
+		s.walk(opts.Root, "", 0)
+	}
+
+	if s.summary.BudgetExhausted {
+		ui.Warning("Byte budget reached, %d files left unqueued", s.summary.FilesUnqueued)
+	}
+	ui.Info("Scanning %d files (%d skipped, %d already scanned)", len(s.paths), s.summary.FilesSkipped, s.summary.FilesCached)
+
+	secrets := append(s.reported, flatten(e.runPool(s.paths, s.scan, nil, s.progress))...)
+
+	if opts.CacheFile != "" {
+		if err := s.cache.save(opts.CacheFile); err != nil {
+			ui.Warning("Failed to save sweep cache: %v", err)
+		}
+	}
+
+	s.summary.SecretsFound = len(secrets)
+	ui.Success("Sweep complete: %d potential secrets found", len(secrets))
+
+	return &types.SweepResult{
+		Root:         opts.Root,
+		SecretsFound: secrets,
+		Summary:      s.summary,
+	}, nil
+}
+
+// PrintSweepSummary prints the statistics of a sweep.
+func (e *Extractor) PrintSweepSummary(s types.SweepSummary) {
+	ui.Header("Summary")
+	ui.Stat("Files found", s.FilesFound)
+	ui.Stat("Files scanned", s.FilesScanned)
+	ui.Stat("Files skipped", s.FilesSkipped)
+	ui.Stat("Already scanned", s.FilesCached)
+	if s.BudgetExhausted {
+		ui.Stat("Left unqueued (byte budget)", s.FilesUnqueued)
+	}
+	ui.Stat("Data scanned", formatThroughput(s.BytesScanned, 0))
+
+	if s.SecretsFound > 0 {
+		ui.StatHighlight("Secrets found", s.SecretsFound)
+	} else {
+		ui.Stat("Secrets found", s.SecretsFound)
+	}
+}
+
+// SaveSweep writes a sweep's findings and statistics to dir as JSON, and
+// its findings as SARIF 2.1.0, returning both file paths.
+func (e *Extractor) SaveSweep(dir string, result *types.SweepResult) (string, string, error) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("marshal sweep results: %w", err)
+	}
+	jsonPath := filepath.Join(dir, config.SweepResultsFileName)
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return "", "", fmt.Errorf("write sweep results: %w", err)
+	}
+
+	sarifPath := filepath.Join(dir, config.SARIFFileName)
+	if err := e.SaveSARIF(sarifPath, result.SecretsFound); err != nil {
+		return jsonPath, "", err
+	}
+	return jsonPath, sarifPath, nil
+}
+
+// =============================================================================
+// Walking
+// =============================================================================
+
+// sweeper holds the state of one sweep. The walk runs before scanning and
+// is single-threaded; scan is called from the worker pool.
+type sweeper struct {
+	e        *Extractor
+	opts     types.SweepOptions
+	paths    []string
+	queued   int64
+	visited  map[string]bool
+	reported []types.SecretMatch // Findings recorded for files not scanned again
+
+	mu      sync.Mutex
+	cache   *sweepCache
+	summary types.SweepSummary
+
+	lastProgress time.Time
+}
+
+func newSweeper(e *Extractor, opts types.SweepOptions) (*sweeper, error) {
+	if opts.MaxFileSize <= 0 || opts.MaxFileSize > config.MaxFileSizeForScan {
+		opts.MaxFileSize = config.MaxFileSizeForScan
+	}
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", pattern, err)
+		}
+	}
+
+	cache := newSweepCache(e.sweepFingerprint())
+	if opts.CacheFile != "" {
+		var err error
+		if cache, err = loadSweepCache(opts.CacheFile, cache.Fingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sweeper{
+		e:            e,
+		opts:         opts,
+		visited:      make(map[string]bool),
+		cache:        cache,
+		lastProgress: time.Now(),
+	}, nil
+}
+
+// walk queues the files under dir, which is rel below the root and depth
+// directory levels down.
+func (s *sweeper) walk(dir, rel string, depth int) {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if s.visited[real] {
+			return // Symlink loop or directory already swept
+		}
+		s.visited[real] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		full := filepath.Join(dir, entry.Name())
+		relPath := path.Join(rel, entry.Name())
+		if matchAny(s.opts.Exclude, entry.Name(), relPath) {
+			if !entry.IsDir() {
+				s.summary.FilesSkipped++
+			}
+			continue
+		}
+
+		mode := entry.Type()
+		if mode&fs.ModeSymlink != 0 {
+			if s.opts.Symlinks == types.SymlinkSkip {
+				continue
+			}
+			info, err := os.Stat(full)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() && s.opts.Symlinks != types.SymlinkFollow {
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+
+		switch {
+		case mode.IsDir() && isGitDir(os.DirFS(full)):
+			s.paths = append(s.paths, full) // Scanned as history
+		case mode.IsDir():
+			if s.opts.MaxDepth == 0 || depth < s.opts.MaxDepth {
+				s.walk(full, relPath, depth+1)
+			}
+		case mode.IsRegular():
+			s.add(full, entry.Name(), relPath)
+		}
+	}
+}
+
+// add queues a file unless it is filtered out, over a budget, or
+// unchanged since it was last scanned. Once the byte budget is reached,
+// files are only counted.
+func (s *sweeper) add(full, name, relPath string) {
+	s.summary.FilesFound++
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case len(s.opts.Include) > 0 && !matchAny(s.opts.Include, name, relPath):
+		s.summary.FilesSkipped++
+		return
+	case info.Size() > s.opts.MaxFileSize:
+		s.summary.FilesSkipped++
+		return
+	}
+	if sha, ok := s.cache.unchanged(cacheKey(full), info); ok {
+		s.summary.FilesCached++
+		s.reported = append(s.reported, s.reuse(sha, full)...)
+		return
+	}
+
+	if s.summary.BudgetExhausted || s.opts.MaxTotalBytes > 0 && s.queued+info.Size() > s.opts.MaxTotalBytes {
+		s.summary.BudgetExhausted = true
+		s.summary.FilesUnqueued++
+		return
+	}
+	s.queued += info.Size()
+	s.paths = append(s.paths, full)
+}
+
+// matchAny reports whether any glob matches the base name or the path
+// relative to the root.
+func matchAny(globs []string, name, relPath string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(g, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// Scanning
+// =============================================================================
+
+// scan reads and hashes a file, then scans it unless identical content was
+// already scanned, in this sweep or an earlier one, in which case the
+// findings recorded for that content are reported for it. Content is only
+// recorded once its scan completes.
+func (s *sweeper) scan(filePath string, pending *pendingSet) ([]types.SecretMatch, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		return s.e.scanGitDir(filePath, pending)
+	}
+
+	content, err := readStream(file, filePath)
+	if err != nil {
+		return nil, content.bytes, err
+	}
+	key := cacheKey(filePath)
+	entry := cacheEntry{Size: info.Size(), ModTime: info.ModTime(), SHA256: content.sha256}
+
+	// Binary content is not scanned, so it has no hash or findings
+	if content.data != nil {
+		s.mu.Lock()
+		_, seen := s.cache.Findings[content.sha256]
+		var findings []types.SecretMatch
+		if seen {
+			s.cache.Files[key] = entry
+			s.summary.FilesCached++
+			findings = s.reuse(content.sha256, filePath)
+		}
+		s.mu.Unlock()
+		if seen {
+			return findings, 0, nil
+		}
+	}
+
+	var harvested []string
+	matches := s.e.scanRead(filePath, content, scanDepth{pending: pending, harvest: &harvested})
+	if len(matches) > 0 {
+		matches[0].Provenance.LocalPath = filePath // Shared by all matches
+	}
+
+	s.mu.Lock()
+	if content.data != nil {
+		s.cache.Findings[content.sha256] = matches
+		if len(harvested) > 0 {
+			s.cache.Passwords[content.sha256] = harvested
+		}
+	}
+	s.cache.Files[key] = entry
+	s.summary.FilesScanned++
+	s.summary.BytesScanned += content.bytes
+	s.mu.Unlock()
+
+	return matches, content.bytes, nil
+}
+
+// reuse returns the findings recorded for content with the given hash,
+// relocated to filePath, and adds the passwords found in it to the pool
+// so they still open key stores and containers scanned in this sweep.
+func (s *sweeper) reuse(sha, filePath string) []types.SecretMatch {
+	s.e.passwords.add(s.cache.Passwords[sha]...)
+	return relocate(s.cache.Findings[sha], filePath)
+}
+
+// relocate copies findings recorded for some content to another file
+// holding the same content.
+func relocate(findings []types.SecretMatch, filePath string) []types.SecretMatch {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	var prov *types.Provenance
+	if p := findings[0].Provenance; p != nil {
+		copied := *p
+		copied.LocalPath = filePath
+		prov = &copied
+	}
+
+	out := make([]types.SecretMatch, len(findings))
+	for i, m := range findings {
+		m.File, m.Provenance = filePath, prov
+		out[i] = m
+	}
+	return out
+}
+
+// progress reports sweep progress at most every SweepProgressInterval.
+func (s *sweeper) progress(done int, bytes int64) {
+	if time.Since(s.lastProgress) < config.SweepProgressInterval {
+		return
+	}
+	s.lastProgress = time.Now()
+	ui.Progress("%d/%d files, %.1f MB", done, len(s.paths), float64(bytes)/(1024*1024))
+}
+
+// =============================================================================
+// Cache
+// =============================================================================
+
+// sweepCache records the files scanned by earlier sweeps, keyed by path,
+// and the findings and passwords in each content scanned, keyed by
+// SHA-256. The findings hold the secrets themselves, so the file is
+// written owner-only. A cache is only reused by sweeps with the same
+// fingerprint, as other detectors or options would find other things.
+type sweepCache struct {
+	Fingerprint string                         `json:"fingerprint"`
+	Files       map[string]cacheEntry          `json:"files"`
+	Findings    map[string][]types.SecretMatch `json:"findings"` // Null for content without findings
+	Passwords   map[string][]string            `json:"passwords,omitempty"`
+}
+
+type cacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+func newSweepCache(fingerprint string) *sweepCache {
+	return &sweepCache{
+		Fingerprint: fingerprint,
+		Files:       make(map[string]cacheEntry),
+		Findings:    make(map[string][]types.SecretMatch),
+		Passwords:   make(map[string][]string),
+	}
+}
+
+// loadSweepCache reads a cache file, returning an empty cache if it does
+// not exist yet or was written with another fingerprint.
+func loadSweepCache(cachePath, fingerprint string) (*sweepCache, error) {
+	cache := newSweepCache(fingerprint)
+
+	data, err := os.ReadFile(cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sweep cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("parse sweep cache: %w", err)
+	}
+	if cache.Fingerprint != fingerprint {
+		ui.Info("Sweep cache was written with other detectors or options, scanning everything again")
+		return newSweepCache(fingerprint), nil
+	}
+	if cache.Files == nil {
+		cache.Files = make(map[string]cacheEntry)
+	}
+	if cache.Findings == nil {
+		cache.Findings = make(map[string][]types.SecretMatch)
+	}
+	if cache.Passwords == nil {
+		cache.Passwords = make(map[string][]string)
+	}
+	return cache, nil
+}
+
+// sweepFingerprint hashes what decides a scan's findings: the detectors
+// and their expressions, context settings, whether protected content is
+// opened and the passwords supplied to try.
+func (e *Extractor) sweepFingerprint() string {
+	h := sha256.New()
+	for _, d := range e.detectors {
+		fmt.Fprintf(h, "detector %q", d.Name())
+		if r, ok := d.(*RegexDetector); ok {
+			fmt.Fprintf(h, " %q", r.regex.String())
+		}
+		fmt.Fprintln(h)
+	}
+	fmt.Fprintf(h, "context %d %d %d\n", e.contextBefore, e.contextAfter, e.contextWidth)
+	fmt.Fprintf(h, "open protected %v\n", e.openProtected)
+
+	supplied := append([]string(nil), e.supplied...)
+	sort.Strings(supplied)
+	for _, pw := range supplied {
+		fmt.Fprintf(h, "password %q\n", pw)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *sweepCache) save(cachePath string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cachePath, data, 0600)
+}
+
+// cacheKey keys the cache by absolute path, so sweeps started from
+// different working directories share entries.
+func cacheKey(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
+
+// unchanged reports whether a file has the size and modification time it
+// had when last scanned, returning the hash of its content. A file whose
+// findings were not recorded counts as changed.
+func (c *sweepCache) unchanged(filePath string, info os.FileInfo) (string, bool) {
+	entry, ok := c.Files[filePath]
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	if entry.SHA256 == "" {
+		return "", true // Binary content, not scanned
+	}
+	_, ok = c.Findings[entry.SHA256]
+	return entry.SHA256, ok
+}
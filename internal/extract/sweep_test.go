@@ -0,0 +1,223 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// sweepFiles returns the files of a sweep's findings, sorted.
+func sweepFiles(result *types.SweepResult) []string {
+	var files []string
+	for _, m := range result.SecretsFound {
+		files = append(files, filepath.Base(m.File))
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestSweepCacheReportsFindings(t *testing.T) {
+	defer silenceStdout(t)()
+
+	root := t.TempDir()
+	secret := []byte("password = Winter2024!\n")
+	for _, name := range []string{"a.config", "b.config"} {
+		if err := os.WriteFile(filepath.Join(root, name), secret, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "clean.txt"), []byte("nothing here\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One worker, so the duplicate is not scanned alongside the original
+	e := NewExtractor()
+	e.SetWorkers(1)
+	opts := types.SweepOptions{Root: root, CacheFile: filepath.Join(t.TempDir(), "cache.json")}
+	first, err := e.Sweep(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := e.Sweep(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical content is scanned once but reported for every file, in
+	// this sweep and the next
+	for i, r := range []*types.SweepResult{first, second} {
+		if got := fmt.Sprint(sweepFiles(r)); got != "[a.config b.config]" {
+			t.Errorf("sweep %d findings in %s, want [a.config b.config]", i+1, got)
+		}
+	}
+	if first.Summary.FilesScanned != 2 || first.Summary.FilesCached != 1 {
+		t.Errorf("first sweep scanned %d, cached %d; want 2, 1", first.Summary.FilesScanned, first.Summary.FilesCached)
+	}
+	if second.Summary.FilesScanned != 0 || second.Summary.FilesCached != 3 {
+		t.Errorf("second sweep scanned %d, cached %d; want 0, 3", second.Summary.FilesScanned, second.Summary.FilesCached)
+	}
+	for _, m := range second.SecretsFound {
+		if m.Provenance == nil || m.Provenance.LocalPath != m.File {
+			t.Errorf("cached finding for %s has provenance %+v", m.File, m.Provenance)
+		}
+	}
+}
+
+func TestSweepByteBudget(t *testing.T) {
+	defer silenceStdout(t)()
+
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := NewExtractor().Sweep(types.SweepOptions{Root: root, MaxTotalBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := result.Summary
+	if !s.BudgetExhausted || s.FilesUnqueued != 2 || s.FilesSkipped != 0 || s.FilesScanned != 2 {
+		t.Errorf("summary %+v, want 2 scanned and 2 unqueued", s)
+	}
+}
+
+func TestSaveSweep(t *testing.T) {
+	defer silenceStdout(t)()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "web.config"), []byte("password = Winter2024!\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExtractor()
+	result, err := e.Sweep(types.SweepOptions{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	jsonPath, sarifPath, err := e.SaveSweep(dir, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonPath != filepath.Join(dir, config.SweepResultsFileName) || sarifPath != filepath.Join(dir, config.SARIFFileName) {
+		t.Errorf("paths %s, %s", jsonPath, sarifPath)
+	}
+
+	var saved types.SweepResult
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.SecretsFound) != len(result.SecretsFound) || saved.Summary != result.Summary {
+		t.Errorf("saved %d findings, summary %+v", len(saved.SecretsFound), saved.Summary)
+	}
+
+	var sarif struct {
+		Runs []struct {
+			Results []json.RawMessage `json:"results"`
+		} `json:"runs"`
+	}
+	data, err = os.ReadFile(sarifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &sarif); err != nil {
+		t.Fatal(err)
+	}
+	if len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != len(result.SecretsFound) {
+		t.Errorf("SARIF holds %d runs, want one with %d results", len(sarif.Runs), len(result.SecretsFound))
+	}
+}
+
+func TestSweepCacheKeepsPasswords(t *testing.T) {
+	defer silenceStdout(t)()
+
+	root := t.TempDir()
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("password = "+protectedPassword+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sweep := func() *types.SweepResult {
+		e := NewExtractor()
+		e.SetOpenProtected(true)
+		result, err := e.Sweep(types.SweepOptions{Root: root, CacheFile: cacheFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	sweep()
+
+	// The archive is new, but the password that opens it is in a file the
+	// next sweep takes from the cache
+	if err := os.WriteFile(filepath.Join(root, "backup.zip"), readProtectedFixture(t, "zipcrypto.zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result := sweep()
+	if result.Summary.FilesCached != 1 || result.Summary.FilesScanned != 1 {
+		t.Errorf("scanned %d, cached %d; want 1, 1", result.Summary.FilesScanned, result.Summary.FilesCached)
+	}
+
+	var opened bool
+	for _, m := range result.SecretsFound {
+		if strings.Contains(m.Match, protectedSecret) {
+			opened = true
+		}
+	}
+	if !opened {
+		t.Error("archive not opened with the password from a cached file")
+	}
+}
+
+func TestSweepCacheFingerprint(t *testing.T) {
+	defer silenceStdout(t)()
+
+	tests := []struct {
+		name      string
+		configure func(e *Extractor)
+	}{
+		{"language pack", func(e *Extractor) { e.AddLanguages("fr") }},
+		{"open protected", func(e *Extractor) { e.SetOpenProtected(true) }},
+		{"passwords", func(e *Extractor) { e.AddPasswords("Autumn2023!") }},
+		{"context", func(e *Extractor) { e.SetContext(0, 0, 80) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("mot de passe: Ete2024!\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			opts := types.SweepOptions{Root: root, CacheFile: filepath.Join(t.TempDir(), "cache.json")}
+			if _, err := NewExtractor().Sweep(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			e := NewExtractor()
+			tt.configure(e)
+			result, err := e.Sweep(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Summary.FilesCached != 0 || result.Summary.FilesScanned != 1 {
+				t.Errorf("scanned %d, cached %d; want the stale cache dropped", result.Summary.FilesScanned, result.Summary.FilesCached)
+			}
+			if tt.name == "language pack" && len(result.SecretsFound) == 0 {
+				t.Error("French key name not found after adding the language pack")
+			}
+		})
+	}
+}
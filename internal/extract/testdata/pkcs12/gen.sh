@@ -0,0 +1,31 @@
+#!/bin/sh
+# gen.sh regenerates the PKCS#12 and PKCS#8 fixtures used by pkcs12_test.go.
+# Every encrypted file uses the password Winter2024! over the same EC P-256
+# key and self-signed certificate. Needs OpenSSL 3 (-legacy for RC2/3DES).
+set -e
+cd "$(dirname "$0")"
+PW='pass:Winter2024!'
+
+openssl ecparam -name prime256v1 -genkey -noout -out key.pem
+openssl req -new -x509 -key key.pem -subj /CN=azonk-test -days 3650 -out cert.pem
+
+# PBES2/PBKDF2 with AES-256-CBC and a SHA-256 MAC, the OpenSSL 3 default
+openssl pkcs12 -export -inkey key.pem -in cert.pem -passout "$PW" -out aes256.pfx
+
+# Legacy PKCS#12 PBE schemes, as older Windows and Java exports write them
+openssl pkcs12 -export -legacy -inkey key.pem -in cert.pem -passout "$PW" \
+	-certpbe PBE-SHA1-RC2-40 -keypbe PBE-SHA1-RC2-40 -out legacy-rc2.pfx
+openssl pkcs12 -export -legacy -inkey key.pem -in cert.pem -passout "$PW" \
+	-certpbe PBE-SHA1-RC2-128 -keypbe PBE-SHA1-RC2-128 -out legacy-rc2-128.pfx
+openssl pkcs12 -export -legacy -inkey key.pem -in cert.pem -passout "$PW" \
+	-certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -out legacy-3des.pfx
+
+# No MAC: only decrypting the shrouded key tells whether a password is right
+openssl pkcs12 -export -inkey key.pem -in cert.pem -passout "$PW" \
+	-nomac -certpbe NONE -out nomac.pfx
+
+# Iteration counts over config.MaxPKCS12Iterations
+openssl pkcs12 -export -inkey key.pem -in cert.pem -passout "$PW" \
+	-iter 5000000 -maciter -out manyiter.pfx
+openssl pkcs8 -topk8 -in key.pem -passout "$PW" -v2 aes-256-cbc -out pkcs8.pem
+openssl pkcs8 -topk8 -in key.pem -passout "$PW" -v2 aes-256-cbc -iter 5000000 -out manyiter-pkcs8.pem
@@ -0,0 +1,333 @@
+// gen.js regenerates the encrypted container fixtures used by
+// protected_test.go. Every container uses the password Winter2024! and
+// holds notes.txt with the line "password = Summer2025!" (KeePass
+// databases are only unlocked, so their payload is empty).
+//
+// ZipCrypto archives come from Info-ZIP; WinZip AES archives, Office
+// Agile and Standard documents and KDBX databases are written here from
+// their specifications (APPNOTE/AE-x, MS-OFFCRYPTO, MS-CFB, KeePass) with
+// Node's OpenSSL-backed crypto, independently of the Go code under test.
+//
+//   node gen.js   (needs zip on PATH)
+'use strict';
+
+const crypto = require('crypto');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const zlib = require('zlib');
+const { execFileSync } = require('child_process');
+
+const PASSWORD = 'Winter2024!';
+const NOTES = Buffer.from('password = Summer2025!\n');
+
+process.chdir(__dirname);
+
+// Fixed randomness, so regenerating gives identical files apart from the
+// encryption headers Info-ZIP randomizes
+let seed = crypto.createHash('sha256').update('azonk fixtures').digest();
+function random(n) {
+  const out = [];
+  let len = 0;
+  while (len < n) {
+    seed = crypto.createHash('sha256').update(seed).digest();
+    out.push(seed);
+    len += seed.length;
+  }
+  return Buffer.concat(out).subarray(0, n);
+}
+
+const u16 = (n) => { const b = Buffer.alloc(2); b.writeUInt16LE(n); return b; };
+const u32 = (n) => { const b = Buffer.alloc(4); b.writeUInt32LE(n >>> 0); return b; };
+const u64 = (n) => { const b = Buffer.alloc(8); b.writeBigUInt64LE(BigInt(n)); return b; };
+const sha = (alg, ...parts) => { const h = crypto.createHash(alg); parts.forEach((p) => h.update(p)); return h.digest(); };
+
+function aes(mode, key, iv, data) {
+  const c = crypto.createCipheriv(`aes-${key.length * 8}-${mode}`, key, iv);
+  c.setAutoPadding(false);
+  return Buffer.concat([c.update(data), c.final()]);
+}
+function padBlock(data, pad = 0) {
+  const n = Math.ceil(data.length / 16) * 16 || 16;
+  return Buffer.concat([data, Buffer.alloc(n - data.length, pad)]);
+}
+function fit(b, size, pad) {
+  return b.length >= size ? b.subarray(0, size) : Buffer.concat([b, Buffer.alloc(size - b.length, pad)]);
+}
+
+// =============================================================================
+// ZIP
+// =============================================================================
+
+// zipCrypto writes a ZipCrypto archive with Info-ZIP, once seekable and
+// once streamed, which sets the data descriptor flag.
+function zipCrypto() {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'azonk-'));
+  fs.writeFileSync(path.join(dir, 'notes.txt'), NOTES);
+  fs.utimesSync(path.join(dir, 'notes.txt'), new Date('2020-01-01T00:00:00Z'), new Date('2020-01-01T00:00:00Z'));
+  fs.rmSync('zipcrypto.zip', { force: true });
+  execFileSync('zip', ['-q', '-X', '-P', PASSWORD, path.resolve('zipcrypto.zip'), 'notes.txt'], { cwd: dir });
+  const streamed = execFileSync('zip', ['-q', '-X', '-P', PASSWORD, '-', 'notes.txt'], { cwd: dir });
+  fs.writeFileSync('zipcrypto-stream.zip', streamed);
+  fs.rmSync(dir, { recursive: true });
+}
+
+// zipAES writes a WinZip AE-2 archive with one deflated AES-256 entry.
+function zipAES() {
+  const strength = 3, keyLen = 32;
+  const salt = random(keyLen / 2);
+  const derived = crypto.pbkdf2Sync(PASSWORD, salt, 1000, 2 * keyLen + 2, 'sha1');
+  const compressed = zlib.deflateRawSync(NOTES);
+
+  // AES-CTR with a little-endian counter starting at 1
+  const key = derived.subarray(0, keyLen);
+  const enc = Buffer.alloc(compressed.length);
+  for (let i = 0, ctr = 1; i < compressed.length; i += 16, ctr++) {
+    const counter = Buffer.alloc(16);
+    counter.writeUInt32LE(ctr);
+    const stream = aes('ecb', key, null, counter);
+    for (let j = i; j < Math.min(i + 16, compressed.length); j++) enc[j] = compressed[j] ^ stream[j - i];
+  }
+  const mac = crypto.createHmac('sha1', derived.subarray(keyLen, 2 * keyLen)).update(enc).digest().subarray(0, 10);
+  const body = Buffer.concat([salt, derived.subarray(2 * keyLen), enc, mac]);
+
+  const name = Buffer.from('notes.txt');
+  const extra = Buffer.concat([u16(0x9901), u16(7), u16(2), Buffer.from('AE'), Buffer.from([strength]), u16(8)]);
+  const common = Buffer.concat([u16(51), u16(0x0001), u16(99), u16(0), u16(0x5021), u32(0), u32(body.length), u32(NOTES.length), u16(name.length), u16(extra.length)]);
+  const local = Buffer.concat([u32(0x04034b50), common, name, extra, body]);
+  const central = Buffer.concat([u32(0x02014b50), u16(51), common, u16(0), u16(0), u16(0), u32(0), u32(0), name, extra]);
+  const end = Buffer.concat([u32(0x06054b50), u16(0), u16(0), u16(1), u16(1), u32(central.length), u32(local.length), u16(0)]);
+  fs.writeFileSync('winzip-aes.zip', Buffer.concat([local, central, end]));
+}
+
+// =============================================================================
+// Compound File
+// =============================================================================
+
+// compoundFile writes a version 3 compound file holding the named streams
+// in the root storage. Streams under 4096 bytes go in the mini stream.
+function compoundFile(streams) {
+  const SECTOR = 512, MINI = 64, FREE = 0xFFFFFFFF, END = 0xFFFFFFFE, FATSECT = 0xFFFFFFFD;
+  const sectors = [];
+  const fat = [];
+  const chain = (data) => {
+    const start = sectors.length;
+    const n = Math.max(1, Math.ceil(data.length / SECTOR));
+    for (let i = 0; i < n; i++) {
+      sectors.push(fit(data.subarray(i * SECTOR, (i + 1) * SECTOR), SECTOR, 0));
+      fat.push(i === n - 1 ? END : start + i + 1);
+    }
+    return start;
+  };
+
+  const mini = [], miniFAT = [];
+  const entries = [];
+  for (const [name, data] of Object.entries(streams)) {
+    if (data.length < 4096) {
+      const start = mini.length;
+      const n = Math.ceil(data.length / MINI);
+      for (let i = 0; i < n; i++) {
+        mini.push(fit(data.subarray(i * MINI, (i + 1) * MINI), MINI, 0));
+        miniFAT.push(i === n - 1 ? END : start + i + 1);
+      }
+      entries.push({ name, type: 2, start, size: data.length });
+    } else {
+      entries.push({ name, type: 2, start: chain(data), size: data.length });
+    }
+  }
+
+  const miniStream = Buffer.concat(mini);
+  const rootStart = miniStream.length ? chain(miniStream) : END;
+  const miniFATBytes = Buffer.concat(miniFAT.map(u32));
+  const miniFATStart = miniFAT.length ? chain(fit(miniFATBytes, Math.ceil(miniFATBytes.length / SECTOR) * SECTOR, 0xFF)) : END;
+
+  // Directory: root, then the streams as a chain of right siblings
+  const entry = (name, type, child, right, start, size) => {
+    const b = Buffer.alloc(128);
+    const n = Buffer.from(name + '\0', 'utf16le');
+    n.copy(b);
+    b.writeUInt16LE(n.length, 64);
+    b[66] = type;
+    b[67] = 1; // Black
+    b.writeUInt32LE(FREE, 68);
+    b.writeUInt32LE(right, 72);
+    b.writeUInt32LE(child, 76);
+    b.writeUInt32LE(start >>> 0, 116);
+    b.writeBigUInt64LE(BigInt(size), 120);
+    return b;
+  };
+  const dir = [entry('Root Entry', 5, 1, FREE, rootStart, miniStream.length)];
+  entries.forEach((e, i) => dir.push(entry(e.name, e.type, FREE, i + 1 < entries.length ? i + 2 : FREE, e.start, e.size)));
+  while (dir.length % 4) dir.push(entry('', 0, FREE, FREE, 0, 0));
+  const dirStart = chain(Buffer.concat(dir));
+
+  // The FAT covers itself; one sector holds 128 entries
+  const fatStart = sectors.length;
+  fat.push(FATSECT);
+  sectors.push(Buffer.alloc(SECTOR));
+  if (fat.length > 128) throw new Error('fixture too large for one FAT sector');
+  sectors[fatStart] = fit(Buffer.concat(fat.map(u32)), SECTOR, 0xFF);
+
+  const header = Buffer.alloc(512, 0);
+  Buffer.from('d0cf11e0a1b11ae1', 'hex').copy(header);
+  header.writeUInt16LE(0x3E, 0x18);
+  header.writeUInt16LE(3, 0x1A);
+  header.writeUInt16LE(0xFFFE, 0x1C);
+  header.writeUInt16LE(9, 0x1E);
+  header.writeUInt16LE(6, 0x20);
+  header.writeUInt32LE(1, 0x2C);
+  header.writeUInt32LE(dirStart, 0x30);
+  header.writeUInt32LE(4096, 0x38);
+  header.writeUInt32LE(miniFATStart >>> 0, 0x3C);
+  header.writeUInt32LE(miniFAT.length ? 1 : 0, 0x40);
+  header.writeUInt32LE(END, 0x44);
+  for (let i = 0; i < 109; i++) header.writeUInt32LE(i === 0 ? fatStart : FREE, 0x4C + 4 * i);
+  return Buffer.concat([header, ...sectors]);
+}
+
+// =============================================================================
+// Office
+// =============================================================================
+
+// officePackage is the plaintext OOXML package: a zip holding notes.txt.
+function officePackage() {
+  const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'azonk-'));
+  fs.writeFileSync(path.join(dir, 'notes.txt'), NOTES);
+  fs.utimesSync(path.join(dir, 'notes.txt'), new Date('2020-01-01T00:00:00Z'), new Date('2020-01-01T00:00:00Z'));
+  const pkg = execFileSync('zip', ['-q', '-X', '-', 'notes.txt'], { cwd: dir });
+  fs.rmSync(dir, { recursive: true });
+  return pkg;
+}
+
+// officeAgile writes Agile encryption: AES-256, SHA-512, 100000 spins.
+function officeAgile(pkg) {
+  const spin = 100000, keyBits = 256, hashAlg = 'sha512';
+  const keySalt = random(16), dataSalt = random(16);
+  const secretKey = random(keyBits / 8);
+
+  let h = sha(hashAlg, keySalt, Buffer.from(PASSWORD, 'utf16le'));
+  for (let i = 0; i < spin; i++) h = sha(hashAlg, u32(i), h);
+  const derive = (block) => fit(sha(hashAlg, h, Buffer.from(block, 'hex')), keyBits / 8, 0x36);
+
+  const verifier = random(16);
+  const encInput = aes('cbc', derive('fea7d2763b4b9e79'), keySalt, verifier);
+  const encValue = aes('cbc', derive('d7aa0f6d3061344e'), keySalt, padBlock(sha(hashAlg, verifier)));
+  const encKey = aes('cbc', derive('146e0be7abacd0d6'), keySalt, padBlock(secretKey));
+
+  const segments = [];
+  for (let i = 0; i * 4096 < pkg.length; i++) {
+    const iv = sha(hashAlg, dataSalt, u32(i)).subarray(0, 16);
+    segments.push(aes('cbc', secretKey, iv, padBlock(pkg.subarray(i * 4096, (i + 1) * 4096))));
+  }
+
+  const b64 = (b) => b.toString('base64');
+  const params = `saltSize="16" blockSize="16" keyBits="${keyBits}" hashSize="64" cipherAlgorithm="AES" cipherChaining="ChainingModeCBC" hashAlgorithm="SHA512"`;
+  const xml = '<?xml version="1.0" encoding="UTF-8" standalone="yes"?>\r\n' +
+    '<encryption xmlns="http://schemas.microsoft.com/office/2006/encryption" xmlns:p="http://schemas.microsoft.com/office/2006/keyEncryptor/password">' +
+    `<keyData ${params} saltValue="${b64(dataSalt)}"/>` +
+    '<keyEncryptors><keyEncryptor uri="http://schemas.microsoft.com/office/2006/keyEncryptor/password">' +
+    `<p:encryptedKey spinCount="${spin}" ${params} saltValue="${b64(keySalt)}" encryptedVerifierHashInput="${b64(encInput)}" encryptedVerifierHashValue="${b64(encValue)}" encryptedKeyValue="${b64(encKey)}"/>` +
+    '</keyEncryptor></keyEncryptors></encryption>';
+
+  const info = Buffer.concat([u16(4), u16(4), u32(0x40), Buffer.from(xml)]);
+  const encrypted = Buffer.concat([u64(pkg.length), ...segments]);
+  fs.writeFileSync('agile.docx', compoundFile({ EncryptionInfo: info, EncryptedPackage: encrypted }));
+}
+
+// officeStandard writes Standard encryption: AES-128 ECB, SHA-1 50000.
+function officeStandard(pkg) {
+  const salt = random(16);
+  let h = sha('sha1', salt, Buffer.from(PASSWORD, 'utf16le'));
+  for (let i = 0; i < 50000; i++) h = sha('sha1', u32(i), h);
+  const final = sha('sha1', h, u32(0));
+  const xor = (pad) => { const b = Buffer.alloc(64, pad); for (let i = 0; i < final.length; i++) b[i] ^= final[i]; return sha('sha1', b); };
+  const key = Buffer.concat([xor(0x36), xor(0x5c)]).subarray(0, 16);
+
+  const verifier = random(16);
+  const encVerifier = aes('ecb', key, null, verifier);
+  const encVerifierHash = aes('ecb', key, null, padBlock(sha('sha1', verifier)));
+
+  const csp = Buffer.from('Microsoft Enhanced RSA and AES Cryptographic Provider\0', 'utf16le');
+  const header = Buffer.concat([u32(0x24), u32(0), u32(0x660E), u32(0x8004), u32(128), u32(0x18), u32(0), u32(0), csp]);
+  const info = Buffer.concat([
+    u16(4), u16(2), u32(0x24), u32(header.length), header,
+    u32(16), salt, encVerifier, u32(20), encVerifierHash,
+  ]);
+  const encrypted = Buffer.concat([u64(pkg.length), aes('ecb', key, null, padBlock(pkg))]);
+  fs.writeFileSync('standard.docx', compoundFile({ EncryptionInfo: info, EncryptedPackage: encrypted }));
+}
+
+// =============================================================================
+// KeePass
+// =============================================================================
+
+const AES_CIPHER = Buffer.from('31c1f2e6bf714350be5805216afc5aff', 'hex');
+const AES_KDF = Buffer.from('c9d9f39a628a4460bf740d08c18a4fea', 'hex');
+const ARGON2D = Buffer.from('ef636ddf8c29444b91f7a9a403e30a0c', 'hex');
+
+function aesKDF(transformSeed, rounds) {
+  let key = sha('sha256', sha('sha256', Buffer.from(PASSWORD)));
+  for (let i = 0; i < rounds; i++) key = aes('ecb', transformSeed, null, key);
+  return sha('sha256', key);
+}
+
+// kdbx3 writes a KDBX 3.1 database with AES-KDF and AES-256.
+function kdbx3() {
+  const rounds = 6000;
+  const masterSeed = random(32), transformSeed = random(32), iv = random(16);
+  const streamStart = random(32);
+  const field = (id, data) => Buffer.concat([Buffer.from([id]), u16(data.length), data]);
+  const header = Buffer.concat([
+    u32(0x9AA2D903), u32(0xB54BFB67), u32(0x00030001),
+    field(2, AES_CIPHER), field(3, u32(1)), field(4, masterSeed), field(5, transformSeed),
+    field(6, u64(rounds)), field(7, iv), field(8, random(32)), field(9, streamStart),
+    field(10, u32(2)), field(0, Buffer.from('\r\n\r\n')),
+  ]);
+
+  // The stream start bytes, then an empty hashed block ending the stream
+  const masterKey = sha('sha256', masterSeed, aesKDF(transformSeed, rounds));
+  const payload = Buffer.concat([streamStart, u32(0), Buffer.alloc(32), u32(0)]);
+  const c = crypto.createCipheriv('aes-256-cbc', masterKey, iv);
+  fs.writeFileSync('kdbx3.kdbx', Buffer.concat([header, c.update(payload), c.final()]));
+}
+
+// kdbx4 writes a KDBX 4.0 database with the given KDF parameter entries.
+// Without a transform seed the header HMAC is random.
+function kdbx4(file, kdf, transformSeed, rounds) {
+  const masterSeed = random(32);
+  const params = Buffer.concat([u16(0x0100), ...kdf, Buffer.from([0])]);
+  const field = (id, data) => Buffer.concat([Buffer.from([id]), u32(data.length), data]);
+  const header = Buffer.concat([
+    u32(0x9AA2D903), u32(0xB54BFB67), u32(0x00040000),
+    field(2, AES_CIPHER), field(3, u32(1)), field(4, masterSeed), field(7, random(16)),
+    field(11, params), field(0, Buffer.from('\r\n\r\n')),
+  ]);
+
+  let mac = random(32);
+  if (transformSeed) {
+    const hmacKey = sha('sha512', masterSeed, aesKDF(transformSeed, rounds), Buffer.from([1]));
+    const blockKey = sha('sha512', Buffer.alloc(8, 0xFF), hmacKey);
+    mac = crypto.createHmac('sha256', blockKey).update(header).digest();
+  }
+  fs.writeFileSync(file, Buffer.concat([header, sha('sha256', header), mac]));
+}
+
+// kdbx4Fixtures writes KDBX 4.0 databases with AES-KDF, which opens, and
+// Argon2d, which is only reported.
+function kdbx4Fixtures() {
+  const entry = (type, name, value) => Buffer.concat([Buffer.from([type]), u32(name.length), Buffer.from(name), u32(value.length), value]);
+  const seed = random(32), rounds = 6000;
+  kdbx4('kdbx4.kdbx', [entry(0x42, '$UUID', AES_KDF), entry(0x05, 'R', u64(rounds)), entry(0x42, 'S', seed)], seed, rounds);
+  kdbx4('kdbx4-argon2.kdbx', [
+    entry(0x42, '$UUID', ARGON2D), entry(0x05, 'I', u64(2)), entry(0x05, 'M', u64(64 << 20)),
+    entry(0x04, 'P', u32(2)), entry(0x42, 'S', random(32)), entry(0x04, 'V', u32(0x13)),
+  ]);
+}
+
+zipCrypto();
+zipAES();
+const pkg = officePackage();
+officeAgile(pkg);
+officeStandard(pkg);
+kdbx3();
+kdbx4Fixtures();
@@ -0,0 +1,206 @@
+// vba.go extracts VBA macro source from the VBA storage of a compound
+// file: vbaProject.bin in macro-enabled OOXML, or the macro storage of a
+// legacy .doc/.xls.
+package extract
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// VBA Projects
+// =============================================================================
+
+// dir stream record IDs (MS-OVBA 2.3.4.2).
+const (
+	vbaProjectVersion  = 0x0009
+	vbaModuleName      = 0x0019
+	vbaModuleStream    = 0x001A
+	vbaModuleOffset    = 0x0031
+	vbaModuleTerminate = 0x002B
+)
+
+type vbaModule struct {
+	name   string
+	stream string
+	offset uint32
+}
+
+// scanVBA scans the source of every module in each VBA project of a
+// compound file, located as "VBA!Module1".
+func (e *Extractor) scanVBA(file, location string, c *cfbFile, root *cfbNode, depth scanDepth) []types.SecretMatch {
+	var matches []types.SecretMatch
+	for _, vba := range vbaStorages(root) {
+		for _, m := range vbaModules(c, vba) {
+			data, err := c.read(vba.child(m.stream))
+			if err != nil || int(m.offset) > len(data) {
+				continue
+			}
+			source, err := ovbaDecompress(data[m.offset:])
+			if err != nil || len(source) == 0 {
+				continue
+			}
+
+			doc := document{
+				location: joinLocation(location, "VBA!"+m.name),
+				data:     vbaText(source),
+				region:   regionVBAModule,
+			}
+			matches = append(matches, e.scanText(file, doc, depth)...)
+		}
+	}
+	return matches
+}
+
+// vbaStorages finds the storages named VBA that hold a dir stream, at any
+// depth ("VBA" in vbaProject.bin, "Macros/VBA" in .doc,
+// "_VBA_PROJECT_CUR/VBA" in .xls).
+func vbaStorages(n *cfbNode) []*cfbNode {
+	var found []*cfbNode
+	for _, ch := range n.children {
+		if !ch.storage {
+			continue
+		}
+		if ch.name == "VBA" && ch.child("dir") != nil {
+			found = append(found, ch)
+			continue
+		}
+		found = append(found, vbaStorages(ch)...)
+	}
+	return found
+}
+
+// vbaModules parses the compressed dir stream for module names, their
+// streams and the offset of the compressed source within each stream.
+func vbaModules(c *cfbFile, vba *cfbNode) []vbaModule {
+	raw, err := c.read(vba.child("dir"))
+	if err != nil {
+		return nil
+	}
+	dir, err := ovbaDecompress(raw)
+	if err != nil {
+		return nil
+	}
+
+	var modules []vbaModule
+	var cur vbaModule
+	for pos := 0; pos+6 <= len(dir); {
+		id := binary.LittleEndian.Uint16(dir[pos:])
+		size := int(binary.LittleEndian.Uint32(dir[pos+2:]))
+		pos += 6
+
+		// PROJECTVERSION's size field is fixed at 4 but 6 bytes follow
+		if id == vbaProjectVersion {
+			size = 6
+		}
+		if size < 0 || pos+size > len(dir) {
+			break
+		}
+		body := dir[pos : pos+size]
+		pos += size
+
+		switch id {
+		case vbaModuleName:
+			cur.name = string(body)
+		case vbaModuleStream:
+			cur.stream = string(body)
+		case vbaModuleOffset:
+			if size == 4 {
+				cur.offset = binary.LittleEndian.Uint32(body)
+			}
+		case vbaModuleTerminate:
+			if cur.stream != "" {
+				if cur.name == "" {
+					cur.name = cur.stream
+				}
+				modules = append(modules, cur)
+			}
+			cur = vbaModule{}
+		}
+	}
+	return modules
+}
+
+// vbaText returns module source as UTF-8. Source is stored in the
+// project's ANSI code page; non-UTF-8 bytes are read as Latin-1.
+func vbaText(source []byte) []byte {
+	if utf8.Valid(source) {
+		return source
+	}
+	out := make([]byte, 0, len(source)+len(source)/8)
+	for _, b := range source {
+		out = utf8.AppendRune(out, rune(b))
+	}
+	return out
+}
+
+// =============================================================================
+// MS-OVBA Decompression
+// =============================================================================
+
+// ovbaDecompress decompresses a CompressedContainer (MS-OVBA 2.4.1): a
+// signature byte followed by chunks of up to 4096 decompressed bytes, each
+// either stored raw or as literal and copy tokens.
+func ovbaDecompress(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 1 {
+		return nil, errors.New("bad compressed container signature")
+	}
+
+	var out []byte
+	pos := 1
+	for pos+2 <= len(data) {
+		header := binary.LittleEndian.Uint16(data[pos:])
+		end := min(pos+int(header&0x0FFF)+3, len(data))
+		pos += 2
+		chunkStart := len(out)
+
+		if header&0x8000 == 0 {
+			raw := min(pos+4096, len(data))
+			out = append(out, data[pos:raw]...)
+			pos = raw
+			continue
+		}
+
+		for pos < end {
+			flags := data[pos]
+			pos++
+			for bit := 0; bit < 8 && pos < end; bit++ {
+				if flags&(1<<bit) == 0 {
+					out = append(out, data[pos])
+					pos++
+					continue
+				}
+
+				if pos+2 > end {
+					return nil, errors.New("truncated copy token")
+				}
+				token := int(binary.LittleEndian.Uint16(data[pos:]))
+				pos += 2
+
+				// The split between offset and length bits grows with
+				// the amount already decompressed in this chunk
+				bitCount := 4
+				for 1<<bitCount < len(out)-chunkStart {
+					bitCount++
+				}
+				lengthMask := 0xFFFF >> bitCount
+				length := token&lengthMask + 3
+				offset := token>>(16-bitCount) + 1
+
+				src := len(out) - offset
+				if src < chunkStart {
+					return nil, errors.New("copy token out of range")
+				}
+				for i := 0; i < length; i++ {
+					out = append(out, out[src+i])
+				}
+			}
+		}
+		pos = end
+	}
+	return out, nil
+}
@@ -0,0 +1,308 @@
+// zipcrypto.go recognizes ZIP archives with encrypted entries and decrypts
+// traditional PKWARE encryption (ZipCrypto) and WinZip AES.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+const (
+	zipFlagEncrypted  = 0x0001
+	zipFlagDescriptor = 0x0008 // CRC and sizes follow the data
+	zipFlagStrong     = 0x0040 // PKWARE strong encryption, not supported
+
+	zipMethodAES   = 99
+	zipExtraAES    = 0x9901
+	zipAESRounds   = 1000
+	zipAESMACSize  = 10
+	zipCryptoBytes = 12 // Encryption header before ZipCrypto data
+)
+
+// =============================================================================
+// Encrypted Archives
+// =============================================================================
+
+// encryptedZip is an archive with one or more encrypted entries.
+type encryptedZip struct {
+	p     *types.Protection
+	files []*zip.File
+}
+
+// zipEncryption reports whether an archive has encrypted entries,
+// describing the schemes they use.
+func zipEncryption(zr *zip.Reader) (*encryptedZip, bool) {
+	z := &encryptedZip{}
+	schemes := make(map[string]bool)
+	openable := true
+
+	for _, f := range zr.File {
+		if f.Flags&zipFlagEncrypted == 0 || f.FileInfo().IsDir() {
+			continue
+		}
+		z.files = append(z.files, f)
+
+		switch {
+		case f.Flags&zipFlagStrong != 0:
+			schemes["PKWARE strong encryption"] = true
+			openable = false
+		case f.Method == zipMethodAES:
+			if strength, _, ok := zipAESExtra(f); ok {
+				schemes[fmt.Sprintf("WinZip AES-%d", 64+64*strength)] = true
+			} else {
+				schemes["WinZip AES"] = true
+			}
+		default:
+			schemes["ZipCrypto"] = true
+		}
+	}
+	if len(z.files) == 0 {
+		return nil, false
+	}
+
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	z.p = &types.Protection{
+		Format:   "ZIP",
+		Scheme:   strings.Join(names, ", "),
+		Entries:  len(z.files),
+		Openable: openable,
+	}
+	if strings.Contains(z.p.Scheme, "AES") {
+		z.p.KDF = fmt.Sprintf("PBKDF2-SHA1 x%d", zipAESRounds)
+	}
+	return z, true
+}
+
+func (z *encryptedZip) protection() *types.Protection { return z.p }
+
+// open decrypts every encrypted entry. The first entry decides whether the
+// password is right; later entries that fail to decrypt are skipped.
+func (z *encryptedZip) open(password string) ([]protectedEntry, bool) {
+	var entries []protectedEntry
+	verified := false
+
+	for _, f := range z.files {
+		if f.UncompressedSize64 > config.MaxFileSizeForScan || f.CompressedSize64 > config.MaxFileSizeForScan {
+			continue
+		}
+
+		data, ok := decryptZipEntry(f, password)
+		if !ok {
+			if !verified {
+				return nil, false
+			}
+			continue
+		}
+		verified = true
+		entries = append(entries, protectedEntry{name: f.Name, data: data})
+	}
+	return entries, verified
+}
+
+// decryptZipEntry decrypts and decompresses an entry, checking its CRC
+// (ZipCrypto) or MAC (AES).
+func decryptZipEntry(f *zip.File, password string) ([]byte, bool) {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return nil, false
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, config.MaxFileSizeForScan))
+	if err != nil {
+		return nil, false
+	}
+
+	var compressed []byte
+	method := f.Method
+	if f.Method == zipMethodAES {
+		strength, actual, ok := zipAESExtra(f)
+		if !ok {
+			return nil, false
+		}
+		if compressed, ok = zipAESDecrypt(raw, []byte(password), strength); !ok {
+			return nil, false
+		}
+		method = actual
+	} else {
+		// The last header byte checks the password: the high byte of
+		// the CRC, or of the modification time when a data descriptor
+		// follows
+		check := byte(f.CRC32 >> 24)
+		if f.Flags&zipFlagDescriptor != 0 {
+			check = byte(f.ModifiedTime >> 8)
+		}
+		var ok bool
+		if compressed, ok = zipCryptoDecrypt(raw, []byte(password), check); !ok {
+			return nil, false
+		}
+	}
+
+	var data []byte
+	switch method {
+	case zip.Store:
+		data = compressed
+	case zip.Deflate:
+		fr := flate.NewReader(bytes.NewReader(compressed))
+		data, err = io.ReadAll(io.LimitReader(fr, config.MaxFileSizeForScan))
+		fr.Close()
+		if err != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	// AE-2 entries store no CRC; their MAC has already been checked
+	if f.CRC32 != 0 && crc32.ChecksumIEEE(data) != f.CRC32 {
+		return nil, false
+	}
+	return data, true
+}
+
+// =============================================================================
+// ZipCrypto
+// =============================================================================
+
+// zipCryptoKeys is the state of the traditional PKWARE stream cipher.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range password {
+		k.update(b)
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) decrypt(c byte) byte {
+	t := k[2] | 2
+	p := c ^ byte((t*(t^1))>>8)
+	k.update(p)
+	return p
+}
+
+// zipCryptoDecrypt decrypts an entry, checking the last byte of the
+// 12-byte encryption header first.
+func zipCryptoDecrypt(raw, password []byte, check byte) ([]byte, bool) {
+	if len(raw) < zipCryptoBytes {
+		return nil, false
+	}
+
+	k := newZipCryptoKeys(password)
+	var last byte
+	for _, c := range raw[:zipCryptoBytes] {
+		last = k.decrypt(c)
+	}
+	if last != check {
+		return nil, false
+	}
+
+	out := make([]byte, len(raw)-zipCryptoBytes)
+	for i, c := range raw[zipCryptoBytes:] {
+		out[i] = k.decrypt(c)
+	}
+	return out, true
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// =============================================================================
+// WinZip AES
+// =============================================================================
+
+// zipAESExtra reads the AES extra field: key strength (1-3 for AES-128,
+// 192 and 256) and the compression method of the plaintext.
+func zipAESExtra(f *zip.File) (int, uint16, bool) {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		body := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id == zipExtraAES && size >= 7 {
+			strength := int(body[4])
+			if strength < 1 || strength > 3 {
+				return 0, 0, false
+			}
+			return strength, binary.LittleEndian.Uint16(body[5:]), true
+		}
+	}
+	return 0, 0, false
+}
+
+// zipAESDecrypt checks the password verifier and MAC, then decrypts with
+// AES-CTR. Entries are laid out as salt, a 2-byte verifier, the data and a
+// 10-byte HMAC-SHA1.
+func zipAESDecrypt(raw, password []byte, strength int) ([]byte, bool) {
+	keyLen := 8 + 8*strength
+	saltLen := keyLen / 2
+	if len(raw) < saltLen+2+zipAESMACSize {
+		return nil, false
+	}
+	salt := raw[:saltLen]
+	verifier := raw[saltLen : saltLen+2]
+	data := raw[saltLen+2 : len(raw)-zipAESMACSize]
+	mac := raw[len(raw)-zipAESMACSize:]
+
+	derived := pbkdf2(password, salt, zipAESRounds, 2*keyLen+2, sha1.New)
+	if !bytes.Equal(derived[2*keyLen:], verifier) {
+		return nil, false
+	}
+
+	h := hmac.New(sha1.New, derived[keyLen:2*keyLen])
+	h.Write(data)
+	if !hmac.Equal(h.Sum(nil)[:zipAESMACSize], mac) {
+		return nil, false
+	}
+
+	block, err := aes.NewCipher(derived[:keyLen])
+	if err != nil {
+		return nil, false
+	}
+
+	// The counter is little-endian and starts at 1, unlike cipher.NewCTR
+	out := make([]byte, len(data))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < min(i+aes.BlockSize, len(data)); j++ {
+			out[j] = data[j] ^ stream[j-i]
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,257 @@
+// aggregate.go requests search aggregations (refiners) to show where hits
+// are concentrated by site, author, file type and age before anything is
+// downloaded.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Aggregation API Types
+// =============================================================================
+
+type aggregationOption struct {
+	Field            string           `json:"field"`
+	Size             int              `json:"size,omitempty"`
+	BucketDefinition bucketDefinition `json:"bucketDefinition"`
+}
+
+type bucketDefinition struct {
+	SortBy       string        `json:"sortBy"` // count, keyAsString or keyAsNumber
+	IsDescending bool          `json:"isDescending"`
+	MinimumCount int           `json:"minimumCount"`
+	Ranges       []bucketRange `json:"ranges,omitempty"`
+}
+
+type bucketRange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// aggregationFields maps the overview's dimensions to refinable search
+// schema properties, in display order.
+var aggregationFields = []struct {
+	name  string
+	field string
+}{
+	{"site", "SPSiteURL"},
+	{"author", "DisplayAuthor"},
+	{"extension", "FileType"},
+	{"modified", "LastModifiedTime"},
+}
+
+// =============================================================================
+// Aggregation Methods
+// =============================================================================
+
+// Aggregate runs each keyword, narrowed by the scope, as a file search that
+// returns hit counts by site, author, file type and modification age
+// instead of hits. Counts are then summed across keywords; a file matching
+// several keywords is counted once per keyword.
+func (c *Client) Aggregate(opts types.SearchOptions) (*types.SearchAggregates, error) {
+	ui.Info("Aggregating SharePoint/OneDrive hits...")
+
+	if err := validateScope(opts.Scope); err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+
+	options := aggregationOptions(time.Now())
+	result := &types.SearchAggregates{}
+
+	for _, keyword := range opts.Keywords {
+		query := joinKQL(kqlKeyword(keyword), scopeRestrictions(opts.Scope)...)
+		fmt.Printf("  %s\n", query)
+
+		// Hits are not needed, but a page size of one keeps the request valid
+		data, err := c.postSearch(types.EntityDriveItem, query, 1, options...)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+
+		r, err := parseAggregateResponse(data, query)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+		if r.TotalHits > 0 {
+			ui.Success("Found %d results", r.TotalHits)
+		}
+		result.Queries = append(result.Queries, *r)
+	}
+
+	result.Totals = sumAggregations(result.Queries)
+	printAggregates(result)
+	return result, nil
+}
+
+// aggregationOptions requests the top buckets for each dimension and
+// fixed age ranges for modification time. More buckets are requested than
+// are shown so that the totals across keywords are not cut short.
+func aggregationOptions(now time.Time) []aggregationOption {
+	day := func(days int) string {
+		return now.AddDate(0, 0, -days).UTC().Format(kqlDateLayout)
+	}
+
+	options := make([]aggregationOption, 0, len(aggregationFields))
+	for _, f := range aggregationFields {
+		opt := aggregationOption{
+			Field: f.field,
+			Size:  config.AggregationQueryBuckets,
+			BucketDefinition: bucketDefinition{
+				SortBy:       "count",
+				IsDescending: true,
+				MinimumCount: 1,
+			},
+		}
+		if f.name == "modified" {
+			opt.Size = 0
+			opt.BucketDefinition.SortBy = "keyAsString"
+			opt.BucketDefinition.Ranges = []bucketRange{
+				{To: day(365)},
+				{From: day(365), To: day(90)},
+				{From: day(90), To: day(30)},
+				{From: day(30)},
+			}
+		}
+		options = append(options, opt)
+	}
+	return options
+}
+
+// =============================================================================
+// Response Parsing
+// =============================================================================
+
+func parseAggregateResponse(data []byte, query string) (*types.AggregateResult, error) {
+	var response struct {
+		Value []struct {
+			HitsContainers []struct {
+				Total        int `json:"total"`
+				Aggregations []struct {
+					Field   string `json:"field"`
+					Buckets []struct {
+						Key         string `json:"key"`
+						Count       int    `json:"count"`
+						FilterToken string `json:"aggregationFilterToken"`
+					} `json:"buckets"`
+				} `json:"aggregations"`
+			} `json:"hitsContainers"`
+		} `json:"value"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+
+	result := &types.AggregateResult{Query: query}
+	if len(response.Value) == 0 || len(response.Value[0].HitsContainers) == 0 {
+		return result, nil
+	}
+
+	container := response.Value[0].HitsContainers[0]
+	result.TotalHits = container.Total
+	for _, a := range container.Aggregations {
+		agg := types.SearchAggregation{Name: aggregationName(a.Field), Field: a.Field}
+		for _, b := range a.Buckets {
+			agg.Buckets = append(agg.Buckets, types.AggregationBucket{Key: b.Key, Count: b.Count, Filter: b.FilterToken})
+		}
+		result.Aggregations = append(result.Aggregations, agg)
+	}
+	return result, nil
+}
+
+// aggregationName returns the dimension a schema property was requested
+// for, falling back to the property itself.
+func aggregationName(field string) string {
+	for _, f := range aggregationFields {
+		if f.field == field {
+			return f.name
+		}
+	}
+	return field
+}
+
+// sumAggregations adds up bucket counts across queries for each
+// dimension, keeping the largest buckets. A query that returned as many
+// buckets as it requested may have left out values counted by others, so
+// its dimension's totals are marked as lower bounds.
+func sumAggregations(results []types.AggregateResult) []types.SearchAggregation {
+	var totals []types.SearchAggregation
+	for _, f := range aggregationFields {
+		counts := make(map[string]int)
+		filters := make(map[string]string)
+		lowerBound := false
+		for _, r := range results {
+			for _, a := range r.Aggregations {
+				if a.Field != f.field {
+					continue
+				}
+				if len(a.Buckets) >= config.AggregationQueryBuckets {
+					lowerBound = true
+				}
+				for _, b := range a.Buckets {
+					counts[b.Key] += b.Count
+					if filters[b.Key] == "" {
+						filters[b.Key] = b.Filter
+					}
+				}
+			}
+		}
+
+		total := types.SearchAggregation{Name: f.name, Field: f.field, Buckets: []types.AggregationBucket{}, LowerBound: lowerBound}
+		for key, count := range counts {
+			total.Buckets = append(total.Buckets, types.AggregationBucket{Key: key, Count: count, Filter: filters[key]})
+		}
+		sort.Slice(total.Buckets, func(i, j int) bool {
+			a, b := total.Buckets[i], total.Buckets[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Key < b.Key
+		})
+		if len(total.Buckets) > config.AggregationBuckets {
+			total.Buckets = total.Buckets[:config.AggregationBuckets]
+		}
+		totals = append(totals, total)
+	}
+	return totals
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// printAggregates prints hit counts per keyword, then the combined
+// buckets for each dimension.
+func printAggregates(a *types.SearchAggregates) {
+	fmt.Println()
+	ui.Info("Hits by keyword")
+	for _, q := range a.Queries {
+		fmt.Printf("    %7d  %s\n", q.TotalHits, q.Query)
+	}
+
+	for _, agg := range a.Totals {
+		if len(agg.Buckets) == 0 {
+			continue
+		}
+		fmt.Println()
+		if agg.LowerBound {
+			ui.Info("Hits by %s (at least; some keywords had more values than were returned)", agg.Name)
+		} else {
+			ui.Info("Hits by %s", agg.Name)
+		}
+		for _, b := range agg.Buckets {
+			fmt.Printf("    %7d  %s\n", b.Count, b.Key)
+		}
+	}
+	fmt.Println()
+}
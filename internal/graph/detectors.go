@@ -0,0 +1,58 @@
+// detectors.go searches with queries derived from the extractor's
+// detectors (AKIA*, ghp_*), tagging each hit with the detector behind it.
+package graph
+
+import (
+	"fmt"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Detector Query Search
+// =============================================================================
+
+// SearchDetectorQueries runs each detector query as a file search, narrowed
+// by the scope, and returns the hits tagged with the detector that
+// inspired the query.
+func (c *Client) SearchDetectorQueries(queries []types.DetectorQuery, opts types.SearchOptions) ([]types.SearchResult, error) {
+	ui.Info("Searching SharePoint/OneDrive with detector queries...")
+
+	if opts.MaxPerQuery <= 0 {
+		opts.MaxPerQuery = config.DefaultMaxResultsPerQuery
+	}
+	if err := validateScope(opts.Scope); err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+
+	var results []types.SearchResult
+	seenIDs := make(map[string]bool)
+
+	for _, dq := range queries {
+		query := joinKQL(dq.Query, scopeRestrictions(opts.Scope)...)
+		fmt.Printf("  %s %s\n", query, ui.Dim("("+dq.Detector+")"))
+
+		result, err := c.SearchEntity(types.EntityDriveItem, query, opts.MaxPerQuery)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+
+		unique := deduplicateItems(result.Items, seenIDs)
+		if len(unique) == 0 {
+			continue
+		}
+		for i := range unique {
+			unique[i].Detector = dq.Detector
+		}
+
+		ui.Success("Found %d results (%d new)", result.TotalHits, len(unique))
+		result.Items = unique
+		results = append(results, *result)
+		printTopHits(unique, 3)
+	}
+
+	return results, nil
+}
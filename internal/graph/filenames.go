@@ -0,0 +1,95 @@
+// filenames.go hunts files that hold secrets by name alone (KeePass
+// databases, SSH keys, publish profiles), using a catalog of sensitive file
+// signatures instead of content keywords.
+package graph
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Filename Search
+// =============================================================================
+
+// SearchFileNames runs one query per sensitive file signature, narrowed by
+// the scope, and returns the hits whose names match a signature. Each hit
+// is tagged with its signature and download priority; hits a query returns
+// that match no signature (id_rsa.pub for id_rsa) are dropped.
+func (c *Client) SearchFileNames(opts types.SearchOptions) ([]types.SearchResult, error) {
+	ui.Info("Searching SharePoint/OneDrive by file name...")
+
+	if opts.MaxPerQuery <= 0 {
+		opts.MaxPerQuery = config.DefaultMaxResultsPerQuery
+	}
+	if err := validateScope(opts.Scope); err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+
+	var results []types.SearchResult
+	seenIDs := make(map[string]bool)
+
+	for _, sig := range config.FileSignatures() {
+		query := joinKQL(signatureQuery(sig), scopeRestrictions(opts.Scope)...)
+		fmt.Printf("  %s %s\n", query, ui.Dim("("+sig.Name+")"))
+
+		result, err := c.SearchEntity(types.EntityDriveItem, query, opts.MaxPerQuery)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+
+		var matched []types.DriveItem
+		for _, item := range result.Items {
+			if s, ok := MatchSignature(item.Name); ok {
+				item.Signature, item.Priority = s.Name, s.Priority
+				matched = append(matched, item)
+			}
+		}
+
+		unique := deduplicateItems(matched, seenIDs)
+		if len(unique) == 0 {
+			continue
+		}
+
+		ui.Success("Found %d %s files (%d new)", len(matched), sig.Name, len(unique))
+		result.Items = unique
+		results = append(results, *result)
+		printTopHits(unique, 3)
+	}
+
+	return results, nil
+}
+
+// signatureQuery ORs a filetype: or filename: restriction for each of a
+// signature's patterns.
+func signatureQuery(sig config.FileSignature) string {
+	var terms []string
+	for _, p := range sig.Patterns {
+		if ext, ok := strings.CutPrefix(p, "*."); ok {
+			terms = append(terms, "filetype:"+kqlValue(ext))
+		} else {
+			terms = append(terms, "filename:"+kqlValue(p))
+		}
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// MatchSignature returns the sensitive file signature a file name matches,
+// ignoring case.
+func MatchSignature(name string) (config.FileSignature, bool) {
+	name = strings.ToLower(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	for _, sig := range config.FileSignatures() {
+		for _, p := range sig.Patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return sig, true
+			}
+		}
+	}
+	return config.FileSignature{}, false
+}
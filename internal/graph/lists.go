@@ -0,0 +1,77 @@
+// lists.go reads SharePoint list items surfaced by search.
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// listSystemFields are columns every list has that hold no user content.
+var listSystemFields = map[string]bool{
+	"id":                true,
+	"ContentType":       true,
+	"Attachments":       true,
+	"Edit":              true,
+	"LinkTitle":         true,
+	"LinkTitleNoMenu":   true,
+	"DocIcon":           true,
+	"ItemChildCount":    true,
+	"FolderChildCount":  true,
+	"AuthorLookupId":    true,
+	"EditorLookupId":    true,
+	"AppAuthorLookupId": true,
+	"AppEditorLookupId": true,
+	"Created":           true,
+	"Modified":          true,
+}
+
+// ListItemFields retrieves the column values of a list item hit. System
+// columns are left out; non-string values are rendered as text.
+func (c *Client) ListItemFields(item types.DriveItem) (map[string]string, error) {
+	itemID := item.ListItemID
+	if itemID == "" {
+		itemID = item.ID
+	}
+	if item.SiteID == "" || item.ListID == "" || itemID == "" {
+		return nil, errors.New("list item hit is missing site, list or item ID")
+	}
+
+	endpoint := fmt.Sprintf("/sites/%s/lists/%s/items/%s?$expand=fields", item.SiteID, item.ListID, itemID)
+	data, err := c.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("parse list item: %w", err)
+	}
+
+	fields := make(map[string]string, len(response.Fields))
+	for name, value := range response.Fields {
+		if listSystemFields[name] || strings.HasPrefix(name, "@") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				fields[name] = v
+			}
+		case float64, bool:
+			fields[name] = fmt.Sprint(v)
+		default:
+			// Lookup, person and multi-choice columns
+			if raw, err := json.Marshal(v); err == nil {
+				fields[name] = string(raw)
+			}
+		}
+	}
+	return fields, nil
+}
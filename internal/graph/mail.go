@@ -0,0 +1,193 @@
+// mail.go searches the signed-in user's mailbox and fetches messages for
+// scanning.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Mail API Types
+// =============================================================================
+
+type messageHit struct {
+	Summary  string `json:"summary"`
+	Resource struct {
+		ID               string    `json:"id"`
+		Subject          string    `json:"subject"`
+		From             recipient `json:"from"`
+		ReceivedDateTime string    `json:"receivedDateTime"`
+		HasAttachments   bool      `json:"hasAttachments"`
+		WebLink          string    `json:"webLink"`
+	} `json:"resource"`
+}
+
+type message struct {
+	ID               string      `json:"id"`
+	Subject          string      `json:"subject"`
+	From             recipient   `json:"from"`
+	ToRecipients     []recipient `json:"toRecipients"`
+	CcRecipients     []recipient `json:"ccRecipients"`
+	ReceivedDateTime string      `json:"receivedDateTime"`
+	HasAttachments   bool        `json:"hasAttachments"`
+	WebLink          string      `json:"webLink"`
+}
+
+type recipient struct {
+	EmailAddress struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	} `json:"emailAddress"`
+}
+
+// String renders a recipient as "Name <address>".
+func (r recipient) String() string {
+	a := r.EmailAddress
+	switch {
+	case a.Name == "" || a.Name == a.Address:
+		return a.Address
+	case a.Address == "":
+		return a.Name
+	}
+	return fmt.Sprintf("%s <%s>", a.Name, a.Address)
+}
+
+func recipientList(rs []recipient) []string {
+	var out []string
+	for _, r := range rs {
+		if s := r.String(); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// =============================================================================
+// Mail Methods
+// =============================================================================
+
+// SearchMessages searches the signed-in user's mailbox with each keyword,
+// returning the matching messages without duplicates.
+func (c *Client) SearchMessages(opts types.SearchOptions) ([]types.MailMessage, error) {
+	ui.Info("Searching mailbox...")
+
+	if opts.MaxPerQuery <= 0 {
+		opts.MaxPerQuery = config.DefaultMaxResultsPerQuery
+	}
+
+	var messages []types.MailMessage
+	seenIDs := make(map[string]bool)
+
+	for _, keyword := range opts.Keywords {
+		query := kqlKeyword(keyword)
+		fmt.Printf("  %s\n", query)
+
+		found, total, err := c.searchMessages(query, opts.MaxPerQuery)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+
+		var unique []types.MailMessage
+		for _, m := range found {
+			if !seenIDs[m.ID] {
+				seenIDs[m.ID] = true
+				unique = append(unique, m)
+			}
+		}
+		if len(unique) == 0 {
+			continue
+		}
+
+		ui.Success("Found %d messages (%d new)", total, len(unique))
+		messages = append(messages, unique...)
+		for i, m := range unique {
+			if i >= 3 {
+				fmt.Printf("    ... and %d more\n", len(unique)-3)
+				break
+			}
+			fmt.Printf("    %s %s\n", m.Subject, ui.Dim("("+m.From+")"))
+		}
+	}
+
+	return messages, nil
+}
+
+// searchMessages runs a single message search query, returning the hits
+// and the total number of matches.
+func (c *Client) searchMessages(query string, maxResults int) ([]types.MailMessage, int, error) {
+	data, err := c.postSearch(types.EntityMessage, query, maxResults)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var response struct {
+		Value []struct {
+			HitsContainers []struct {
+				Total int          `json:"total"`
+				Hits  []messageHit `json:"hits"`
+			} `json:"hitsContainers"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, 0, fmt.Errorf("parse response: %w", err)
+	}
+	if len(response.Value) == 0 || len(response.Value[0].HitsContainers) == 0 {
+		return nil, 0, nil
+	}
+
+	container := response.Value[0].HitsContainers[0]
+	messages := make([]types.MailMessage, 0, len(container.Hits))
+	for _, hit := range container.Hits {
+		r := hit.Resource
+		messages = append(messages, types.MailMessage{
+			ID:             r.ID,
+			Subject:        r.Subject,
+			From:           r.From.String(),
+			Received:       r.ReceivedDateTime,
+			HasAttachments: r.HasAttachments,
+			WebLink:        r.WebLink,
+			MatchedOn:      query,
+			Summary:        hit.Summary,
+		})
+	}
+	return messages, container.Total, nil
+}
+
+// GetMessage retrieves a message's headers, including its recipients.
+func (c *Client) GetMessage(id string) (*types.MailMessage, error) {
+	endpoint := "/me/messages/" + url.PathEscape(id) +
+		"?$select=subject,from,toRecipients,ccRecipients,receivedDateTime,hasAttachments,webLink"
+	data, err := c.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse message: %w", err)
+	}
+
+	return &types.MailMessage{
+		ID:             id,
+		Subject:        m.Subject,
+		From:           m.From.String(),
+		To:             recipientList(m.ToRecipients),
+		Cc:             recipientList(m.CcRecipients),
+		Received:       m.ReceivedDateTime,
+		HasAttachments: m.HasAttachments,
+		WebLink:        m.WebLink,
+	}, nil
+}
+
+// GetMessageMIME retrieves a message as RFC 822 MIME, with its bodies and
+// attachments.
+func (c *Client) GetMessageMIME(id string) ([]byte, error) {
+	return c.Get("/me/messages/" + url.PathEscape(id) + "/$value")
+}
@@ -0,0 +1,187 @@
+// query.go builds KQL query strings for the search API from a keyword, the
+// file types to target and a scope of property restrictions.
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// kqlDateLayout is the date format KQL accepts for LastModifiedTime.
+const kqlDateLayout = "2006-01-02"
+
+// =============================================================================
+// Query Building
+// =============================================================================
+
+// buildQueries returns the queries run for one keyword: the keyword alone
+// and, with KQL enabled or file type hints given for the keyword, one per
+// file type. The scope is applied to each.
+func buildQueries(keyword string, opts types.SearchOptions) []string {
+	term := kqlKeyword(keyword)
+	scope := scopeRestrictions(opts.Scope)
+	queries := []string{joinKQL(term, scope...)}
+
+	fileTypes := opts.FileTypes
+	hints := opts.KeywordFileTypes[keyword]
+	if len(hints) > 0 {
+		fileTypes = hints
+	}
+
+	if (opts.IncludeKQL || len(hints) > 0) && len(fileTypes) > 0 {
+		for _, ft := range fileTypes {
+			ft = strings.TrimPrefix(ft, ".")
+			clauses := append([]string{"filetype:" + kqlValue(ft)}, scope...)
+			queries = append(queries, joinKQL(term, clauses...))
+		}
+	}
+
+	return queries
+}
+
+// joinKQL ANDs a keyword with restrictions. A keyword using boolean
+// operators is grouped so the restrictions apply to all of it.
+func joinKQL(term string, restrictions ...string) string {
+	if len(restrictions) == 0 {
+		return term
+	}
+	if hasBooleanOperator(term) {
+		term = "(" + term + ")"
+	}
+	return term + " " + strings.Join(restrictions, " ")
+}
+
+// scopeRestrictions renders a scope as KQL clauses, in a fixed order.
+func scopeRestrictions(s types.QueryScope) []string {
+	var clauses []string
+	for _, r := range []struct {
+		property string
+		values   []string
+	}{
+		{"site", s.Sites},
+		{"path", s.Paths},
+		{"author", s.Authors},
+		{"filename", s.FileNames},
+	} {
+		if clause := anyOf(r.property, r.values); clause != "" {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	for _, p := range s.ExcludePaths {
+		if v := kqlValue(p); v != "" {
+			clauses = append(clauses, "-path:"+v)
+		}
+	}
+
+	if !s.ModifiedAfter.IsZero() {
+		clauses = append(clauses, "LastModifiedTime>="+s.ModifiedAfter.UTC().Format(kqlDateLayout))
+	}
+	if !s.ModifiedBefore.IsZero() {
+		clauses = append(clauses, "LastModifiedTime<="+s.ModifiedBefore.UTC().Format(kqlDateLayout))
+	}
+	if s.MinSize > 0 {
+		clauses = append(clauses, fmt.Sprintf("Size>=%d", s.MinSize))
+	}
+	if s.MaxSize > 0 {
+		clauses = append(clauses, fmt.Sprintf("Size<=%d", s.MaxSize))
+	}
+
+	return clauses
+}
+
+// anyOf restricts a property to one of several values.
+func anyOf(property string, values []string) string {
+	var terms []string
+	for _, v := range values {
+		if v = kqlValue(v); v != "" {
+			terms = append(terms, property+":"+v)
+		}
+	}
+
+	switch len(terms) {
+	case 0:
+		return ""
+	case 1:
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// validateScope rejects scopes that could never match.
+func validateScope(s types.QueryScope) error {
+	if s.MinSize < 0 || s.MaxSize < 0 {
+		return errors.New("size limits must not be negative")
+	}
+	if s.MinSize > 0 && s.MaxSize > 0 && s.MinSize > s.MaxSize {
+		return fmt.Errorf("minimum size %d exceeds maximum size %d", s.MinSize, s.MaxSize)
+	}
+	if !s.ModifiedAfter.IsZero() && !s.ModifiedBefore.IsZero() && s.ModifiedAfter.After(s.ModifiedBefore) {
+		return fmt.Errorf("modified after %s is later than modified before %s",
+			s.ModifiedAfter.Format(kqlDateLayout), s.ModifiedBefore.Format(kqlDateLayout))
+	}
+	return nil
+}
+
+// =============================================================================
+// Escaping
+// =============================================================================
+
+// kqlKeyword prepares a search keyword. Plain words pass through, several
+// words become a quoted phrase and keywords already written as KQL are kept.
+// Unbalanced quotes are removed first.
+func kqlKeyword(keyword string) string {
+	keyword = strings.TrimSpace(keyword)
+	if strings.Count(keyword, `"`)%2 != 0 {
+		keyword = strings.ReplaceAll(keyword, `"`, "")
+	}
+	if isKQL(keyword) {
+		return keyword
+	}
+	if strings.ContainsAny(keyword, " \t") {
+		return `"` + keyword + `"`
+	}
+	return keyword
+}
+
+// kqlValue prepares a property value, quoting anything other than a simple
+// token. KQL has no escape for a double quote, so quotes are dropped. A
+// trailing * stays a prefix wildcard inside or outside quotes.
+func kqlValue(v string) string {
+	v = strings.TrimSpace(strings.ReplaceAll(v, `"`, ""))
+	if v == "" || isSimpleToken(v) {
+		return v
+	}
+	return `"` + v + `"`
+}
+
+// isKQL reports whether a keyword already uses KQL syntax: quoted
+// phrases, grouping, property restrictions or boolean operators.
+func isKQL(keyword string) bool {
+	return strings.ContainsAny(keyword, `"():`) || hasBooleanOperator(keyword)
+}
+
+func hasBooleanOperator(s string) bool {
+	for _, word := range strings.Fields(s) {
+		switch strings.Trim(word, "()") {
+		case "AND", "OR", "NOT":
+			return true
+		}
+	}
+	return false
+}
+
+func isSimpleToken(v string) bool {
+	for _, r := range v {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_', r == '*':
+		default:
+			return false
+		}
+	}
+	return true
+}
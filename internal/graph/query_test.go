@@ -0,0 +1,253 @@
+package graph
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+func TestKQLKeyword(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		{"password", "password"},
+		{"  password  ", "password"},
+		{"connection string", `"connection string"`},
+		{"client\tsecret", "\"client\tsecret\""},
+		{`"connection string"`, `"connection string"`},
+		{`password OR passwd`, `password OR passwd`},
+		{`(password OR passwd) AND prod`, `(password OR passwd) AND prod`},
+		{`filetype:xlsx password`, `filetype:xlsx password`},
+		{`"mot de passe`, `"mot de passe"`},  // Unbalanced quote dropped, then quoted
+		{`pass"word`, `password`},            // Unbalanced quote dropped
+		{`"a" "b`, `"a b"`},                  // Odd count drops every quote
+		{`say "hi" there`, `say "hi" there`}, // Balanced quotes are KQL
+		{`or and not`, `"or and not"`},       // Operators are upper case only
+		{`NOT draft`, `NOT draft`},
+	}
+
+	for _, tt := range tests {
+		if got := kqlKeyword(tt.keyword); got != tt.want {
+			t.Errorf("kqlKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestKQLValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"IT-Team_2024.v2", "IT-Team_2024.v2"},
+		{"backup*", "backup*"},
+		{"John Smith", `"John Smith"`},
+		{"https://contoso.sharepoint.com/sites/IT", `"https://contoso.sharepoint.com/sites/IT"`},
+		{`say "hi"`, `"say hi"`}, // KQL cannot escape a quote
+		{`"quoted"`, "quoted"},
+		{"Q3 report*", `"Q3 report*"`},
+		{`  "  "  `, ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := kqlValue(tt.value); got != tt.want {
+			t.Errorf("kqlValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestJoinKQL(t *testing.T) {
+	tests := []struct {
+		term         string
+		restrictions []string
+		want         string
+	}{
+		{"password", nil, "password"},
+		{"password OR passwd", nil, "password OR passwd"},
+		{"password", []string{"site:x"}, "password site:x"},
+		{"password OR passwd", []string{"site:x"}, "(password OR passwd) site:x"},
+		{"(password OR passwd)", []string{"site:x"}, "((password OR passwd)) site:x"},
+		{"secret AND NOT test", []string{"filetype:xlsx", "author:Bob"}, "(secret AND NOT test) filetype:xlsx author:Bob"},
+		{`"connection string"`, []string{"filetype:config"}, `"connection string" filetype:config`},
+	}
+
+	for _, tt := range tests {
+		if got := joinKQL(tt.term, tt.restrictions...); got != tt.want {
+			t.Errorf("joinKQL(%q, %q) = %q, want %q", tt.term, tt.restrictions, got, tt.want)
+		}
+	}
+}
+
+func TestScopeRestrictions(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(kqlDateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name  string
+		scope types.QueryScope
+		want  string
+	}{
+		{"empty", types.QueryScope{}, "[]"},
+		{
+			"one site",
+			types.QueryScope{Sites: []string{"https://contoso.sharepoint.com/sites/IT"}},
+			`[site:"https://contoso.sharepoint.com/sites/IT"]`,
+		},
+		{
+			"values of one property are ORed",
+			types.QueryScope{Authors: []string{"John Smith", "admin"}},
+			`[(author:"John Smith" OR author:admin)]`,
+		},
+		{
+			"properties are ANDed in a fixed order",
+			types.QueryScope{FileNames: []string{"web*"}, Authors: []string{"admin"}, Paths: []string{"a", "b"}, Sites: []string{"s"}},
+			`[site:s (path:a OR path:b) author:admin filename:web*]`,
+		},
+		{
+			"empty values dropped",
+			types.QueryScope{Sites: []string{"", `""`, "s"}, ExcludePaths: []string{" "}},
+			`[site:s]`,
+		},
+		{
+			"excluded paths",
+			types.QueryScope{ExcludePaths: []string{"https://x/Archive", "old"}},
+			`[-path:"https://x/Archive" -path:old]`,
+		},
+		{
+			"dates",
+			types.QueryScope{ModifiedAfter: day("2024-01-01"), ModifiedBefore: day("2024-06-30")},
+			`[LastModifiedTime>=2024-01-01 LastModifiedTime<=2024-06-30]`,
+		},
+		{
+			"dates in UTC",
+			types.QueryScope{ModifiedAfter: time.Date(2024, 1, 1, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*3600))},
+			`[LastModifiedTime>=2024-01-02]`,
+		},
+		{
+			"sizes",
+			types.QueryScope{MinSize: 1024, MaxSize: 10 << 20},
+			`[Size>=1024 Size<=10485760]`,
+		},
+		{
+			"everything",
+			types.QueryScope{
+				Sites:         []string{"s"},
+				ExcludePaths:  []string{"p"},
+				ModifiedAfter: day("2023-05-01"),
+				MaxSize:       500,
+			},
+			`[site:s -path:p LastModifiedTime>=2023-05-01 Size<=500]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(scopeRestrictions(tt.scope)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildQueries(t *testing.T) {
+	scope := types.QueryScope{Sites: []string{"a", "b"}, MinSize: 10}
+
+	tests := []struct {
+		name    string
+		keyword string
+		opts    types.SearchOptions
+		want    string
+	}{
+		{
+			"keyword alone",
+			"password",
+			types.SearchOptions{FileTypes: []string{"xlsx"}},
+			`[password]`,
+		},
+		{
+			"file types with KQL",
+			"password",
+			types.SearchOptions{IncludeKQL: true, FileTypes: []string{"xlsx", ".docx"}},
+			`[password password filetype:xlsx password filetype:docx]`,
+		},
+		{
+			"KQL without file types",
+			"password",
+			types.SearchOptions{IncludeKQL: true},
+			`[password]`,
+		},
+		{
+			"keyword hints replace file types",
+			"connection string",
+			types.SearchOptions{
+				FileTypes:        []string{"xlsx"},
+				KeywordFileTypes: map[string][]string{"connection string": {"config"}},
+			},
+			`["connection string" "connection string" filetype:config]`,
+		},
+		{
+			"scope on every query",
+			"password",
+			types.SearchOptions{IncludeKQL: true, FileTypes: []string{"txt"}, Scope: scope},
+			`[password (site:a OR site:b) Size>=10 password filetype:txt (site:a OR site:b) Size>=10]`,
+		},
+		{
+			"boolean keyword grouped under the scope",
+			"password OR passwd",
+			types.SearchOptions{IncludeKQL: true, FileTypes: []string{"txt"}, Scope: scope},
+			`[(password OR passwd) (site:a OR site:b) Size>=10 (password OR passwd) filetype:txt (site:a OR site:b) Size>=10]`,
+		},
+		{
+			"odd file type quoted",
+			"password",
+			types.SearchOptions{IncludeKQL: true, FileTypes: []string{"my type"}},
+			`[password password filetype:"my type"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(buildQueries(tt.keyword, tt.opts)); got != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	jan, jun := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		scope types.QueryScope
+		ok    bool
+	}{
+		{"empty", types.QueryScope{}, true},
+		{"size range", types.QueryScope{MinSize: 10, MaxSize: 20}, true},
+		{"equal sizes", types.QueryScope{MinSize: 10, MaxSize: 10}, true},
+		{"only a minimum", types.QueryScope{MinSize: 1 << 30}, true},
+		{"negative minimum", types.QueryScope{MinSize: -1}, false},
+		{"negative maximum", types.QueryScope{MaxSize: -1}, false},
+		{"minimum over maximum", types.QueryScope{MinSize: 20, MaxSize: 10}, false},
+		{"date range", types.QueryScope{ModifiedAfter: jan, ModifiedBefore: jun}, true},
+		{"same day", types.QueryScope{ModifiedAfter: jan, ModifiedBefore: jan}, true},
+		{"only after", types.QueryScope{ModifiedAfter: jun}, true},
+		{"after later than before", types.QueryScope{ModifiedAfter: jun, ModifiedBefore: jan}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateScope(tt.scope); (err == nil) != tt.ok {
+				t.Errorf("validateScope = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
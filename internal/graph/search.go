@@ -21,10 +21,11 @@ type searchRequest struct {
 }
 
 type searchRequestItem struct {
-	EntityTypes []string    `json:"entityTypes"`
-	Query       searchQuery `json:"query"`
-	From        int         `json:"from"`
-	Size        int         `json:"size"`
+	EntityTypes  []string            `json:"entityTypes"`
+	Query        searchQuery         `json:"query"`
+	From         int                 `json:"from"`
+	Size         int                 `json:"size"`
+	Aggregations []aggregationOption `json:"aggregations,omitempty"`
 }
 
 type searchQuery struct {
@@ -32,17 +33,25 @@ type searchQuery struct {
 }
 
 type searchHit struct {
+	Rank     int    `json:"rank"`
+	Summary  string `json:"summary"`
 	Resource struct {
 		ID              string `json:"id"`
 		Name            string `json:"name"`
+		DisplayName     string `json:"displayName"` // Sites and lists
 		WebURL          string `json:"webUrl"`
 		Size            int64  `json:"size"`
 		CreatedDateTime string `json:"createdDateTime"`
 		LastModified    string `json:"lastModifiedDateTime"`
 		ParentReference struct {
 			DriveID string `json:"driveId"`
+			SiteID  string `json:"siteId"`
 			Path    string `json:"path"`
 		} `json:"parentReference"`
+		SharepointIDs struct {
+			ListID     string `json:"listId"`
+			ListItemID string `json:"listItemId"`
+		} `json:"sharepointIds"`
 		CreatedBy struct {
 			User struct {
 				Email       string `json:"email"`
@@ -52,22 +61,50 @@ type searchHit struct {
 	} `json:"resource"`
 }
 
+// searchableEntities are the SharePoint/OneDrive entity types a content
+// search can target.
+var searchableEntities = map[string]bool{
+	types.EntityDriveItem: true,
+	types.EntityListItem:  true,
+	types.EntityList:      true,
+	types.EntitySite:      true,
+	types.EntityDrive:     true,
+}
+
 // =============================================================================
 // Search Methods
 // =============================================================================
 
-// Search performs a single search query against SharePoint/OneDrive.
+// Search performs a single search query for files in SharePoint/OneDrive.
 func (c *Client) Search(query string, maxResults int) (*types.SearchResult, error) {
+	return c.SearchEntity(types.EntityDriveItem, query, maxResults)
+}
+
+// SearchEntity performs a single search query for one entity type:
+// driveItem, listItem, list, site or drive.
+func (c *Client) SearchEntity(entityType, query string, maxResults int) (*types.SearchResult, error) {
 	if maxResults <= 0 {
 		maxResults = config.DefaultMaxResultsPerQuery
 	}
 
+	data, err := c.postSearch(entityType, query, maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSearchResponse(data, query, entityType)
+}
+
+// postSearch sends a single search request for one entity type, with any
+// aggregations, and returns the raw response.
+func (c *Client) postSearch(entityType, query string, size int, aggregations ...aggregationOption) ([]byte, error) {
 	req := searchRequest{
 		Requests: []searchRequestItem{{
-			EntityTypes: []string{"driveItem"},
-			Query:       searchQuery{QueryString: query},
-			From:        0,
-			Size:        maxResults,
+			EntityTypes:  []string{entityType},
+			Query:        searchQuery{QueryString: query},
+			From:         0,
+			Size:         size,
+			Aggregations: aggregations,
 		}},
 	}
 
@@ -81,7 +118,7 @@ func (c *Client) Search(query string, maxResults int) (*types.SearchResult, erro
 		return nil, fmt.Errorf("search query: %w", err)
 	}
 
-	return parseSearchResponse(data, query)
+	return data, nil
 }
 
 // SearchWithOptions performs credential hunting with configurable options.
@@ -91,32 +128,50 @@ func (c *Client) SearchWithOptions(opts types.SearchOptions) ([]types.SearchResu
 	if opts.MaxPerQuery <= 0 {
 		opts.MaxPerQuery = config.DefaultMaxResultsPerQuery
 	}
+	if err := validateScope(opts.Scope); err != nil {
+		return nil, fmt.Errorf("invalid scope: %w", err)
+	}
+	entityTypes := opts.EntityTypes
+	if len(entityTypes) == 0 {
+		entityTypes = []string{types.EntityDriveItem}
+	}
+	for _, et := range entityTypes {
+		if !searchableEntities[et] {
+			return nil, fmt.Errorf("unsupported entity type %q", et)
+		}
+	}
 
 	var results []types.SearchResult
 	seenIDs := make(map[string]bool)
 
 	for _, keyword := range opts.Keywords {
-		queries := buildQueries(keyword, opts.FileTypes, opts.IncludeKQL)
+		queries := buildQueries(keyword, opts)
 
 		for _, query := range queries {
 			fmt.Printf("  %s\n", query)
 
-			result, err := c.Search(query, opts.MaxPerQuery)
-			if err != nil {
-				ui.Error("Query failed: %v", err)
-				continue
-			}
-
-			if result.TotalHits == 0 {
-				continue
-			}
-
-			unique := deduplicateItems(result.Items, seenIDs)
-			if len(unique) > 0 {
-				ui.Success("Found %d results (%d new)", result.TotalHits, len(unique))
-				result.Items = unique
-				results = append(results, *result)
-				printTopHits(unique, 3)
+			for _, entityType := range entityTypes {
+				result, err := c.SearchEntity(entityType, query, opts.MaxPerQuery)
+				if err != nil {
+					ui.Error("Query failed: %v", err)
+					continue
+				}
+
+				if result.TotalHits == 0 {
+					continue
+				}
+
+				unique := deduplicateItems(result.Items, seenIDs)
+				if len(unique) > 0 {
+					if result.HoldsFiles() {
+						ui.Success("Found %d results (%d new)", result.TotalHits, len(unique))
+					} else {
+						ui.Success("Found %d %s results (%d new)", result.TotalHits, entityType, len(unique))
+					}
+					result.Items = unique
+					results = append(results, *result)
+					printTopHits(unique, 3)
+				}
 			}
 		}
 	}
@@ -142,7 +197,7 @@ func (c *Client) SearchForCredentials() ([]types.SearchResult, error) {
 // Response Parsing
 // =============================================================================
 
-func parseSearchResponse(data []byte, query string) (*types.SearchResult, error) {
+func parseSearchResponse(data []byte, query, entityType string) (*types.SearchResult, error) {
 	var response struct {
 		Value []struct {
 			HitsContainers []struct {
@@ -156,7 +211,7 @@ func parseSearchResponse(data []byte, query string) (*types.SearchResult, error)
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
 
-	result := &types.SearchResult{Query: query}
+	result := &types.SearchResult{Query: query, EntityType: entityType}
 
 	if len(response.Value) > 0 && len(response.Value[0].HitsContainers) > 0 {
 		container := response.Value[0].HitsContainers[0]
@@ -164,7 +219,7 @@ func parseSearchResponse(data []byte, query string) (*types.SearchResult, error)
 		result.Items = make([]types.DriveItem, 0, len(container.Hits))
 
 		for _, hit := range container.Hits {
-			item := hitToDriveItem(hit, query)
+			item := hitToDriveItem(hit, query, entityType)
 			result.Items = append(result.Items, item)
 		}
 	}
@@ -172,8 +227,8 @@ func parseSearchResponse(data []byte, query string) (*types.SearchResult, error)
 	return result, nil
 }
 
-func hitToDriveItem(hit searchHit, query string) types.DriveItem {
-	return types.DriveItem{
+func hitToDriveItem(hit searchHit, query, entityType string) types.DriveItem {
+	item := types.DriveItem{
 		ID:        hit.Resource.ID,
 		DriveID:   hit.Resource.ParentReference.DriveID,
 		Name:      hit.Resource.Name,
@@ -186,24 +241,30 @@ func hitToDriveItem(hit searchHit, query string) types.DriveItem {
 		Created:   hit.Resource.CreatedDateTime,
 		Modified:  hit.Resource.LastModified,
 		MatchedOn: query,
+		Summary:   hit.Summary,
+		Rank:      hit.Rank,
 	}
-}
-
-// =============================================================================
-// Query Building
-// =============================================================================
 
-func buildQueries(keyword string, fileTypes []string, includeKQL bool) []string {
-	queries := []string{keyword}
-
-	if includeKQL && len(fileTypes) > 0 {
-		for _, ft := range fileTypes {
-			ft = strings.TrimPrefix(ft, ".")
-			queries = append(queries, fmt.Sprintf("%s filetype:%s", keyword, ft))
-		}
+	// Sites and lists have a display name; list items often have no name
+	if item.Name == "" {
+		item.Name = hit.Resource.DisplayName
+	}
+	if item.Name == "" {
+		item.Name = hit.Resource.WebURL
 	}
 
-	return queries
+	switch entityType {
+	case types.EntitySite:
+		item.SiteID = hit.Resource.ID
+	case types.EntityList:
+		item.SiteID = hit.Resource.ParentReference.SiteID
+		item.ListID = hit.Resource.ID
+	case types.EntityListItem:
+		item.SiteID = hit.Resource.ParentReference.SiteID
+		item.ListID = hit.Resource.SharepointIDs.ListID
+		item.ListItemID = hit.Resource.SharepointIDs.ListItemID
+	}
+	return item
 }
 
 // =============================================================================
@@ -230,5 +291,30 @@ func printTopHits(items []types.DriveItem, limit int) {
 			break
 		}
 		fmt.Printf("    %s\n", item.Name)
+		if item.Summary != "" {
+			fmt.Printf("      %s\n", renderSnippet(item.Summary))
+		}
+	}
+}
+
+// renderSnippet puts a search snippet on one line with its hits
+// highlighted.
+func renderSnippet(summary string) string {
+	var b strings.Builder
+	rest := strings.ReplaceAll(summary, "<ddd/>", "...")
+	for {
+		start := strings.Index(rest, "<c0>")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "</c0>")
+		if end < 0 {
+			break
+		}
+		b.WriteString(rest[:start])
+		b.WriteString(ui.Highlight(rest[start+len("<c0>") : start+end]))
+		rest = rest[start+end+len("</c0>"):]
 	}
+	b.WriteString(strings.ReplaceAll(rest, "<c0>", ""))
+	return strings.Join(strings.Fields(b.String()), " ")
 }
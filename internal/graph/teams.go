@@ -0,0 +1,166 @@
+// teams.go searches Teams chat and channel messages and fetches their
+// content for scanning.
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// =============================================================================
+// Teams API Types
+// =============================================================================
+
+type chatMessageHit struct {
+	Summary  string `json:"summary"`
+	Resource struct {
+		ID              string    `json:"id"`
+		CreatedDateTime string    `json:"createdDateTime"`
+		WebLink         string    `json:"webLink"`
+		From            recipient `json:"from"`
+		ChatID          string    `json:"chatId"`
+		ChannelIdentity struct {
+			TeamID    string `json:"teamId"`
+			ChannelID string `json:"channelId"`
+		} `json:"channelIdentity"`
+	} `json:"resource"`
+}
+
+type chatMessageBody struct {
+	Body struct {
+		ContentType string `json:"contentType"`
+		Content     string `json:"content"`
+	} `json:"body"`
+	WebURL string `json:"webUrl"`
+}
+
+// =============================================================================
+// Teams Methods
+// =============================================================================
+
+// SearchChatMessages searches the Teams chats and channels the signed-in
+// user can read with each keyword, returning the matching messages
+// without duplicates.
+func (c *Client) SearchChatMessages(opts types.SearchOptions) ([]types.ChatMessage, error) {
+	ui.Info("Searching Teams messages...")
+
+	if opts.MaxPerQuery <= 0 {
+		opts.MaxPerQuery = config.DefaultMaxResultsPerQuery
+	}
+
+	var messages []types.ChatMessage
+	seenIDs := make(map[string]bool)
+
+	for _, keyword := range opts.Keywords {
+		query := kqlKeyword(keyword)
+		fmt.Printf("  %s\n", query)
+
+		found, total, err := c.searchChatMessages(query, opts.MaxPerQuery)
+		if err != nil {
+			ui.Error("Query failed: %v", err)
+			continue
+		}
+
+		var unique []types.ChatMessage
+		for _, m := range found {
+			if !seenIDs[m.ID] {
+				seenIDs[m.ID] = true
+				unique = append(unique, m)
+			}
+		}
+		if len(unique) == 0 {
+			continue
+		}
+
+		ui.Success("Found %d messages (%d new)", total, len(unique))
+		messages = append(messages, unique...)
+		for i, m := range unique {
+			if i >= 3 {
+				fmt.Printf("    ... and %d more\n", len(unique)-3)
+				break
+			}
+			fmt.Printf("    %s %s\n", m.Conversation(), ui.Dim("("+m.From+")"))
+		}
+	}
+
+	return messages, nil
+}
+
+// searchChatMessages runs a single Teams message search query, returning
+// the hits and the total number of matches.
+func (c *Client) searchChatMessages(query string, maxResults int) ([]types.ChatMessage, int, error) {
+	data, err := c.postSearch(types.EntityChatMessage, query, maxResults)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var response struct {
+		Value []struct {
+			HitsContainers []struct {
+				Total int              `json:"total"`
+				Hits  []chatMessageHit `json:"hits"`
+			} `json:"hitsContainers"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, 0, fmt.Errorf("parse response: %w", err)
+	}
+	if len(response.Value) == 0 || len(response.Value[0].HitsContainers) == 0 {
+		return nil, 0, nil
+	}
+
+	container := response.Value[0].HitsContainers[0]
+	messages := make([]types.ChatMessage, 0, len(container.Hits))
+	for _, hit := range container.Hits {
+		r := hit.Resource
+		messages = append(messages, types.ChatMessage{
+			ID:        r.ID,
+			ChatID:    r.ChatID,
+			TeamID:    r.ChannelIdentity.TeamID,
+			ChannelID: r.ChannelIdentity.ChannelID,
+			From:      r.From.String(),
+			Created:   r.CreatedDateTime,
+			WebURL:    r.WebLink,
+			MatchedOn: query,
+			Summary:   hit.Summary,
+		})
+	}
+	return messages, container.Total, nil
+}
+
+// GetChatMessageContent retrieves the full body of a chat or channel
+// message, which is HTML or text. Messages without a deep link get the
+// one returned with the body.
+func (c *Client) GetChatMessageContent(msg *types.ChatMessage) (string, error) {
+	var endpoint string
+	switch {
+	case msg.TeamID != "" && msg.ChannelID != "":
+		endpoint = fmt.Sprintf("/teams/%s/channels/%s/messages/%s",
+			url.PathEscape(msg.TeamID), url.PathEscape(msg.ChannelID), url.PathEscape(msg.ID))
+	case msg.ChatID != "":
+		endpoint = fmt.Sprintf("/chats/%s/messages/%s", url.PathEscape(msg.ChatID), url.PathEscape(msg.ID))
+	default:
+		return "", errors.New("message hit has no chat or channel")
+	}
+
+	data, err := c.Get(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	var m chatMessageBody
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", fmt.Errorf("parse message: %w", err)
+	}
+
+	if msg.WebURL == "" {
+		msg.WebURL = m.WebURL
+	}
+	return m.Body.Content, nil
+}
@@ -12,7 +12,7 @@ import (
 func (c *Client) EnumerateUsers() ([]types.User, error) {
 	ui.Info("Enumerating Azure AD users...")
 
-	endpoint := "/users?$select=id,displayName,userPrincipalName,mail,jobTitle,department,accountEnabled&$top=999"
+	endpoint := "/users?$select=id,displayName,userPrincipalName,mail,jobTitle,department,preferredLanguage,accountEnabled&$top=999"
 
 	results, err := c.GetAllPages(endpoint, 0)
 	if err != nil {
@@ -2,12 +2,17 @@
 package hunt
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/loosehose/azonk/internal/config"
 	"github.com/loosehose/azonk/internal/download"
 	"github.com/loosehose/azonk/internal/extract"
 	"github.com/loosehose/azonk/internal/graph"
+	"github.com/loosehose/azonk/internal/keywords"
 	"github.com/loosehose/azonk/internal/types"
 	"github.com/loosehose/azonk/internal/ui"
 )
@@ -34,6 +39,9 @@ func NewHunter(accessToken, outputDir string) *Hunter {
 func (h *Hunter) Run(opts types.SearchOptions) (*types.HuntResult, error) {
 	ui.Header("Credential Hunt")
 
+	if err := h.extractor.AddLanguages(opts.Languages...); err != nil {
+		return nil, err
+	}
 	result := &types.HuntResult{}
 
 	// Phase 1: Search
@@ -42,6 +50,29 @@ func (h *Hunter) Run(opts types.SearchOptions) (*types.HuntResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %w", err)
 	}
+	queriesRun := len(opts.Keywords)
+
+	// Signature and detector hits go first so files also found by keyword
+	// keep their tags and download priority
+	var tagged []types.SearchResult
+	if opts.FileNames {
+		nameResults, err := h.client.SearchFileNames(opts)
+		if err != nil {
+			return nil, fmt.Errorf("filename search failed: %w", err)
+		}
+		tagged = append(tagged, nameResults...)
+		queriesRun += len(config.FileSignatures())
+	}
+	if opts.DetectorQueries {
+		queries := h.extractor.SearchQueries()
+		detectorResults, err := h.client.SearchDetectorQueries(queries, opts)
+		if err != nil {
+			return nil, fmt.Errorf("detector search failed: %w", err)
+		}
+		tagged = append(tagged, detectorResults...)
+		queriesRun += len(queries)
+	}
+	searchResults = append(tagged, searchResults...)
 	result.SearchResults = searchResults
 
 	totalHits, uniqueItems := aggregateSearchResults(searchResults)
@@ -51,10 +82,13 @@ func (h *Hunter) Run(opts types.SearchOptions) (*types.HuntResult, error) {
 	if opts.AutoDownload && len(uniqueItems) > 0 {
 		ui.Phase(2, "Downloading files")
 
-		extensions := opts.FileTypes
+		extensions := append([]string(nil), opts.FileTypes...)
 		if len(extensions) == 0 {
 			extensions = config.HighValueExtensions()
 		}
+		for _, hints := range opts.KeywordFileTypes {
+			extensions = append(extensions, hints...)
+		}
 
 		downloaded := h.downloader.DownloadFromSearchResults(searchResults, extensions)
 		result.DownloadedFiles = downloaded
@@ -62,18 +96,45 @@ func (h *Hunter) Run(opts types.SearchOptions) (*types.HuntResult, error) {
 		// Phase 3: Extract secrets (if enabled)
 		if opts.ExtractSecret && len(downloaded) > 0 {
 			ui.Phase(3, "Extracting secrets")
+			h.extractor.SetOpenProtected(opts.OpenProtected)
 			secrets := h.extractor.ScanDownloadedFiles(downloaded)
 			result.SecretsFound = secrets
 			h.extractor.PrintMatches(secrets)
 		}
 	}
 
+	// Phase 4: Read list items (if extraction enabled). List items have no
+	// file to download, so their columns are scanned directly
+	listItemsRead := 0
+	if opts.ExtractSecret {
+		if items := listItemHits(searchResults); len(items) > 0 {
+			ui.Phase(4, "Reading list items")
+			var secrets []types.SecretMatch
+			secrets, listItemsRead = h.scanListItems(items)
+			result.SecretsFound = append(result.SecretsFound, secrets...)
+			h.extractor.PrintMatches(secrets)
+		}
+	}
+
+	// Phase 5: Teams messages (if enabled)
+	chatsScanned := 0
+	if opts.Teams {
+		ui.Phase(5, "Hunting Teams messages")
+		var secrets []types.SecretMatch
+		result.ChatMessages, secrets, chatsScanned = h.huntTeams(opts)
+		result.SecretsFound = append(result.SecretsFound, secrets...)
+		totalHits += len(result.ChatMessages)
+		h.extractor.PrintMatches(secrets)
+	}
+
 	// Build summary
 	result.Summary = types.HuntSummary{
-		QueriesRun:      len(opts.Keywords),
+		QueriesRun:      queriesRun,
 		TotalHits:       totalHits,
 		UniqueFiles:     len(uniqueItems),
 		FilesDownloaded: len(result.DownloadedFiles),
+		ListItemsRead:   listItemsRead,
+		ChatsScanned:    chatsScanned,
 		SecretsFound:    len(result.SecretsFound),
 	}
 
@@ -89,21 +150,108 @@ func (h *Hunter) QuickHunt() (*types.HuntResult, error) {
 		MaxPerQuery:   config.DefaultMaxResultsPerQuery,
 		AutoDownload:  true,
 		ExtractSecret: true,
+		EntityTypes:   []string{types.EntityDriveItem, types.EntityListItem},
 	}
 	return h.Run(opts)
 }
 
-// SearchOnly performs search without downloading or extracting.
-func (h *Hunter) SearchOnly(keywords []string, fileTypes []string, useKQL bool) ([]types.SearchResult, error) {
+// SearchOnly performs search without downloading or extracting, narrowed
+// by the given scope.
+func (h *Hunter) SearchOnly(keywords []string, fileTypes []string, useKQL bool, scope types.QueryScope) ([]types.SearchResult, error) {
 	opts := types.SearchOptions{
 		Keywords:    keywords,
 		FileTypes:   fileTypes,
 		MaxPerQuery: config.DefaultMaxResultsPerQuery,
 		IncludeKQL:  useKQL,
+		Scope:       scope,
 	}
 	return h.client.SearchWithOptions(opts)
 }
 
+// PreviewSnippets scans the snippets returned with search hits for secrets
+// without downloading anything, listing the files worth fetching.
+func (h *Hunter) PreviewSnippets(results []types.SearchResult) []types.SecretMatch {
+	var items []types.DriveItem
+	for _, sr := range results {
+		items = append(items, sr.Items...)
+	}
+	ui.Info("Scanning %d search snippets for secrets...", len(items))
+
+	secrets := h.extractor.ScanSnippets(items)
+	if len(secrets) == 0 {
+		ui.Info("No secrets in snippets; download files to scan them in full")
+		return nil
+	}
+
+	h.extractor.PrintMatches(secrets)
+	flagged := make(map[string]bool)
+	for _, s := range secrets {
+		// Provenance is optional; fall back to the item name or file
+		ref := s.SourceItem
+		if s.Provenance != nil && s.Provenance.WebURL != "" {
+			ref = s.Provenance.WebURL
+		}
+		if ref == "" {
+			ref = s.File
+		}
+		if !flagged[ref] {
+			flagged[ref] = true
+			ui.Item("%s", ref)
+		}
+	}
+	ui.Success("%d potential secrets in the snippets of %d files", len(secrets), len(flagged))
+	return secrets
+}
+
+// Aggregate reports where search hits are concentrated, by site, author,
+// file type and age, without downloading anything.
+func (h *Hunter) Aggregate(opts types.SearchOptions) (*types.SearchAggregates, error) {
+	return h.client.Aggregate(opts)
+}
+
+// SaveAggregates writes search aggregates to the output directory as JSON
+// and returns the file path.
+func (h *Hunter) SaveAggregates(a *types.SearchAggregates) (string, error) {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal aggregates: %w", err)
+	}
+	path := filepath.Join(h.outputDir, config.AggregatesFileName)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("write aggregates: %w", err)
+	}
+	return path, nil
+}
+
+// SuggestLanguages enumerates the tenant's users and returns the language
+// packs their preferred languages call for, for the caller to add.
+func (h *Hunter) SuggestLanguages() ([]string, error) {
+	users, err := h.client.EnumerateUsers()
+	if err != nil {
+		return nil, fmt.Errorf("enumerate users: %w", err)
+	}
+
+	codes := keywords.SuggestLanguages(users)
+	packs := config.LanguagePacks()
+	for _, code := range codes {
+		ui.Info("Suggested language pack: %s (%s)", code, packs[code].Name)
+	}
+	if len(codes) == 0 {
+		ui.Info("No language packs suggested")
+	}
+	return codes, nil
+}
+
+// SaveSARIF writes the secrets found by a hunt to the output directory as
+// SARIF 2.1.0 and returns the file path.
+func (h *Hunter) SaveSARIF(result *types.HuntResult) (string, error) {
+	path := filepath.Join(h.outputDir, config.SARIFFileName)
+	if err := h.extractor.SaveSARIF(path, result.SecretsFound); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
 // GetDownloadDir returns the path where files are downloaded.
 func (h *Hunter) GetDownloadDir() string {
 	return h.downloader.GetOutputDir()
@@ -119,6 +267,9 @@ func aggregateSearchResults(results []types.SearchResult) (int, map[string]types
 
 	for _, sr := range results {
 		totalHits += sr.TotalHits
+		if !sr.HoldsFiles() {
+			continue
+		}
 		for _, item := range sr.Items {
 			uniqueItems[item.ID] = item
 		}
@@ -127,12 +278,58 @@ func aggregateSearchResults(results []types.SearchResult) (int, map[string]types
 	return totalHits, uniqueItems
 }
 
+// listItemHits collects the list items among search hits.
+func listItemHits(results []types.SearchResult) []types.DriveItem {
+	var items []types.DriveItem
+	for _, sr := range results {
+		if sr.EntityType == types.EntityListItem {
+			items = append(items, sr.Items...)
+		}
+	}
+	return items
+}
+
+// scanListItems reads the columns of each list item and scans them,
+// returning the findings and how many items could be read.
+func (h *Hunter) scanListItems(items []types.DriveItem) ([]types.SecretMatch, int) {
+	ui.Info("Reading %d list items...", len(items))
+
+	var secrets []types.SecretMatch
+	read := 0
+	for i, item := range items {
+		fmt.Printf("  [%d/%d] %s\n", i+1, len(items), item.Name)
+
+		fields, err := h.client.ListItemFields(item)
+		if err != nil {
+			ui.Error("Failed: %v", err)
+			continue
+		}
+		read++
+		secrets = append(secrets, h.extractor.ScanListItem(item, fields)...)
+		time.Sleep(config.RateLimitDelay)
+	}
+
+	ui.Success("Extracted %d potential secrets from %d list items", len(secrets), read)
+	return secrets, read
+}
+
 func (h *Hunter) printSummary(s types.HuntSummary) {
 	ui.Header("Summary")
 	ui.Stat("Queries run", s.QueriesRun)
 	ui.Stat("Total hits", s.TotalHits)
-	ui.Stat("Unique files", s.UniqueFiles)
-	ui.Stat("Files downloaded", s.FilesDownloaded)
+	if s.UniqueFiles > 0 || s.MessagesScanned == 0 {
+		ui.Stat("Unique files", s.UniqueFiles)
+		ui.Stat("Files downloaded", s.FilesDownloaded)
+	}
+	if s.ListItemsRead > 0 {
+		ui.Stat("List items read", s.ListItemsRead)
+	}
+	if s.MessagesScanned > 0 {
+		ui.Stat("Messages scanned", s.MessagesScanned)
+	}
+	if s.ChatsScanned > 0 {
+		ui.Stat("Teams messages scanned", s.ChatsScanned)
+	}
 
 	if s.SecretsFound > 0 {
 		ui.StatHighlight("Secrets found", s.SecretsFound)
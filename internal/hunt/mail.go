@@ -0,0 +1,126 @@
+// mail.go hunts the signed-in user's mailbox for credentials.
+package hunt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// RunMail searches the mailbox with the given keywords and, with
+// extraction enabled, fetches each matching message as MIME and scans its
+// bodies and attachments.
+func (h *Hunter) RunMail(opts types.SearchOptions) (*types.HuntResult, error) {
+	ui.Header("Mail Hunt")
+
+	if err := h.extractor.AddLanguages(opts.Languages...); err != nil {
+		return nil, err
+	}
+	result := &types.HuntResult{}
+
+	// Phase 1: Search
+	ui.Phase(1, "Searching mailbox")
+	messages, err := h.client.SearchMessages(opts)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	ui.Success("Found %d messages", len(messages))
+
+	// Phase 2: Fetch and scan (if enabled)
+	scanned := 0
+	if opts.ExtractSecret && len(messages) > 0 {
+		ui.Phase(2, "Scanning messages")
+		h.extractor.SetOpenProtected(opts.OpenProtected)
+		result.SecretsFound, scanned = h.scanMessages(messages)
+		h.extractor.PrintMatches(result.SecretsFound)
+	}
+	result.Messages = messages
+
+	result.Summary = types.HuntSummary{
+		QueriesRun:      len(opts.Keywords),
+		TotalHits:       len(messages),
+		MessagesScanned: scanned,
+		SecretsFound:    len(result.SecretsFound),
+	}
+
+	h.printSummary(result.Summary)
+	return result, nil
+}
+
+// scanMessages fetches each message's recipients and MIME content and
+// scans it, returning the findings and how many messages were scanned.
+// Messages are updated in place with their recipients. Every message is
+// scanned before protected content is retried, so a password mailed later
+// can open an attachment sent earlier.
+func (h *Hunter) scanMessages(messages []types.MailMessage) ([]types.SecretMatch, int) {
+	ui.Info("Fetching %d messages...", len(messages))
+
+	results, errs := h.extractor.ScanReaders(len(messages), func(i int) (io.Reader, string, error) {
+		msg := &messages[i]
+		fmt.Printf("  [%d/%d] %s\n", i+1, len(messages), msg.Subject)
+		if i > 0 {
+			time.Sleep(config.RateLimitDelay)
+		}
+
+		if full, err := h.client.GetMessage(msg.ID); err == nil {
+			full.MatchedOn, full.Summary = msg.MatchedOn, msg.Summary
+			*msg = *full
+		}
+
+		mime, err := h.client.GetMessageMIME(msg.ID)
+		if err != nil {
+			ui.Error("Failed: %v", err)
+			return nil, "", err
+		}
+		return bytes.NewReader(mime), messageFileName(*msg), nil
+	})
+
+	var secrets []types.SecretMatch
+	scanned := 0
+	for i, matches := range results {
+		if errs[i] == nil {
+			scanned++
+		}
+
+		msg := messages[i]
+		for j := range matches {
+			m := &matches[j]
+			m.SourceItem = msg.Subject
+			m.Mail = &msg
+			if p := m.Provenance; p != nil {
+				p.Name = msg.Subject
+				p.WebURL = msg.WebLink
+				p.Query = msg.MatchedOn
+			}
+		}
+		secrets = append(secrets, matches...)
+	}
+
+	ui.Success("Extracted %d potential secrets from %d messages", len(secrets), scanned)
+	return secrets, scanned
+}
+
+// messageFileName names a message's findings after its subject, as the
+// .eml file it would be saved as.
+func messageFileName(msg types.MailMessage) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(msg.Subject))
+
+	if name == "" {
+		name = "message"
+	}
+	if r := []rune(name); len(r) > 80 {
+		name = string(r[:80])
+	}
+	return name + ".eml"
+}
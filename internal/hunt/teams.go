@@ -0,0 +1,50 @@
+// teams.go hunts Teams chat and channel messages for credentials as part
+// of a hunt.
+package hunt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+	"github.com/loosehose/azonk/internal/ui"
+)
+
+// huntTeams searches Teams messages with the hunt's keywords and, with
+// extraction enabled, fetches and scans each one. It returns the messages,
+// the findings and how many messages were scanned.
+func (h *Hunter) huntTeams(opts types.SearchOptions) ([]types.ChatMessage, []types.SecretMatch, int) {
+	messages, err := h.client.SearchChatMessages(opts)
+	if err != nil {
+		ui.Error("Teams search failed: %v", err)
+		return nil, nil, 0
+	}
+	ui.Success("Found %d Teams messages", len(messages))
+	if !opts.ExtractSecret || len(messages) == 0 {
+		return messages, nil, 0
+	}
+
+	ui.Info("Fetching %d messages...", len(messages))
+	var secrets []types.SecretMatch
+	scanned := 0
+	for i := range messages {
+		msg := &messages[i]
+		fmt.Printf("  [%d/%d] %s\n", i+1, len(messages), msg.Conversation())
+
+		// Replies in channels cannot be fetched without their parent; the
+		// search snippet is scanned instead
+		content, err := h.client.GetChatMessageContent(msg)
+		if err != nil {
+			ui.Warning("Scanning snippet only: %v", err)
+			content = types.StripHighlights(msg.Summary)
+		}
+
+		secrets = append(secrets, h.extractor.ScanChatMessage(*msg, content)...)
+		scanned++
+		time.Sleep(config.RateLimitDelay)
+	}
+
+	ui.Success("Extracted %d potential secrets from %d Teams messages", len(secrets), scanned)
+	return messages, secrets, scanned
+}
@@ -0,0 +1,235 @@
+// Package keywords assembles search keywords from built-in profiles,
+// wordlist files and individual terms, with optional file type hints per
+// keyword, and language packs that add non-English credential terms.
+//
+// Wordlists have one keyword per line. Blank lines and lines starting with
+// # are ignored. A keyword may be followed by "|" and a comma-separated
+// list of file types, which narrows its KQL queries to those types:
+//
+//	# Database credentials
+//	connection string | config, xml, json
+//	sa password
+package keywords
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// Set is an ordered list of keywords without duplicates (ignoring case),
+// with the file type hints given for them.
+type Set struct {
+	keywords  []string
+	fileTypes map[string][]string
+	seen      map[string]string // Lowercase keyword to the spelling kept
+	languages []string          // Language packs added, by code
+}
+
+// NewSet creates an empty keyword set.
+func NewSet() *Set {
+	return &Set{
+		fileTypes: make(map[string][]string),
+		seen:      make(map[string]string),
+	}
+}
+
+// Profiles returns the names of the built-in profiles, sorted.
+func Profiles() []string {
+	var names []string
+	for name := range config.KeywordProfiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Languages returns the codes of the built-in language packs, sorted.
+func Languages() []string {
+	var codes []string
+	for code := range config.LanguagePacks() {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// =============================================================================
+// Adding Keywords
+// =============================================================================
+
+// Add adds a keyword with optional file type hints. Hints for a keyword
+// already in the set are merged.
+func (s *Set) Add(keyword string, fileTypes ...string) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return
+	}
+
+	key := strings.ToLower(keyword)
+	if kept, ok := s.seen[key]; ok {
+		keyword = kept
+	} else {
+		s.seen[key] = keyword
+		s.keywords = append(s.keywords, keyword)
+	}
+
+	for _, ft := range fileTypes {
+		ft = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ft), "."))
+		if ft != "" && !contains(s.fileTypes[keyword], ft) {
+			s.fileTypes[keyword] = append(s.fileTypes[keyword], ft)
+		}
+	}
+}
+
+// AddLine adds a keyword written in wordlist syntax.
+func (s *Set) AddLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	keyword, hints, _ := strings.Cut(line, "|")
+	var fileTypes []string
+	if hints != "" {
+		fileTypes = strings.Split(hints, ",")
+	}
+	s.Add(keyword, fileTypes...)
+}
+
+// AddProfile adds the keywords of a built-in profile.
+func (s *Set) AddProfile(name string) error {
+	lines, ok := config.KeywordProfiles()[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("unknown keyword profile %q (available: %s)", name, strings.Join(Profiles(), ", "))
+	}
+	for _, line := range lines {
+		s.AddLine(line)
+	}
+	return nil
+}
+
+// AddLanguage adds the keywords of a language pack by its ISO 639-1 code
+// and records the language, so Apply also enables its password key names
+// in the extractor.
+func (s *Set) AddLanguage(code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	pack, ok := config.LanguagePacks()[code]
+	if !ok {
+		return fmt.Errorf("unknown language %q (available: %s)", code, strings.Join(Languages(), ", "))
+	}
+	for _, line := range pack.Keywords {
+		s.AddLine(line)
+	}
+	if !contains(s.languages, code) {
+		s.languages = append(s.languages, code)
+	}
+	return nil
+}
+
+// AddFile adds the keywords of a wordlist file.
+func (s *Set) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open wordlist: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		s.AddLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read wordlist %s: %w", path, err)
+	}
+	return nil
+}
+
+// =============================================================================
+// Using the Set
+// =============================================================================
+
+// Keywords returns the keywords in the order they were added.
+func (s *Set) Keywords() []string {
+	return append([]string(nil), s.keywords...)
+}
+
+// FileTypes returns the file type hints by keyword.
+func (s *Set) FileTypes() map[string][]string {
+	hints := make(map[string][]string, len(s.fileTypes))
+	for k, v := range s.fileTypes {
+		hints[k] = append([]string(nil), v...)
+	}
+	return hints
+}
+
+// Len returns the number of keywords.
+func (s *Set) Len() int {
+	return len(s.keywords)
+}
+
+// Languages returns the codes of the language packs added.
+func (s *Set) Languages() []string {
+	return append([]string(nil), s.languages...)
+}
+
+// Apply sets the keywords, their file type hints and the languages added
+// on search options.
+func (s *Set) Apply(opts *types.SearchOptions) {
+	opts.Keywords = s.Keywords()
+	opts.KeywordFileTypes = s.FileTypes()
+	opts.Languages = s.Languages()
+}
+
+// =============================================================================
+// Language Suggestions
+// =============================================================================
+
+// SuggestLanguages returns the language packs worth adding for a tenant,
+// from its users' preferred languages ("de-DE" counts for "de"). A pack is
+// suggested when at least config.LanguageSuggestMinShare of the users with
+// a preferred language use it. Codes are ordered by user count.
+func SuggestLanguages(users []types.User) []string {
+	packs := config.LanguagePacks()
+	counts := make(map[string]int)
+	total := 0
+	for _, u := range users {
+		lang := strings.ToLower(strings.TrimSpace(u.PreferredLanguage))
+		if lang == "" {
+			continue
+		}
+		total++
+		code, _, _ := strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-")
+		if _, ok := packs[code]; ok {
+			counts[code]++
+		}
+	}
+
+	var codes []string
+	for code, n := range counts {
+		if float64(n) >= config.LanguageSuggestMinShare*float64(total) {
+			codes = append(codes, code)
+		}
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if counts[codes[i]] != counts[codes[j]] {
+			return counts[codes[i]] > counts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	return codes
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+// Package output writes results to files in the formats consumed by other
+// tools.
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/loosehose/azonk/internal/config"
+	"github.com/loosehose/azonk/internal/types"
+)
+
+// =============================================================================
+// SARIF 2.1.0 Types
+// =============================================================================
+
+// SARIFLog is the root of a SARIF 2.1.0 document. Only the parts of the
+// schema needed to describe secret findings are modelled.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           sarifProperties    `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifProperties struct {
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	RelatedLocations    []sarifLocation   `json:"relatedLocations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]any    `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                   `json:"id,omitempty"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+	Message          *sarifMessage          `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+	ContextRegion    *sarifRegion          `json:"contextRegion,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	EndLine     int           `json:"endLine,omitempty"`
+	StartColumn int           `json:"startColumn,omitempty"`
+	EndColumn   int           `json:"endColumn,omitempty"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// =============================================================================
+// SARIF Conversion
+// =============================================================================
+
+// BuildSARIF converts findings to a SARIF log with one rule per detector.
+// Findings from patterns missing from rules get a rule of their own.
+func BuildSARIF(rules []types.RuleInfo, matches []types.SecretMatch) *SARIFLog {
+	driver := sarifDriver{
+		Name:           config.ToolName,
+		InformationURI: config.ToolURL,
+		Rules:          []sarifRule{},
+	}
+
+	index := make(map[string]int)
+	addRule := func(rule types.RuleInfo) int {
+		id := ruleID(rule.Name)
+		if i, ok := index[id]; ok {
+			return i
+		}
+		if rule.Description == "" {
+			rule.Description = rule.Name
+		}
+		index[id] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   id,
+			Name:                 rule.Name,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+			Properties: sarifProperties{
+				SecuritySeverity: securitySeverity(rule.Severity),
+				Tags:             []string{"security", "secret"},
+			},
+		})
+		return index[id]
+	}
+	for _, rule := range rules {
+		addRule(rule)
+	}
+
+	results := make([]sarifResult, 0, len(matches))
+	for _, m := range matches {
+		severity := m.Severity
+		if severity == "" {
+			severity = types.SeverityMedium
+		}
+		idx := addRule(types.RuleInfo{Name: m.PatternName, Severity: severity})
+		results = append(results, sarifFinding(m, driver.Rules[idx].ID, idx, severity))
+	}
+
+	return &SARIFLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+// WriteSARIF writes findings as a SARIF 2.1.0 log to path.
+func WriteSARIF(path string, rules []types.RuleInfo, matches []types.SecretMatch) error {
+	data, err := json.MarshalIndent(BuildSARIF(rules, matches), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal SARIF: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write SARIF: %w", err)
+	}
+	return nil
+}
+
+// sarifFinding converts one finding to a result located in the scanned
+// file, with the container position as a logical location and the
+// SharePoint item as a related location. Lines and columns of findings
+// inside a container (an archive entry, OLE stream or git blob) count
+// within that inner document, so they go in the logical location and the
+// message rather than a region of the outer file.
+func sarifFinding(m types.SecretMatch, id string, idx int, severity types.Severity) sarifResult {
+	text := fmt.Sprintf("%s found in %s", m.PatternName, filepath.Base(m.File))
+	inner := m.Location
+	if inner != "" && m.Line > 0 {
+		inner += fmt.Sprintf(":%d", m.Line)
+		if m.Column > 0 {
+			inner += fmt.Sprintf(":%d", m.Column)
+		}
+	}
+	if inner != "" {
+		text += " at " + inner
+	}
+
+	physical := &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: fileURI(m.File)}}
+	if m.Line > 0 && m.Location == "" {
+		physical.Region = &sarifRegion{StartLine: m.Line, StartColumn: m.Column}
+		// Decoded matches are positioned at the encoded segment, whose
+		// text differs from the match
+		if len(m.DecodeChain) == 0 {
+			physical.Region.Snippet = &sarifMessage{Text: m.Match}
+			if m.Column > 0 {
+				physical.Region.EndColumn = m.Column + utf8.RuneCountInString(m.Match)
+			}
+		}
+		physical.ContextRegion = contextRegion(m)
+	}
+
+	location := sarifLocation{PhysicalLocation: physical}
+	if inner != "" {
+		location.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: inner, Kind: "element"}}
+	}
+
+	result := sarifResult{
+		RuleID:    id,
+		RuleIndex: idx,
+		Level:     sarifLevel(severity),
+		Message:   sarifMessage{Text: text},
+		Locations: []sarifLocation{location},
+		PartialFingerprints: map[string]string{
+			"secretHash/v1": fingerprint(m),
+		},
+		Properties: map[string]any{"severity": severity},
+	}
+
+	if p := m.Provenance; p != nil && p.WebURL != "" {
+		relatedID := 1
+		result.RelatedLocations = []sarifLocation{{
+			ID:               &relatedID,
+			PhysicalLocation: &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: p.WebURL}},
+			Message:          &sarifMessage{Text: "SharePoint/OneDrive item " + p.Path},
+		}}
+	}
+	if len(m.DecodeChain) > 0 {
+		result.Properties["decodeChain"] = m.DecodeChain
+	}
+	if m.Region != "" {
+		result.Properties["region"] = m.Region
+	}
+	if m.Commit != nil {
+		result.Properties["commit"] = m.Commit
+	}
+	if m.Mail != nil {
+		result.Properties["mail"] = m.Mail
+	}
+	if m.Chat != nil {
+		result.Properties["chat"] = m.Chat
+	}
+	if m.KeyMaterial != nil {
+		result.Properties["keyMaterial"] = m.KeyMaterial
+	}
+	if m.Protection != nil {
+		result.Properties["protection"] = m.Protection
+	}
+	return result
+}
+
+// contextRegion returns the context lines as a region, or nil when the
+// finding has none. Decoded matches have the lines around the encoded
+// segment as context.
+func contextRegion(m types.SecretMatch) *sarifRegion {
+	if len(m.ContextLines) == 0 {
+		return nil
+	}
+
+	lines := make([]string, len(m.ContextLines))
+	for i, line := range m.ContextLines {
+		lines[i] = line.Text
+	}
+	return &sarifRegion{
+		StartLine: m.ContextLines[0].Number,
+		EndLine:   m.ContextLines[len(m.ContextLines)-1].Number,
+		Snippet:   &sarifMessage{Text: strings.Join(lines, "\n")},
+	}
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+// ruleID turns a pattern name into a stable rule ID, e.g.
+// "Azure SQL Connection" becomes "azure-sql-connection".
+func ruleID(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+func sarifLevel(s types.Severity) string {
+	switch s {
+	case types.SeverityCritical, types.SeverityHigh:
+		return "error"
+	case types.SeverityLow:
+		return "note"
+	}
+	return "warning"
+}
+
+// securitySeverity maps severities to the numeric scores dashboards use
+// to bucket results (critical is 9.0 and above).
+func securitySeverity(s types.Severity) string {
+	switch s {
+	case types.SeverityCritical:
+		return "9.5"
+	case types.SeverityHigh:
+		return "8.0"
+	case types.SeverityLow:
+		return "2.0"
+	}
+	return "5.0"
+}
+
+// fingerprint identifies a finding across runs without embedding the
+// secret itself.
+func fingerprint(m types.SecretMatch) string {
+	sum := sha256.Sum256([]byte(m.PatternName + "\x00" + m.Match))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fileURI returns a URI for a local path, relative paths staying relative.
+func fileURI(path string) string {
+	u := url.URL{Path: filepath.ToSlash(path)}
+	if filepath.IsAbs(path) {
+		u.Scheme = "file"
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path // Windows drive paths
+		}
+	}
+	return u.String()
+}
@@ -0,0 +1,77 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/loosehose/azonk/internal/types"
+)
+
+func TestSARIFFindingRegion(t *testing.T) {
+	context := []types.ContextLine{{Number: 2, Text: "x"}, {Number: 3, Text: "password = Winter2024!", Match: true}}
+
+	tests := []struct {
+		name    string
+		match   types.SecretMatch
+		region  int    // Start line of the physical region, 0 for none
+		logical string // Logical location, "" for none
+		message string
+	}{
+		{
+			name:    "file",
+			match:   types.SecretMatch{File: "/tmp/app.config", Line: 3, Column: 1, Match: "password = Winter2024!", ContextLines: context},
+			region:  3,
+			message: "Password found in app.config",
+		},
+		{
+			name:    "decoded in the file",
+			match:   types.SecretMatch{File: "/tmp/app.config", Line: 3, Column: 9, Match: "password = Winter2024!", DecodeChain: []string{"base64"}, ContextLines: context},
+			region:  3,
+			message: "Password found in app.config",
+		},
+		{
+			name:    "zip entry",
+			match:   types.SecretMatch{File: "/tmp/backup.zip", Location: "conf/app.config", Line: 3, Column: 1, Match: "password = Winter2024!", ContextLines: context},
+			logical: "conf/app.config:3:1",
+			message: "Password found in backup.zip at conf/app.config:3:1",
+		},
+		{
+			name:    "container without a line",
+			match:   types.SecretMatch{File: "/tmp/backup.zip", Location: "secrets.kdbx"},
+			logical: "secrets.kdbx",
+			message: "Password found in backup.zip at secrets.kdbx",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.match.PatternName = "Password"
+			r := sarifFinding(tt.match, "password", 0, types.SeverityHigh)
+			loc := r.Locations[0]
+
+			region := 0
+			if reg := loc.PhysicalLocation.Region; reg != nil {
+				region = reg.StartLine
+			}
+			if region != tt.region {
+				t.Errorf("region starts on line %d, want %d", region, tt.region)
+			}
+			if tt.region == 0 && loc.PhysicalLocation.ContextRegion != nil {
+				t.Errorf("context region %+v in the outer file", loc.PhysicalLocation.ContextRegion)
+			}
+			if tt.region > 0 && loc.PhysicalLocation.ContextRegion == nil {
+				t.Error("no context region")
+			}
+
+			logical := ""
+			if len(loc.LogicalLocations) > 0 {
+				logical = loc.LogicalLocations[0].FullyQualifiedName
+			}
+			if logical != tt.logical {
+				t.Errorf("logical location %q, want %q", logical, tt.logical)
+			}
+			if r.Message.Text != tt.message {
+				t.Errorf("message %q, want %q", r.Message.Text, tt.message)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@
 // seamless data flow between authentication, search, download, and extraction.
 package types
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // =============================================================================
 // Authentication Types
@@ -53,6 +56,7 @@ type User struct {
 	Mail              string `json:"mail"`
 	JobTitle          string `json:"jobTitle"`
 	Department        string `json:"department"`
+	PreferredLanguage string `json:"preferredLanguage"`
 	AccountEnabled    bool   `json:"accountEnabled"`
 }
 
@@ -102,13 +106,131 @@ type DriveItem struct {
 	Created   string `json:"created"`
 	Modified  string `json:"modified"`
 	MatchedOn string `json:"matchedOn,omitempty"` // Search term that matched
+	Summary   string `json:"summary,omitempty"`   // Hit-highlighted snippet, <c0> marks hits and <ddd/> elisions
+	Rank      int    `json:"rank,omitempty"`      // Relevance rank within the query, from 1
+
+	SiteID     string `json:"siteId,omitempty"`     // Set for site, list and list item hits
+	ListID     string `json:"listId,omitempty"`     // Set for list and list item hits
+	ListItemID string `json:"listItemId,omitempty"` // Set for list item hits
+
+	Signature string `json:"signature,omitempty"` // Sensitive file signature matched by name, for filename hunt hits
+	Priority  int    `json:"priority,omitempty"`  // Download priority of the signature, 1 to 3
+	Detector  string `json:"detector,omitempty"`  // Detector whose literals built the query, for detector query hits
+}
+
+// DetectorQuery is a KQL query derived from a detector's literal prefix or
+// keywords.
+type DetectorQuery struct {
+	Detector string `json:"detector"`
+	Query    string `json:"query"`
+}
+
+// snippetMarkers strips the hit highlighting search adds to snippets.
+var snippetMarkers = strings.NewReplacer("<c0>", "", "</c0>", "", "<ddd/>", "...")
+
+// SnippetText returns the search snippet as plain text.
+func (d DriveItem) SnippetText() string {
+	return StripHighlights(d.Summary)
+}
+
+// StripHighlights turns a hit-highlighted search snippet into plain text.
+func StripHighlights(summary string) string {
+	return snippetMarkers.Replace(summary)
 }
 
+// Search entity types. Hits of every type are carried as DriveItems; only
+// drive items are files that can be downloaded.
+const (
+	EntityDriveItem = "driveItem"
+	EntityListItem  = "listItem"
+	EntityList      = "list"
+	EntitySite      = "site"
+	EntityDrive     = "drive"
+)
+
+// Entity types for mailbox and Teams messages, which are searched on their
+// own and carried as MailMessages and ChatMessages.
+const (
+	EntityMessage     = "message"
+	EntityChatMessage = "chatMessage"
+)
+
 // SearchResult aggregates results from a single search query.
 type SearchResult struct {
-	Query     string      `json:"query"`
-	TotalHits int         `json:"totalHits"`
-	Items     []DriveItem `json:"items"`
+	Query      string      `json:"query"`
+	EntityType string      `json:"entityType"` // Entity type searched; empty means driveItem
+	TotalHits  int         `json:"totalHits"`
+	Items      []DriveItem `json:"items"`
+}
+
+// HoldsFiles reports whether the result's items are files.
+func (r SearchResult) HoldsFiles() bool {
+	return r.EntityType == "" || r.EntityType == EntityDriveItem
+}
+
+// SearchAggregates is an overview of where search hits are concentrated,
+// per keyword and combined across keywords.
+type SearchAggregates struct {
+	Queries []AggregateResult   `json:"queries"`
+	Totals  []SearchAggregation `json:"totals"` // Bucket counts summed across queries
+}
+
+// AggregateResult holds the aggregations for one query.
+type AggregateResult struct {
+	Query        string              `json:"query"`
+	TotalHits    int                 `json:"totalHits"`
+	Aggregations []SearchAggregation `json:"aggregations"`
+}
+
+// SearchAggregation counts hits by the values of one property.
+type SearchAggregation struct {
+	Name       string              `json:"name"`  // site, author, extension or modified
+	Field      string              `json:"field"` // Search schema property aggregated
+	Buckets    []AggregationBucket `json:"buckets"`
+	LowerBound bool                `json:"lowerBound,omitempty"` // A query hit its bucket limit, so totals may be low
+}
+
+// AggregationBucket is one property value and its hit count.
+type AggregationBucket struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	Filter string `json:"filter,omitempty"` // Token that narrows a follow-up query to this bucket
+}
+
+// MailMessage is a mailbox message surfaced by search. Recipients are
+// filled in when the message is fetched.
+type MailMessage struct {
+	ID             string   `json:"id"`
+	Subject        string   `json:"subject"`
+	From           string   `json:"from"` // "Name <address>"
+	To             []string `json:"to,omitempty"`
+	Cc             []string `json:"cc,omitempty"`
+	Received       string   `json:"received"`
+	HasAttachments bool     `json:"hasAttachments,omitempty"`
+	WebLink        string   `json:"webLink,omitempty"` // Opens the message in Outlook on the web
+	MatchedOn      string   `json:"matchedOn,omitempty"`
+	Summary        string   `json:"summary,omitempty"` // Hit-highlighted snippet
+}
+
+// ChatMessage is a Teams chat or channel message surfaced by search.
+type ChatMessage struct {
+	ID        string `json:"id"`
+	ChatID    string `json:"chatId,omitempty"`    // Set for chat messages
+	TeamID    string `json:"teamId,omitempty"`    // Set for channel messages
+	ChannelID string `json:"channelId,omitempty"` // Set for channel messages
+	From      string `json:"from"`
+	Created   string `json:"created"`
+	WebURL    string `json:"webUrl,omitempty"` // Deep link to the message in Teams
+	MatchedOn string `json:"matchedOn,omitempty"`
+	Summary   string `json:"summary,omitempty"` // Hit-highlighted snippet
+}
+
+// Conversation names the chat or channel a message was posted in.
+func (m ChatMessage) Conversation() string {
+	if m.ChannelID != "" {
+		return "Teams channel " + m.ChannelID
+	}
+	return "Teams chat " + m.ChatID
 }
 
 // =============================================================================
@@ -128,12 +250,136 @@ type DownloadedFile struct {
 
 // SecretMatch represents a potential secret found during extraction.
 type SecretMatch struct {
-	File        string `json:"file"`
-	Line        int    `json:"line"`
-	PatternName string `json:"patternName"`
-	Match       string `json:"match"`
-	Context     string `json:"context"`              // Surrounding text for context
-	SourceItem  string `json:"sourceItem,omitempty"` // Original SharePoint item name
+	File        string   `json:"file"`
+	Location    string   `json:"location,omitempty"` // Position inside a container (e.g. "Sheet1!B4")
+	Line        int      `json:"line"`
+	Column      int      `json:"column,omitempty"` // 1-based, in characters
+	PatternName string   `json:"patternName"`
+	Severity    Severity `json:"severity,omitempty"`
+	Match       string   `json:"match"`
+	Context     string   `json:"context"`              // Matching line, trimmed to the context width
+	SourceItem  string   `json:"sourceItem,omitempty"` // Original SharePoint item name
+
+	ContextLines []ContextLine `json:"contextLines,omitempty"` // Lines around the match, in order
+
+	Region      string       `json:"region,omitempty"`      // Hidden content region, e.g. "hidden-sheet", "vba-module"
+	DecodeChain []string     `json:"decodeChain,omitempty"` // Encodings peeled to reach the match, outermost first
+	KeyMaterial *KeyMaterial `json:"keyMaterial,omitempty"` // Set for certificate/key file findings
+	Protection  *Protection  `json:"protection,omitempty"`  // Set for password-protected containers
+	Provenance  *Provenance  `json:"provenance,omitempty"`  // Where the scanned content came from
+	Commit      *GitCommit   `json:"commit,omitempty"`      // Set for findings in git history
+	Mail        *MailMessage `json:"mail,omitempty"`        // Set for findings in mailbox messages
+	Chat        *ChatMessage `json:"chat,omitempty"`        // Set for findings in Teams messages
+}
+
+// GitCommit identifies the commit that added a line found in git history.
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email,omitempty"`
+	Date    string `json:"date,omitempty"` // RFC 3339, in the author's time zone
+	Subject string `json:"subject,omitempty"`
+	Path    string `json:"path"` // File path within the repository
+}
+
+// Severity ranks how damaging a finding is likely to be.
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical" // Working credential for a cloud service
+	SeverityHigh     Severity = "high"     // Likely credential, needs context to use
+	SeverityMedium   Severity = "medium"   // Possibly sensitive
+	SeverityLow      Severity = "low"      // Reconnaissance value only
+)
+
+// RuleInfo describes a detector for reports that list rules separately
+// from results, such as SARIF.
+type RuleInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Severity    Severity `json:"severity"`
+}
+
+// ContextLine is one line of text around a finding. Lines are numbered
+// within the text the match was found in, which for decoded matches is the
+// decoded text. Lines wider than the context width are cut to a window
+// marked with "...".
+type ContextLine struct {
+	Number     int    `json:"number"`
+	Text       string `json:"text"`
+	Match      bool   `json:"match,omitempty"`      // The line containing the match
+	MatchStart int    `json:"matchStart,omitempty"` // Character offset of the match within Text
+	MatchEnd   int    `json:"matchEnd,omitempty"`   // Character offset just past the match
+}
+
+// Provenance makes a finding self-contained: it identifies the source item
+// in SharePoint/OneDrive and the exact local content that was scanned.
+type Provenance struct {
+	DriveID      string `json:"driveId,omitempty"`
+	ItemID       string `json:"itemId,omitempty"`
+	Name         string `json:"name,omitempty"`
+	WebURL       string `json:"webUrl,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	OwnerMail    string `json:"ownerEmail,omitempty"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Query        string `json:"query,omitempty"` // Search query that surfaced the item
+	LocalPath    string `json:"localPath,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`       // Hash of the local file
+	SHA256Prefix bool   `json:"sha256Prefix,omitempty"` // SHA256 covers only the first MaxFileSizeForScan bytes
+}
+
+// FromDriveItem fills in the SharePoint/OneDrive fields from a search hit.
+func (p *Provenance) FromDriveItem(item DriveItem) {
+	p.DriveID = item.DriveID
+	p.ItemID = item.ID
+	p.Name = item.Name
+	p.WebURL = item.WebURL
+	p.Path = item.Path
+	p.Owner = item.Owner
+	p.OwnerMail = item.OwnerMail
+	p.Created = item.Created
+	p.LastModified = item.Modified
+	p.Query = item.MatchedOn
+}
+
+// KeyMaterial describes a private key or PKCS#12 key store analyzed offline.
+type KeyMaterial struct {
+	Format        string            `json:"format"` // PKCS#12, PEM, DER, OpenSSH
+	Protected     bool              `json:"protected"`
+	Opened        bool              `json:"opened"`             // Contents could be read
+	Password      string            `json:"password,omitempty"` // Recovered password
+	HasPrivateKey bool              `json:"hasPrivateKey"`
+	KeyType       string            `json:"keyType,omitempty"` // e.g. "RSA 2048", "ECDSA P-256"
+	Certificates  []CertificateInfo `json:"certificates,omitempty"`
+	Unopenable    string            `json:"unopenable,omitempty"` // Why candidate passwords are not tried
+}
+
+// Protection describes a password-protected container: an encrypted Office
+// document, ZIP archive or KeePass database.
+type Protection struct {
+	Format   string `json:"format"`            // Office, ZIP, KeePass
+	Scheme   string `json:"scheme"`            // e.g. "Agile AES-256", "ZipCrypto", "KDBX 4 AES-256"
+	KDF      string `json:"kdf,omitempty"`     // Key derivation and its work factor, e.g. "SHA512 x100000"
+	Entries  int    `json:"entries,omitempty"` // Encrypted entries, for archives
+	Openable bool   `json:"openable"`          // Scheme can be opened with a candidate password
+	Opened   bool   `json:"opened"`
+	Password string `json:"password,omitempty"` // Recovered password
+}
+
+// CertificateInfo identifies a certificate, e.g. to map it back to an app
+// registration (by thumbprint) or server (by subject/SAN).
+type CertificateInfo struct {
+	Subject      string   `json:"subject"`
+	Issuer       string   `json:"issuer"`
+	Thumbprint   string   `json:"thumbprint"` // SHA-1, as shown by Azure and Windows
+	SerialNumber string   `json:"serialNumber"`
+	NotBefore    string   `json:"notBefore"`
+	NotAfter     string   `json:"notAfter"`
+	DNSNames     []string `json:"dnsNames,omitempty"`
+	KeyType      string   `json:"keyType"`
+	Expired      bool     `json:"expired"`
 }
 
 // =============================================================================
@@ -142,12 +388,35 @@ type SecretMatch struct {
 
 // SearchOptions configures search behavior including keywords and file filtering.
 type SearchOptions struct {
-	Keywords      []string // Search terms to query
-	FileTypes     []string // File extensions to filter (e.g., "xlsx", "docx")
-	MaxPerQuery   int      // Maximum results per query (default 25)
-	IncludeKQL    bool     // Use KQL filetype: syntax in queries
-	AutoDownload  bool     // Automatically download matching files
-	ExtractSecret bool     // Run secret extraction on downloaded files
+	Keywords         []string            // Search terms to query
+	KeywordFileTypes map[string][]string // File type hints by keyword, used in place of FileTypes
+	FileTypes        []string            // File extensions to filter (e.g., "xlsx", "docx")
+	MaxPerQuery      int                 // Maximum results per query (default 25)
+	IncludeKQL       bool                // Use KQL filetype: syntax in queries
+	AutoDownload     bool                // Automatically download matching files
+	ExtractSecret    bool                // Run secret extraction on downloaded files
+	OpenProtected    bool                // Try candidate passwords against encrypted files
+	Teams            bool                // Also hunt Teams chat and channel messages
+	Scope            QueryScope          // KQL restrictions applied to every query
+	EntityTypes      []string            // Entity types to search (default driveItem)
+	Languages        []string            // Language packs whose password key names are detected
+	FileNames        bool                // Also hunt files by sensitive file signature
+	DetectorQueries  bool                // Also search with queries derived from the detectors
+}
+
+// QueryScope narrows search queries with KQL property restrictions. Several
+// values for one restriction are OR'd together; restrictions are AND'ed.
+// Zero values leave a restriction out.
+type QueryScope struct {
+	Sites          []string  // Site collection URLs (site:)
+	Paths          []string  // Library or folder URLs (path:)
+	ExcludePaths   []string  // URLs to leave out (-path:)
+	Authors        []string  // Author display names (author:)
+	FileNames      []string  // File names, trailing * as a prefix wildcard (filename:)
+	ModifiedAfter  time.Time // Earliest LastModifiedTime, inclusive
+	ModifiedBefore time.Time // Latest LastModifiedTime, inclusive
+	MinSize        int64     // Minimum size in bytes
+	MaxSize        int64     // Maximum size in bytes
 }
 
 // HuntResult represents the complete output of a hunt operation,
@@ -155,6 +424,8 @@ type SearchOptions struct {
 type HuntResult struct {
 	SearchResults   []SearchResult   `json:"searchResults"`
 	DownloadedFiles []DownloadedFile `json:"downloadedFiles"`
+	Messages        []MailMessage    `json:"messages,omitempty"`
+	ChatMessages    []ChatMessage    `json:"chatMessages,omitempty"`
 	SecretsFound    []SecretMatch    `json:"secretsFound"`
 	Summary         HuntSummary      `json:"summary"`
 }
@@ -165,9 +436,58 @@ type HuntSummary struct {
 	TotalHits       int `json:"totalHits"`
 	UniqueFiles     int `json:"uniqueFiles"`
 	FilesDownloaded int `json:"filesDownloaded"`
+	ListItemsRead   int `json:"listItemsRead,omitempty"`
+	MessagesScanned int `json:"messagesScanned,omitempty"`
+	ChatsScanned    int `json:"chatsScanned,omitempty"` // Teams chat and channel messages
 	SecretsFound    int `json:"secretsFound"`
 }
 
+// =============================================================================
+// Sweep Types
+// =============================================================================
+
+// SymlinkPolicy controls how a sweep treats symbolic links.
+type SymlinkPolicy string
+
+const (
+	SymlinkSkip   SymlinkPolicy = ""       // Ignore all symlinks (default)
+	SymlinkFiles  SymlinkPolicy = "files"  // Follow links to files only
+	SymlinkFollow SymlinkPolicy = "follow" // Follow links to files and directories
+)
+
+// SweepOptions configures a sweep of a local tree or mounted file share.
+// Globs use path.Match syntax and are matched against both the base name
+// and the slash-separated path relative to Root.
+type SweepOptions struct {
+	Root          string        // Directory to sweep
+	Include       []string      // Only scan files matching one of these globs (empty = all)
+	Exclude       []string      // Skip files and directories matching any of these globs
+	MaxDepth      int           // Directory levels to descend below Root (0 = unlimited)
+	Symlinks      SymlinkPolicy // How to treat symbolic links
+	MaxFileSize   int64         // Skip larger files (0 = MaxFileSizeForScan)
+	MaxTotalBytes int64         // Stop queuing files past this many bytes (0 = unlimited)
+	CacheFile     string        // Hash cache of scanned files, reused across sweeps (empty = none)
+}
+
+// SweepResult is the outcome of a sweep, reported like a hunt's secrets.
+type SweepResult struct {
+	Root         string        `json:"root"`
+	SecretsFound []SecretMatch `json:"secretsFound"`
+	Summary      SweepSummary  `json:"summary"`
+}
+
+// SweepSummary provides aggregate statistics for a sweep.
+type SweepSummary struct {
+	FilesFound      int   `json:"filesFound"`
+	FilesScanned    int   `json:"filesScanned"`
+	FilesSkipped    int   `json:"filesSkipped"` // Filtered out by glob or size
+	FilesCached     int   `json:"filesCached"`  // Unchanged or duplicate content already scanned
+	BytesScanned    int64 `json:"bytesScanned"`
+	BudgetExhausted bool  `json:"budgetExhausted,omitempty"`
+	FilesUnqueued   int   `json:"filesUnqueued,omitempty"` // Left unqueued once the byte budget was reached
+	SecretsFound    int   `json:"secretsFound"`
+}
+
 // =============================================================================
 // Assessment Types
 // =============================================================================